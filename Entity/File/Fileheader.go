@@ -1,9 +1,12 @@
 package File
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"time"
+	"unsafe"
 	"wudb/Util"
 )
 
@@ -28,6 +31,18 @@ const (
 	PAGE_SIZE  = 4096       //4kb
 )
 
+// 校验和字段在文件头中的位置，计算校验和时这4个字节按0处理
+const checksumOffset = unsafe.Offsetof(FileHeader{}.Checksum)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// 计算序列化后文件头的CRC32C校验和
+func Checksum(data []byte) uint32 {
+	crc := crc32.Update(0, crc32cTable, data[:checksumOffset])
+	crc = crc32.Update(crc, crc32cTable, make([]byte, 4))
+	return crc32.Update(crc, crc32cTable, data[checksumOffset+4:])
+}
+
 // 初始化文件头
 func NewFileHeader() *FileHeader {
 	return &FileHeader{
@@ -49,20 +64,44 @@ func (fh *FileHeader) ValidateMagic() bool {
 }
 
 func (fh *FileHeader) WriteToFile(file *Util.FileHandle) error {
-	// 1. 先将文件指针设置到文件开始处
-	if _, err := file.GetFile().Seek(0, 0); err != nil {
-		return fmt.Errorf("设置文件指针失败: %v", err)
+	// 1. 序列化带校验和的文件头
+	data, err := fh.SerializeTo()
+	if err != nil {
+		return err
 	}
 
-	// 2. 写入文件头
-	if err := binary.Write(file.GetFile(), binary.LittleEndian, fh); err != nil {
+	// 2. 写到文件开始处
+	if _, err := file.WriteAt(0, data); err != nil {
 		return fmt.Errorf("写入文件头失败: %v", err)
 	}
+	fh.Checksum = binary.LittleEndian.Uint32(data[checksumOffset:])
 
 	// 3. 确保写入磁盘
 	return file.GetFile().Sync()
 }
 
+// 序列化文件头，校验和在最后计算
+func (fh *FileHeader) SerializeTo() ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	if err := binary.Write(buffer, binary.LittleEndian, fh); err != nil {
+		return nil, fmt.Errorf("序列化文件头失败: %v", err)
+	}
+	data := buffer.Bytes()
+	binary.LittleEndian.PutUint32(data[checksumOffset:], Checksum(data))
+	return data, nil
+}
+
+// 反序列化文件头
+func (fh *FileHeader) DeserializeFrom(data []byte) error {
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, fh); err != nil {
+		return fmt.Errorf("解析文件头失败: %v", err)
+	}
+	if !fh.ValidateMagic() {
+		return fmt.Errorf("文件魔数错误: %x", fh.Magic)
+	}
+	return nil
+}
+
 func (fh *FileHeader) GetFileSize() uint32 {
 	return fh.FileSize
 }
@@ -0,0 +1,22 @@
+package Page
+
+// 溢出页保存放不进叶子节点的大值，整个数据区都用来存放数据
+// 同一个值的溢出页通过NextPageID串成链表，FreeSpaceStart记录本页已写入的数据末尾
+
+const (
+	OverflowDataSize = DataAreaSize // 每个溢出页能保存的数据长度
+)
+
+// 写入溢出数据，返回实际写入的字节数
+func (p *Page) SetOverflowData(data []byte) int {
+	p.Data = [DataAreaSize]byte{}
+	n := copy(p.Data[:], data)
+	p.Header.RecordCount = 0
+	p.Header.FreeSpaceStart = uint32(dataOffset + n)
+	return n
+}
+
+// 获取本页保存的溢出数据
+func (p *Page) GetOverflowData() []byte {
+	return p.Data[:p.Header.FreeSpaceStart-dataOffset]
+}
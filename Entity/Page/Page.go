@@ -21,41 +21,45 @@ Meta Page (第0页):
 |  - Tree Height         |
 +------------------------+
 
-Internal Node Page:
+Internal Node Page / Leaf Node Page:
 +------------------------+ <- 0
 |      PageHeader        |
 +------------------------+ <- 64
-|     Key Array          |
-+------------------------+
-|    Children Array      |
+|  Record Array          |  内部记录（键+子节点指针）或叶子记录（键+值），变长，从前向后追加
 +------------------------+ <- FreeSpaceStart
 |     Free Space         |
-+------------------------+ <- PageSize-SlotArraySize
-|     Slot Array         |
++------------------------+ <- FreeSpaceEnd
+|     Slot Array         |  每个槽4字节：记录偏移(2B) + 长度(2B)，按键有序，从后向前增长
++------------------------+ <- PageSize
 
-Leaf Node Page:
-+------------------------+ <- 0
-|      PageHeader        |
-+------------------------+ <- 64
-|     Key Array          |
-+------------------------+
-|    Record Array        |
-+------------------------+ <- FreeSpaceStart
-|     Free Space         |
-+------------------------+ <- PageSize-SlotArraySize
-|     Slot Array         |
+删除记录只移除槽，记录占用的空间在空闲空间不够时通过整理回收。
 */
 // 页大小 4KB = 4096 byte
 const PageSize = 4096
 
+const (
+	ErrPageFull       = Error("页面已满")
+	ErrKeyExists      = Error("key已存在")
+	ErrRecordNotFound = Error("记录不存在")
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
 type Page struct {
 	Header PageHeader
-	Key    [512]byte
-	Value  [3520]byte
+	Data   [DataAreaSize]byte
 }
 
 const (
-	KeyMaxSize = 64
+	KeyMaxSize    = Record.MaxKeySize
+	DataAreaSize  = PageSize - 64           // 页头之后的数据区大小
+	SlotEntrySize = 4                       // 槽：记录在页面中的偏移(2B) + 长度(2B)
+	MaxRecordSize = DataAreaSize / 4        // 单条记录序列化后的最大长度，保证分裂后每页都放得下
+	dataOffset    = PageSize - DataAreaSize // 数据区在页面中的起始偏移
 )
 
 func NewPage() *Page {
@@ -78,6 +82,7 @@ func (p *Page) SerializeTo() ([]byte, error) {
 	if err := binary.Write(buf, binary.LittleEndian, p); err != nil {
 		return nil, fmt.Errorf("序列化页面失败: %v", err)
 	}
+	setChecksum(buffer)
 
 	return buffer, nil
 }
@@ -94,339 +99,288 @@ func (p *Page) DeserializeFrom(data []byte) error {
 	}
 
 	// 复制数据区
-	copy(p.Key[:], data[PageHeaderSize:])
-	copy(p.Value[:], data[PageHeaderSize+512:])
+	copy(p.Data[:], data[dataOffset:])
 
 	return nil
 }
 
-// 写入数据到页面key
-func (p *Page) WriteKey(offset uint32, data []byte) error {
-	if offset+uint32(len(data)) > uint32(len(p.Key)) {
+// 写入数据到页面数据区
+func (p *Page) WriteData(offset uint32, data []byte) error {
+	if offset+uint32(len(data)) > uint32(len(p.Data)) {
 		return fmt.Errorf("写入超出页面大小: offset=%d, len=%d, maxSize=%d",
-			offset, len(data), len(p.Key))
+			offset, len(data), len(p.Data))
 	}
 
-	copy(p.Key[offset:], data)
+	copy(p.Data[offset:], data)
 	return nil
 }
 
-// 从页面读取数据
-func (p *Page) ReadKey(offset uint32, length uint32) ([]byte, error) {
-	if offset+length > uint32(len(p.Key)) {
+// 从页面数据区读取数据
+func (p *Page) ReadData(offset uint32, length uint32) ([]byte, error) {
+	if offset+length > uint32(len(p.Data)) {
 		return nil, fmt.Errorf("读取超出页面大小: offset=%d, len=%d, maxSize=%d",
-			offset, length, len(p.Key))
+			offset, length, len(p.Data))
 	}
 
 	result := make([]byte, length)
-	copy(result, p.Key[offset:offset+length])
+	copy(result, p.Data[offset:offset+length])
 	return result, nil
 }
 
-func (p *Page) WriteValue(offset uint32, data []byte) error {
-	if offset+uint32(len(data)) > uint32(len(p.Value)) {
-		return fmt.Errorf("写入超出页面大小: offset=%d, len=%d, maxSize=%d",
-			offset, len(data), len(p.Value))
-	}
-	copy(p.Value[offset:], data)
-	return nil
-}
+// 槽与变长记录
 
-func (p *Page) ReadValue(offset uint32, length uint32) ([]byte, error) {
-	if offset+length > uint32(len(p.Value)) {
-		return nil, fmt.Errorf("读取超出页面大小: offset=%d, len=%d, maxSize=%d",
-			offset, length, len(p.Value))
-	}
-	result := make([]byte, length)
-	copy(result, p.Value[offset:offset+length])
-	return result, nil
+// 第index个槽在数据区中的位置
+func (p *Page) slotPos(index int) int {
+	return int(p.Header.FreeSpaceEnd) - dataOffset + index*SlotEntrySize
 }
 
-// 内部节点有关
-
-// 查找内部节点记录
-func (p *Page) FindInternalRecord(recordKey [32]byte) *Record.InternalRecord {
-	// 返回值：
-	// -1 表示 key1 < key2
-	//  0 表示 key1 = key2
-	//  1 表示 key1 > key2
-	if bytes.Compare(p.Key[:32], recordKey[:]) > 0 {
-		return p.GetInternalRecord(0)
-	}
-	if p.Header.RecordCount == 0 {
-		return nil
-	}
-	if p.Header.RecordCount == 1 {
-		return p.GetInternalRecord(0)
-	}
-	for i := 0; i < int(p.Header.RecordCount)-1; i++ {
-		if bytes.Compare(p.Key[i*32:(i+1)*32], recordKey[:]) <= 0 && bytes.Compare(p.Key[(i+1)*32:(i+2)*32], recordKey[:]) > 0 {
-			return p.GetInternalRecord(i)
-		}
-	}
-
-	return p.GetInternalRecord(int(p.Header.RecordCount) - 1)
+// 读取第index个槽
+func (p *Page) getSlot(index int) (uint32, uint32) {
+	entry := p.Data[p.slotPos(index):]
+	return uint32(binary.LittleEndian.Uint16(entry[0:2])), uint32(binary.LittleEndian.Uint16(entry[2:4]))
 }
 
-func (p *Page) GetInternalRecord(id int) *Record.InternalRecord {
-	offset := id * int(Record.InternalRecordSize)
-	record := &Record.InternalRecord{}
-	record.DeserializeFrom(p.Value[offset : offset+int(Record.InternalRecordSize)])
-	return record
+// 写入第index个槽
+func (p *Page) setSlot(index int, offset, length uint32) {
+	entry := p.Data[p.slotPos(index):]
+	binary.LittleEndian.PutUint16(entry[0:2], uint16(offset))
+	binary.LittleEndian.PutUint16(entry[2:4], uint16(length))
 }
 
-// 叶子节点有关
-
-// 插入记录到叶子节点
-func (p *Page) InsertRecord(record *Record.Record) error {
-	if p.Header.RecordCount >= p.Header.MaxRecordCount {
-		return fmt.Errorf("页面已满")
-	}
+// 第index条记录序列化后的数据
+func (p *Page) entryAt(index int) []byte {
+	offset, length := p.getSlot(index)
+	start := offset - dataOffset
+	return p.Data[start : start+length]
+}
 
-	// 1. 找到插入位置
-	insertPos := 0
-	recordKey := record.GetKey()
+// 第index条记录的键
+func (p *Page) KeyAt(index int) []byte {
+	return Record.ParseKey(p.entryAt(index))
+}
 
-	// 二分查找插入位置
-	left, right := 0, int(p.Header.RecordCount)-1
-	for left <= right {
+// 二分查找键，返回第一个不小于key的位置以及是否相等
+func (p *Page) search(key []byte) (int, bool) {
+	left, right := 0, int(p.Header.RecordCount)
+	for left < right {
 		mid := (left + right) / 2
-		// 读取mid位置的key
-		currentKey, err := p.ReadKey(uint32(mid*32), 32)
-		if err != nil {
-			return fmt.Errorf("读取key失败: %v", err)
-		}
-
-		cmp := bytes.Compare(recordKey[:], currentKey[:])
-		if cmp == 0 {
-			return fmt.Errorf("key已存在")
-		} else if cmp < 0 {
-			right = mid - 1
-		} else {
+		if bytes.Compare(p.KeyAt(mid), key) < 0 {
 			left = mid + 1
+		} else {
+			right = mid
 		}
 	}
-	insertPos = left
-
-	// 2. 移动现有记录，为新记录腾出空间
-	if insertPos < int(p.Header.RecordCount) {
-		// 移动key
-		for i := int(p.Header.RecordCount); i > insertPos; i-- {
-			key, err := p.ReadKey(uint32((i-1)*32), 32)
-			if err != nil {
-				return fmt.Errorf("读取key失败: %v", err)
-			}
-			if err := p.WriteKey(uint32(i*32), key); err != nil {
-				return fmt.Errorf("写入key失败: %v", err)
-			}
-		}
-
-		// 移动value
-		for i := int(p.Header.RecordCount); i > insertPos; i-- {
-			value, err := p.ReadValue(uint32((uint32(i-1))*record.GetRecordSize()), uint32(record.GetRecordSize()))
-			if err != nil {
-				return fmt.Errorf("读取value失败: %v", err)
-			}
-			if err := p.WriteValue(uint32((uint32(i) * record.GetRecordSize())), value); err != nil {
-				return fmt.Errorf("写入value失败: %v", err)
-			}
-		}
-	}
+	return left, left < int(p.Header.RecordCount) && bytes.Equal(p.KeyAt(left), key)
+}
 
-	// 3. 写入新记录
-	if err := p.WriteKey(uint32(insertPos*32), recordKey[:]); err != nil {
-		return fmt.Errorf("写入key失败: %v", err)
-	}
+// 第一个键不小于key的记录位置，没有时返回记录数
+func (p *Page) LowerBound(key []byte) int {
+	pos, _ := p.search(key)
+	return pos
+}
 
-	recordValue, err := record.SerializeTo()
-	if err != nil {
-		return fmt.Errorf("序列化记录失败: %v", err)
+// 第一个键大于key的记录位置，没有时返回记录数
+func (p *Page) UpperBound(key []byte) int {
+	pos, found := p.search(key)
+	if found {
+		pos++
 	}
+	return pos
+}
 
-	if err := p.WriteValue(uint32((uint32(insertPos) * record.GetRecordSize())), recordValue[:]); err != nil {
-		return fmt.Errorf("写入value失败: %v", err)
+// 记录和槽占用的字节数，不包括删除后尚未整理的空洞
+func (p *Page) UsedSpace() uint32 {
+	used := p.Header.RecordCount * SlotEntrySize
+	for i := 0; i < int(p.Header.RecordCount); i++ {
+		_, length := p.getSlot(i)
+		used += length
 	}
-
-	// 4. 更新记录数
-	p.Header.RecordCount++
-
-	return nil
+	return used
 }
 
-// 分裂叶子节点
-func (p *Page) SplitKeyAndValue() ([]byte, []byte, [32]byte) {
-	splitPos := p.Header.RecordCount / 2
-
-	// 获取需要分割的数据
-	key := make([]byte, (p.Header.RecordCount-splitPos)*32)
-	value := make([]byte, (p.Header.RecordCount-splitPos)*p.Header.RecordSize)
+// 整理后可用的字节数
+func (p *Page) FreeSpace() uint32 {
+	return DataAreaSize - p.UsedSpace()
+}
 
-	// 复制要分割的数据
-	copy(key, p.Key[splitPos*32:(p.Header.RecordCount)*32])
-	copy(value, p.Value[splitPos*p.Header.RecordSize:(p.Header.RecordCount)*p.Header.RecordSize])
+// 整理记录区，把记录按槽的顺序紧凑排列，回收删除留下的空洞
+func (p *Page) Compact() {
+	var records [DataAreaSize]byte
+	offset := uint32(0)
+	for i := 0; i < int(p.Header.RecordCount); i++ {
+		entry := p.entryAt(i)
+		copy(records[offset:], entry)
+		p.setSlot(i, offset+dataOffset, uint32(len(entry)))
+		offset += uint32(len(entry))
+	}
+	slotStart := p.slotPos(0)
+	copy(p.Data[:slotStart], records[:slotStart])
+	p.Header.FreeSpaceStart = offset + dataOffset
+}
 
-	// 清空原页面中分割出去的数据
-	for i := splitPos * 32; i < p.Header.RecordCount*32; i++ {
-		p.Key[i] = 0
+// 在第index个槽的位置插入一条序列化后的记录
+func (p *Page) insertEntryAt(index int, data []byte) error {
+	length := uint32(len(data))
+	if p.FreeSpace() < length+SlotEntrySize {
+		return ErrPageFull
 	}
-	for i := splitPos * p.Header.RecordSize; i < p.Header.RecordCount*p.Header.RecordSize; i++ {
-		p.Value[i] = 0
+	if p.Header.FreeSpaceEnd-p.Header.FreeSpaceStart < length+SlotEntrySize {
+		p.Compact()
 	}
 
-	// 更新记录数
-	p.Header.RecordCount = splitPos
-	recordKey := [32]byte{}
-	copy(recordKey[:], key[0:32])
-	return key, value, recordKey
-}
-
-// 分裂记录并返回中间键
-func (p *Page) SplitRecords(newPage *Page) ([32]byte, error) {
-	// 计算中间位置
-	midIndex := p.Header.RecordCount / 2
+	// 记录写在空闲空间的开头
+	offset := p.Header.FreeSpaceStart
+	copy(p.Data[offset-dataOffset:], data)
+	p.Header.FreeSpaceStart += length
 
-	// 复制后半部分记录到新页面
-	for i := midIndex; i < p.Header.RecordCount; i++ {
-		key := p.Key[i*32 : (i+1)*32]
-		value := p.Value[i*p.Header.RecordSize : (i+1)*p.Header.RecordSize]
+	// 槽数组向前扩展一个槽，前index个槽跟着前移
+	oldStart := p.slotPos(0)
+	p.Header.FreeSpaceEnd -= SlotEntrySize
+	copy(p.Data[oldStart-SlotEntrySize:], p.Data[oldStart:oldStart+index*SlotEntrySize])
+	p.setSlot(index, offset, length)
+	p.Header.RecordCount++
+	return nil
+}
 
-		if err := newPage.WriteKey(uint32((i-midIndex)*32), key); err != nil {
-			return [32]byte{}, err
-		}
-		if err := newPage.WriteValue(uint32((i-midIndex)*p.Header.RecordSize), value); err != nil {
-			return [32]byte{}, err
-		}
+// 移除第index个槽，记录占用的空间在下次整理时回收
+func (p *Page) removeEntryAt(index int) error {
+	if index < 0 || index >= int(p.Header.RecordCount) {
+		return fmt.Errorf("索引越界")
 	}
-
-	// 更新记录数
-	newPage.Header.RecordCount = p.Header.RecordCount - midIndex
-	p.Header.RecordCount = midIndex
-
-	// 返回中间键
-	var middleKey [32]byte
-	copy(middleKey[:], p.Key[midIndex*32:(midIndex+1)*32])
-
-	return middleKey, nil
+	oldStart := p.slotPos(0)
+	copy(p.Data[oldStart+SlotEntrySize:], p.Data[oldStart:oldStart+index*SlotEntrySize])
+	copy(p.Data[oldStart:oldStart+SlotEntrySize], make([]byte, SlotEntrySize))
+	p.Header.FreeSpaceEnd += SlotEntrySize
+	p.Header.RecordCount--
+	if p.Header.RecordCount == 0 {
+		p.Header.FreeSpaceStart = dataOffset
+	}
+	return nil
 }
 
-// 插入内部记录
-func (p *Page) InsertInternalRecord(record *Record.InternalRecord) error {
-	if p.Header.RecordCount >= p.Header.MaxRecordCount {
-		return fmt.Errorf("页面已满")
+// 替换第index条记录，新数据不比原来长时原地覆盖
+func (p *Page) replaceEntryAt(index int, data []byte) error {
+	if index < 0 || index >= int(p.Header.RecordCount) {
+		return fmt.Errorf("索引越界")
+	}
+	offset, length := p.getSlot(index)
+	if uint32(len(data)) <= length {
+		copy(p.Data[offset-dataOffset:], data)
+		p.setSlot(index, offset, uint32(len(data)))
+		return nil
 	}
+	if p.FreeSpace()+length < uint32(len(data)) {
+		return ErrPageFull
+	}
+	p.removeEntryAt(index)
+	return p.insertEntryAt(index, data)
+}
 
-	// 1. 找到插入位置
-	insertPos := 0
-	recordKey := record.GetKey()
+// 内部节点有关
 
-	// 二分查找插入位置
-	left, right := 0, int(p.Header.RecordCount)-1
-	for left <= right {
+// 查找key所在子节点的下标
+// 内部节点有n条记录、n+1个子节点：第0个子节点是第0条记录的前驱指针，第i+1个子节点是第i条记录的后继指针
+func (p *Page) FindChildIndex(key []byte) int {
+	left, right := 0, int(p.Header.RecordCount)
+	for left < right {
 		mid := (left + right) / 2
-		// 读取mid位置的key
-		currentKey, err := p.ReadKey(uint32(mid*32), 32)
-		if err != nil {
-			return fmt.Errorf("读取key失败: %v", err)
-		}
-
-		cmp := bytes.Compare(recordKey[:], currentKey[:])
-		if cmp == 0 {
-			return fmt.Errorf("key已存在")
-		} else if cmp < 0 {
-			right = mid - 1
-		} else {
+		if bytes.Compare(p.KeyAt(mid), key) <= 0 {
 			left = mid + 1
+		} else {
+			right = mid
 		}
 	}
-	insertPos = left
-
-	// 2. 移动现有记录，为新记录腾出空间
-	if insertPos < int(p.Header.RecordCount) {
-		// 移动key
-		for i := int(p.Header.RecordCount); i > insertPos; i-- {
-			key, err := p.ReadKey(uint32((i-1)*32), 32)
-			if err != nil {
-				return fmt.Errorf("读取key失败: %v", err)
-			}
-			if err := p.WriteKey(uint32(i*32), key); err != nil {
-				return fmt.Errorf("写入key失败: %v", err)
-			}
-		}
+	return left
+}
 
-		// 移动内部记录数据
-		for i := int(p.Header.RecordCount); i > insertPos; i-- {
-			value, err := p.ReadValue(uint32((i-1)*int(Record.InternalRecordSize)), uint32(Record.InternalRecordSize))
-			if err != nil {
-				return fmt.Errorf("读取内部记录失败: %v", err)
-			}
-			if err := p.WriteValue(uint32(i*int(Record.InternalRecordSize)), value); err != nil {
-				return fmt.Errorf("写入内部记录失败: %v", err)
-			}
-		}
+// 获取第index个子节点的页面ID
+func (p *Page) GetChildPageID(index int) uint32 {
+	if p.Header.RecordCount == 0 {
+		return 0
 	}
-
-	// 3. 写入新记录
-	if err := p.WriteKey(uint32(insertPos*32), recordKey[:]); err != nil {
-		return fmt.Errorf("写入key失败: %v", err)
+	if index == 0 {
+		return p.GetInternalRecord(0).GetFrontPointer()
 	}
+	return p.GetInternalRecord(index - 1).GetNextPointer()
+}
 
-	// 序列化内部记录
-	recordValue, err := record.SerializeTo()
+// 获取所有内部记录
+func (p *Page) GetAllInternalRecords() []*Record.InternalRecord {
+	records := make([]*Record.InternalRecord, p.Header.RecordCount)
+	for i := range records {
+		records[i] = p.GetInternalRecord(i)
+	}
+	return records
+}
 
+// 覆盖指定位置的内部记录
+func (p *Page) UpdateInternalRecordAt(index int, record *Record.InternalRecord) error {
+	data, err := record.SerializeTo()
 	if err != nil {
 		return fmt.Errorf("序列化内部记录失败: %v", err)
 	}
+	return p.replaceEntryAt(index, data)
+}
 
-	// 写入内部记录数据
-	if err := p.WriteValue(uint32(insertPos*int(Record.InternalRecordSize)), recordValue); err != nil {
-		return fmt.Errorf("写入内部记录失败: %v", err)
-	}
-
-	// 4. 更新记录数
-	p.Header.RecordCount++
+// 移除指定位置的内部记录
+func (p *Page) RemoveInternalRecordAt(index int) error {
+	return p.removeEntryAt(index)
+}
 
-	return nil
+func (p *Page) GetInternalRecord(id int) *Record.InternalRecord {
+	record := &Record.InternalRecord{}
+	record.DeserializeFrom(p.entryAt(id))
+	return record
 }
 
-// 删除记录
-func (p *Page) DeleteRecord(key [32]byte) error {
-	// 二分查找记录位置
-	left, right := 0, int(p.Header.RecordCount)-1
-	for left <= right {
-		mid := (left + right) / 2
-		currentKey := p.Key[mid*32 : (mid+1)*32]
-		cmp := bytes.Compare(key[:], currentKey)
-		if cmp == 0 {
-			// 找到记录，删除它
-			return p.removeRecordAt(mid)
-		} else if cmp < 0 {
-			right = mid - 1
-		} else {
-			left = mid + 1
-		}
+// 插入内部记录
+func (p *Page) InsertInternalRecord(record *Record.InternalRecord) error {
+	pos, found := p.search(record.GetKey())
+	if found {
+		return ErrKeyExists
 	}
-
-	return fmt.Errorf("记录不存在")
+	data, err := record.SerializeTo()
+	if err != nil {
+		return fmt.Errorf("序列化内部记录失败: %v", err)
+	}
+	return p.insertEntryAt(pos, data)
 }
 
-// 移除指定位置的记录
-func (p *Page) removeRecordAt(index int) error {
-	if index < 0 || index >= int(p.Header.RecordCount) {
-		return fmt.Errorf("索引越界")
-	}
+// 叶子节点有关
 
-	// 移动后续记录
-	for i := index; i < int(p.Header.RecordCount)-1; i++ {
-		copy(p.Key[i*32:(i+1)*32], p.Key[(i+1)*32:(i+2)*32])
-		copy(p.Value[i*int(p.Header.RecordSize):(i+1)*int(p.Header.RecordSize)],
-			p.Value[(i+1)*int(p.Header.RecordSize):(i+2)*int(p.Header.RecordSize)])
+// 插入记录到叶子节点
+func (p *Page) InsertRecord(record *Record.Record) error {
+	pos, found := p.search(record.GetKey())
+	if found {
+		return ErrKeyExists
+	}
+	data, err := record.SerializeTo()
+	if err != nil {
+		return fmt.Errorf("序列化记录失败: %v", err)
 	}
+	return p.insertEntryAt(pos, data)
+}
 
-	p.Header.RecordCount--
-	if p.Header.RecordCount < p.Header.MaxRecordCount/2 {
-		return fmt.Errorf("节点记录太少")
+// 删除记录
+func (p *Page) DeleteRecord(key []byte) error {
+	pos, found := p.search(key)
+	if !found {
+		return ErrRecordNotFound
 	}
-	return nil
+	return p.removeEntryAt(pos)
+}
+
+// 页面已用空间是否少于四分之一，需要与兄弟节点合并或重新分配
+func (p *Page) IsUnderflow() bool {
+	return p.UsedSpace() < DataAreaSize/4
+}
+
+// 清空页面中的所有记录
+func (p *Page) ClearRecords() {
+	p.Data = [DataAreaSize]byte{}
+	p.Header.RecordCount = 0
+	p.Header.FreeSpaceStart = dataOffset
+	p.Header.FreeSpaceEnd = PageSize
 }
 
 // 获取所有记录
@@ -447,25 +401,20 @@ func (p *Page) GetRecordAt(index uint32) (*Record.Record, error) {
 	if index >= p.Header.RecordCount {
 		return nil, fmt.Errorf("索引越界")
 	}
-
-	var key [32]byte
-	copy(key[:], p.Key[index*32:(index+1)*32])
-
-	var value [128]byte
-	copy(value[:], p.Value[index*p.Header.RecordSize:(index+1)*p.Header.RecordSize])
-
-	return Record.NewRecord(Record.RecordHeader{}, key, value), nil
+	record := &Record.Record{}
+	if err := record.DeserializeFrom(p.entryAt(int(index))); err != nil {
+		return nil, fmt.Errorf("解析记录失败: %v", err)
+	}
+	return record, nil
 }
 
-func (p *Page) FindRecord(key [32]byte) (*Record.Record, error) {
+func (p *Page) FindRecord(key []byte) (*Record.Record, error) {
 	// 在叶子节点中查找记录
-	for i := uint32(0); i < p.Header.RecordCount; i++ {
-		currentKey := p.Key[i*32 : (i+1)*32]
-		if bytes.Compare(key[:], currentKey[:]) == 0 {
-			return p.GetRecordAt(i)
-		}
+	pos, found := p.search(key)
+	if !found {
+		return nil, ErrRecordNotFound
 	}
-	return nil, fmt.Errorf("记录不存在")
+	return p.GetRecordAt(uint32(pos))
 }
 
 // 获取最大键值
@@ -473,7 +422,7 @@ func (p *Page) GetMaxKey() []byte {
 	if p.Header.RecordCount == 0 {
 		return nil
 	}
-	return p.Key[(p.Header.RecordCount-1)*32 : p.Header.RecordCount*32]
+	return p.KeyAt(int(p.Header.RecordCount - 1))
 }
 
 // 获取最小键值
@@ -481,124 +430,26 @@ func (p *Page) GetMinKey() []byte {
 	if p.Header.RecordCount == 0 {
 		return nil
 	}
-	return p.Key[0:32]
-}
-
-// 移除最后一条记录
-func (p *Page) RemoveLastRecord() (*Record.Record, error) {
-	if p.Header.RecordCount == 0 {
-		return nil, fmt.Errorf("页面为空")
-	}
-
-	record, err := p.GetRecordAt(p.Header.RecordCount - 1)
-	if err != nil {
-		return nil, err
-	}
-
-	p.Header.RecordCount--
-	return record, nil
-}
-
-// 移除第一条记录
-func (p *Page) RemoveFirstRecord() (*Record.Record, error) {
-	if p.Header.RecordCount == 0 {
-		return nil, fmt.Errorf("页面为空")
-	}
-
-	record, err := p.GetRecordAt(0)
-	if err != nil {
-		return nil, err
-	}
-
-	// 移动其他记录
-	for i := uint32(0); i < p.Header.RecordCount-1; i++ {
-		copy(p.Key[i*32:(i+1)*32], p.Key[(i+1)*32:(i+2)*32])
-		copy(p.Value[i*p.Header.RecordSize:(i+1)*p.Header.RecordSize],
-			p.Value[(i+1)*p.Header.RecordSize:(i+2)*p.Header.RecordSize])
-	}
-
-	p.Header.RecordCount--
-	return record, nil
-}
-
-// 移除最后一条内部记录
-func (p *Page) RemoveLastInternalRecord() (*Record.InternalRecord, error) {
-	if p.Header.RecordCount == 0 {
-		return nil, fmt.Errorf("页面为空")
-	}
-
-	record := p.GetInternalRecord(int(p.Header.RecordCount - 1))
-	p.Header.RecordCount--
-	return record, nil
-}
-
-// 移除第一条内部记录
-func (p *Page) RemoveFirstInternalRecord() (*Record.InternalRecord, error) {
-	if p.Header.RecordCount == 0 {
-		return nil, fmt.Errorf("页面为空")
-	}
-
-	record := p.GetInternalRecord(0)
-
-	// 移动其他记录
-	for i := 0; i < int(p.Header.RecordCount-1); i++ {
-		copy(p.Key[i*32:(i+1)*32], p.Key[(i+1)*32:(i+2)*32])
-		copy(p.Value[i*int(Record.InternalRecordSize):(i+1)*int(Record.InternalRecordSize)],
-			p.Value[(i+1)*int(Record.InternalRecordSize):(i+2)*int(Record.InternalRecordSize)])
-	}
-
-	p.Header.RecordCount--
-	return record, nil
-}
-
-// 获取第一条内部记录
-func (p *Page) GetFirstInternalRecord() *Record.InternalRecord {
-	if p.Header.RecordCount == 0 {
-		return nil
-	}
-	return p.GetInternalRecord(0)
-}
-
-// 范围查询
-func (p *Page) RangeQuery(startKey, endKey [32]byte) ([]*Record.Record, error) {
-	var results []*Record.Record
-
-	for i := uint32(0); i < p.Header.RecordCount; i++ {
-		currentKey := p.Key[i*32 : (i+1)*32]
-		if bytes.Compare(currentKey, startKey[:]) >= 0 && bytes.Compare(currentKey, endKey[:]) <= 0 {
-			record, err := p.GetRecordAt(i)
-			if err != nil {
-				return nil, err
-			}
-			results = append(results, record)
-		}
-	}
-
-	return results, nil
+	return p.KeyAt(0)
 }
 
 // 更新记录
 func (p *Page) UpdateRecord(record *Record.Record) (error, *Record.Record) {
-	// 找到记录
-	for i := uint32(0); i < p.Header.RecordCount; i++ {
-		currentKey := p.Key[i*32 : (i+1)*32]
-		if bytes.Compare(record.Key[:], currentKey[:]) == 0 {
-			oldRecord, err := p.GetRecordAt(i)
-			if err != nil {
-				return err, nil
-			}
-			return p.UpdateRecordAt(i, record), oldRecord
-		}
+	pos, found := p.search(record.GetKey())
+	if !found {
+		return ErrRecordNotFound, nil
+	}
+	oldRecord, err := p.GetRecordAt(uint32(pos))
+	if err != nil {
+		return err, nil
 	}
-	return fmt.Errorf("记录不存在"), nil
+	return p.UpdateRecordAt(uint32(pos), record), oldRecord
 }
 
 func (p *Page) UpdateRecordAt(index uint32, record *Record.Record) error {
-	if index >= p.Header.RecordCount {
-		return fmt.Errorf("索引越界")
+	data, err := record.SerializeTo()
+	if err != nil {
+		return fmt.Errorf("序列化记录失败: %v", err)
 	}
-
-	p.WriteKey(uint32(index*32), record.Key[:])
-	p.WriteValue(uint32(index*p.Header.RecordSize), record.Value[:])
-	return nil
+	return p.replaceEntryAt(int(index), data)
 }
@@ -8,13 +8,15 @@ import (
 
 // size 128B
 type PageBPlusTree struct {
-	Header      PageHeader // 64Byte
-	RootPageID  uint32
-	FirstPageID uint32
-	LastPageID  uint32
-	PageCount   uint32
-	TreeHeight  uint32
-	Reserved    [4012]byte
+	Header            PageHeader // 64Byte
+	RootPageID        uint32
+	FirstPageID       uint32
+	LastPageID        uint32
+	PageCount         uint32
+	TreeHeight        uint32
+	NextTransactionID uint32 // 下一个要分配的事务ID，0表示还没有分配过
+	FillFactor        uint32 // 页面的目标填充百分比，0表示使用默认值
+	Reserved          [4004]byte
 }
 
 type InternalPage struct {
@@ -41,6 +43,7 @@ func (p *PageBPlusTree) SerializeTo() ([]byte, error) {
 	if err := binary.Write(buf, binary.LittleEndian, p); err != nil {
 		return nil, fmt.Errorf("序列化失败: %v", err)
 	}
+	setChecksum(buffer)
 	return buffer, nil
 }
 
@@ -48,7 +51,8 @@ func (p *PageBPlusTree) DeserializeFrom(data []byte) error {
 	if len(data) != int(PageSize) {
 		return fmt.Errorf("数据大小错误: 期望 %d 字节, 实际 %d 字节", PageSize, len(data))
 	}
-	return p.Header.DeserializeFrom(data[:PageHeaderSize])
+	// 反序列化整个元数据页，否则重新打开文件后根页面等信息会丢失
+	return binary.Read(bytes.NewReader(data), binary.LittleEndian, p)
 }
 
 func (p *PageBPlusTree) GetRootPageID() uint32 {
@@ -71,7 +75,15 @@ func (p *PageBPlusTree) GetPageCount() uint32 {
 	return p.PageCount
 }
 
-func (p *PageBPlusTree) GetReserved() [4012]byte {
+func (p *PageBPlusTree) GetNextTransactionID() uint32 {
+	return p.NextTransactionID
+}
+
+func (p *PageBPlusTree) GetFillFactor() uint32 {
+	return p.FillFactor
+}
+
+func (p *PageBPlusTree) GetReserved() [4004]byte {
 	return p.Reserved
 }
 
@@ -94,3 +106,11 @@ func (p *PageBPlusTree) SetTreeHeight(treeHeight uint32) {
 func (p *PageBPlusTree) SetPageCount(pageCount uint32) {
 	p.PageCount = pageCount
 }
+
+func (p *PageBPlusTree) SetNextTransactionID(nextTransactionID uint32) {
+	p.NextTransactionID = nextTransactionID
+}
+
+func (p *PageBPlusTree) SetFillFactor(fillFactor uint32) {
+	p.FillFactor = fillFactor
+}
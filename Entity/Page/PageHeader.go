@@ -15,14 +15,13 @@ type PageHeader struct {
 	PrevPageID uint32 // 上一页ID
 	NextPageID uint32 // 下一页ID
 
-	LSN uint32 // 日志序列号
+	LSN uint64 // 日志序列号
 
 	FreeSpaceStart uint32  // 空闲空间起始位置
 	FreeSpaceEnd   uint32  // 空闲空间结束位置
 	RecordCount    uint32  // 记录数
 	CheckSum       uint32  // 校验和
-	RecordSize     uint32  // 记录的占用大小
-	MaxRecordCount uint32  // 最大记录数
+	Reserved2      [4]byte // 保留字段2，页面容量按字节计算，不记录最大记录数
 	IsDirty        uint8   // 是否脏页
 	IsDeleted      uint8   // 是否删除
 	Reserved1      [2]byte // 保留字段1
@@ -38,6 +37,7 @@ const (
 	MetaPageID     = 0
 	InternalPageID = 1
 	LeafPageID     = 2
+	OverflowPageID = 3
 )
 
 func init() {
@@ -48,13 +48,12 @@ func NewPageHeader() *PageHeader {
 	//fmt.Printf("PageHeader 大小: %d 字节\n", PageHeaderSize)
 	CreateTime := time.Now().Unix()
 	ModifyTime := CreateTime
-	MaxRecordCount := 16
 	return &PageHeader{
 		CreateTime:     uint32(CreateTime),
 		ModifyTime:     uint32(ModifyTime),
 		IsDeleted:      0,
-		MaxRecordCount: uint32(MaxRecordCount),
-		RecordSize:     uint32(192),
+		FreeSpaceStart: uint32(PageHeaderSize),
+		FreeSpaceEnd:   PageSize,
 	}
 }
 
@@ -76,3 +75,17 @@ func (ph *PageHeader) DeserializeFrom(data []byte) error {
 	// 直接反序列化整个结构体
 	return binary.Read(bytes.NewReader(data), binary.LittleEndian, ph)
 }
+
+// 设置脏页标记
+func (ph *PageHeader) SetDirty(dirty bool) {
+	if dirty {
+		ph.IsDirty = 1
+	} else {
+		ph.IsDirty = 0
+	}
+}
+
+// 是否为脏页
+func (ph *PageHeader) IsDirtyPage() bool {
+	return ph.IsDirty == 1
+}
@@ -24,6 +24,11 @@ func TestPageHeader_Serialization(t *testing.T) {
 		t.Fatalf("序列化失败: %v", err)
 	}
 
+	// 页头在磁盘上固定占64字节，数据区紧跟在后面
+	if len(data) != 64 || PageHeaderSize != 64 {
+		t.Errorf("页头大小不正确: 序列化 %d 字节, 结构体 %d 字节", len(data), PageHeaderSize)
+	}
+
 	// 验证数据不全为0
 	allZero := true
 	for _, b := range data {
@@ -0,0 +1,29 @@
+package Page
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"unsafe"
+)
+
+// 校验和字段在页面中的位置，计算校验和时这4个字节按0处理
+const checkSumOffset = unsafe.Offsetof(PageHeader{}.CheckSum)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// 计算序列化后页面的CRC32C校验和，普通页面和元数据页通用
+func Checksum(data []byte) uint32 {
+	crc := crc32.Update(0, crc32cTable, data[:checkSumOffset])
+	crc = crc32.Update(crc, crc32cTable, make([]byte, 4))
+	return crc32.Update(crc, crc32cTable, data[checkSumOffset+4:])
+}
+
+// 序列化后的页面中保存的校验和
+func StoredChecksum(data []byte) uint32 {
+	return binary.LittleEndian.Uint32(data[checkSumOffset:])
+}
+
+// 把校验和写入序列化后的页面
+func setChecksum(data []byte) {
+	binary.LittleEndian.PutUint32(data[checkSumOffset:], Checksum(data))
+}
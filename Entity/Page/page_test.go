@@ -2,6 +2,8 @@ package Page
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"testing"
 	"wudb/Entity/Record"
 )
@@ -11,8 +13,8 @@ func TestPage_InsertAndFindRecord(t *testing.T) {
 	page.Header.PageType = LeafPageID
 
 	// 创建测试记录
-	testKey := [32]byte{1, 2, 3}
-	testValue := [128]byte{4, 5, 6}
+	testKey := []byte{1, 2, 3}
+	testValue := []byte{4, 5, 6}
 	record := Record.NewRecord(Record.RecordHeader{}, testKey, testValue)
 
 	// 测试插入
@@ -29,43 +31,191 @@ func TestPage_InsertAndFindRecord(t *testing.T) {
 	if found == nil {
 		t.Fatal("未找到插入的记录")
 	}
-	if !bytes.Equal(found.Key[:], testKey[:]) {
+	if !bytes.Equal(found.Key, testKey) {
 		t.Error("记录键不匹配")
 	}
-	if !bytes.Equal(found.Value[:], testValue[:]) {
+	if !bytes.Equal(found.Value, testValue) {
 		t.Error("记录值不匹配")
 	}
 }
 
-func TestPage_SplitRecords(t *testing.T) {
+func TestPage_VariableLengthKeys(t *testing.T) {
 	page := NewPage()
 	page.Header.PageType = LeafPageID
-	newPage := NewPage()
-	newPage.Header.PageType = LeafPageID
-
-	// 插入多条记录
-	for i := byte(0); i < 10; i++ {
-		key := [32]byte{i}
-		value := [128]byte{i}
-		record := Record.NewRecord(Record.RecordHeader{}, key, value)
+
+	// 键按实际长度比较："a" < "a\x00" < "ab" < "b"
+	keys := []string{"b", "a\x00", "ab", "a"}
+	for i, key := range keys {
+		value := bytes.Repeat([]byte{byte(i)}, 10*(i+1))
+		if err := page.InsertRecord(Record.NewRecord(Record.RecordHeader{}, []byte(key), value)); err != nil {
+			t.Fatalf("插入记录 %q 失败: %v", key, err)
+		}
+	}
+	expected := []string{"a", "a\x00", "ab", "b"}
+	for i, key := range expected {
+		if string(page.KeyAt(i)) != key {
+			t.Errorf("第 %d 个键不正确: 期望 %q, 实际 %q", i, key, page.KeyAt(i))
+		}
+	}
+	found, err := page.FindRecord([]byte("ab"))
+	if err != nil {
+		t.Fatalf("查找记录失败: %v", err)
+	}
+	if len(found.Value) != 30 {
+		t.Errorf("值长度不正确: 期望 30, 实际 %d", len(found.Value))
+	}
+	if _, err := page.FindRecord([]byte("a\x00\x00")); err == nil {
+		t.Error("补零后的键不应该匹配")
+	}
+
+	// ["a\x00", "ab"] 之间的记录
+	if start, end := page.LowerBound([]byte("a\x00")), page.UpperBound([]byte("ab")); end-start != 2 {
+		t.Errorf("范围内的记录数量不正确: 期望 2, 实际 %d", end-start)
+	}
+
+	// 第一个大于给定键的位置
+	for key, pos := range map[string]int{"": 0, "a": 1, "a\x00\x00": 2, "ab": 3, "b": 4, "c": 4} {
+		if got := page.UpperBound([]byte(key)); got != pos {
+			t.Errorf("键 %q 的上界不正确: 期望 %d, 实际 %d", key, pos, got)
+		}
+	}
+}
+
+func TestPage_UpdateAndCompact(t *testing.T) {
+	page := NewPage()
+	page.Header.PageType = LeafPageID
+
+	// 写满数据区后删除一部分，整理后应该能继续插入
+	value := make([]byte, 400)
+	count := 0
+	for ; ; count++ {
+		record := Record.NewRecord(Record.RecordHeader{}, []byte(fmt.Sprintf("key%02d", count)), value)
 		if err := page.InsertRecord(record); err != nil {
-			t.Fatalf("插入记录失败: %v", err)
+			break
+		}
+	}
+	if expected := DataAreaSize / (Record.RecordHeaderSize + 5 + 400 + SlotEntrySize); count != expected {
+		t.Fatalf("页面容量不正确: 期望 %d 条, 实际 %d 条", expected, count)
+	}
+	for i := 0; i < count; i += 2 {
+		if err := page.DeleteRecord([]byte(fmt.Sprintf("key%02d", i))); err != nil {
+			t.Fatalf("删除记录失败: %v", err)
+		}
+	}
+	if err := page.InsertRecord(Record.NewRecord(Record.RecordHeader{}, []byte("key99"), value)); err != nil {
+		t.Fatalf("删除后插入记录失败: %v", err)
+	}
+
+	// 更新为更长的值
+	longer := Record.NewRecord(Record.RecordHeader{}, []byte("key01"), make([]byte, 600))
+	if err, old := page.UpdateRecord(longer); err != nil || len(old.Value) != 400 {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+	found, err := page.FindRecord([]byte("key01"))
+	if err != nil || len(found.Value) != 600 {
+		t.Errorf("更新后的值不正确")
+	}
+}
+
+func TestPage_SlottedLayout(t *testing.T) {
+	page := NewPage()
+	page.Header.PageType = LeafPageID
+
+	// 容量按字节计算，小记录可以放很多条
+	count := 0
+	for ; ; count++ {
+		key := []byte{byte(count >> 8), byte(count)}
+		if err := page.InsertRecord(Record.NewRecord(Record.RecordHeader{}, key, nil)); err != nil {
+			if !errors.Is(err, ErrPageFull) {
+				t.Fatalf("页面放不下时应该返回ErrPageFull: %v", err)
+			}
+			break
 		}
 	}
+	if err := page.InsertRecord(Record.NewRecord(Record.RecordHeader{}, []byte{0, 0}, nil)); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("重复的键应该返回ErrKeyExists: %v", err)
+	}
+	if err := page.DeleteRecord([]byte{0xFF, 0xFF}); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("删除不存在的键应该返回ErrRecordNotFound: %v", err)
+	}
+	recordSize := Record.RecordHeaderSize + 2 + SlotEntrySize
+	if count != DataAreaSize/recordSize {
+		t.Fatalf("页面容量不正确: 期望 %d 条, 实际 %d 条", DataAreaSize/recordSize, count)
+	}
+	if page.Header.FreeSpaceEnd-page.Header.FreeSpaceStart >= uint32(recordSize) {
+		t.Error("页面已满时空闲空间应该放不下一条记录")
+	}
+	if page.Header.FreeSpaceEnd != PageSize-uint32(count*SlotEntrySize) {
+		t.Errorf("槽数组位置不正确: %d", page.Header.FreeSpaceEnd)
+	}
 
-	// 测试分裂
-	middleKey, err := page.SplitRecords(newPage)
+	// 删除后空间要等整理时才回收
+	for i := 0; i < count; i += 3 {
+		if err := page.DeleteRecord([]byte{byte(i >> 8), byte(i)}); err != nil {
+			t.Fatalf("删除记录失败: %v", err)
+		}
+	}
+	freeBefore := page.Header.FreeSpaceEnd - page.Header.FreeSpaceStart
+	page.Compact()
+	if page.Header.FreeSpaceEnd-page.Header.FreeSpaceStart != page.FreeSpace() || page.FreeSpace() <= freeBefore {
+		t.Errorf("整理后空闲空间不正确: 整理前 %d, 整理后 %d", freeBefore, page.FreeSpace())
+	}
+
+	// 序列化后重新读取，记录和顺序保持不变
+	data, err := page.SerializeTo()
 	if err != nil {
-		t.Fatalf("分裂记录失败: %v", err)
+		t.Fatalf("序列化页面失败: %v", err)
+	}
+	loaded := &Page{}
+	if err := loaded.DeserializeFrom(data); err != nil {
+		t.Fatalf("反序列化页面失败: %v", err)
+	}
+	if loaded.Header.RecordCount != page.Header.RecordCount {
+		t.Fatalf("记录数不一致: 期望 %d, 实际 %d", page.Header.RecordCount, loaded.Header.RecordCount)
 	}
+	for i := 0; i < count; i++ {
+		_, err := loaded.FindRecord([]byte{byte(i >> 8), byte(i)})
+		if i%3 == 0 && err == nil {
+			t.Errorf("记录 %d 应该已被删除", i)
+		}
+		if i%3 != 0 && err != nil {
+			t.Errorf("查找记录 %d 失败: %v", i, err)
+		}
+	}
+	for i := 1; i < int(loaded.Header.RecordCount); i++ {
+		if bytes.Compare(loaded.KeyAt(i-1), loaded.KeyAt(i)) >= 0 {
+			t.Fatal("槽数组没有按键排序")
+		}
+	}
+}
 
-	// 验证分裂结果
-	if page.Header.RecordCount != 5 || newPage.Header.RecordCount != 5 {
-		t.Error("分裂后记录数不正确")
+// 测试序列化时写入校验和，任何一个字节被改动都能发现
+func TestPage_Checksum(t *testing.T) {
+	page := NewPage()
+	page.Header.PageID = 7
+	page.Header.PageType = LeafPageID
+	if err := page.InsertRecord(Record.NewRecord(Record.RecordHeader{}, []byte("key"), []byte("value"))); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	data, err := page.SerializeTo()
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	if StoredChecksum(data) != Checksum(data) {
+		t.Fatal("序列化后的校验和不正确")
+	}
+	data[PageSize-1] ^= 0xFF
+	if StoredChecksum(data) == Checksum(data) {
+		t.Error("页面内容改动后校验和应该不一致")
 	}
 
-	// 验证中间键
-	if middleKey[0] != 5 {
-		t.Error("中间键不正确")
+	meta := NewPageBPlusTree()
+	meta.RootPageID = 3
+	data, err = meta.SerializeTo()
+	if err != nil {
+		t.Fatalf("序列化元数据页失败: %v", err)
+	}
+	if StoredChecksum(data) != Checksum(data) {
+		t.Error("元数据页的校验和不正确")
 	}
 }
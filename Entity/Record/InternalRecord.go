@@ -3,25 +3,26 @@ package Record
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 )
 
+// 序列化格式：记录头(32B) + 键 + 前驱指针 + 后继指针
 type InternalRecord struct {
 	Header       RecordHeader
-	Key          [32]byte
+	Key          []byte
 	FrontPointer uint32 // 前驱指针 4
 	NextPointer  uint32 // 后继指针 4
-	Reserved     [120]byte
 }
 
 const (
-	InternalRecordSize = 192
+	PointerSize = 8 // 前驱指针和后继指针的大小
 )
 
-func NewInternalRecord(header RecordHeader, key [32]byte, frontPointer uint32, nextPointer uint32) *InternalRecord {
-	return &InternalRecord{Header: header, Key: key, FrontPointer: frontPointer, NextPointer: nextPointer}
+func NewInternalRecord(header RecordHeader, key []byte, frontPointer uint32, nextPointer uint32) *InternalRecord {
+	return &InternalRecord{Header: header, Key: append([]byte(nil), key...), FrontPointer: frontPointer, NextPointer: nextPointer}
 }
 
-func (ir *InternalRecord) GetKey() [32]byte {
+func (ir *InternalRecord) GetKey() []byte {
 	return ir.Key
 }
 
@@ -41,8 +42,8 @@ func (ir *InternalRecord) SetHeader(header RecordHeader) {
 	ir.Header = header
 }
 
-func (ir *InternalRecord) SetKey(key [32]byte) {
-	ir.Key = key
+func (ir *InternalRecord) SetKey(key []byte) {
+	ir.Key = append([]byte(nil), key...)
 }
 
 func (ir *InternalRecord) SetFrontPointer(frontPointer uint32) {
@@ -53,14 +54,37 @@ func (ir *InternalRecord) SetNextPointer(nextPointer uint32) {
 	ir.NextPointer = nextPointer
 }
 
+func (ir *InternalRecord) GetRecordSize() uint32 {
+	return uint32(RecordHeaderSize + len(ir.Key) + PointerSize)
+}
+
 func (ir *InternalRecord) SerializeTo() ([]byte, error) {
-	buffer := make([]byte, InternalRecordSize)
-	buf := bytes.NewBuffer(buffer[:0])
-	binary.Write(buf, binary.LittleEndian, ir)
-	return buffer, nil
+	ir.Header.KeySize = uint32(len(ir.Key))
+	ir.Header.ValueSize = PointerSize
+	ir.Header.RecordLength = ir.GetRecordSize()
+	buffer := bytes.NewBuffer(make([]byte, 0, ir.Header.RecordLength))
+	if err := binary.Write(buffer, binary.LittleEndian, ir.Header); err != nil {
+		return nil, err
+	}
+	buffer.Write(ir.Key)
+	binary.Write(buffer, binary.LittleEndian, ir.FrontPointer)
+	binary.Write(buffer, binary.LittleEndian, ir.NextPointer)
+	return buffer.Bytes(), nil
 }
 
 func (ir *InternalRecord) DeserializeFrom(data []byte) error {
-	buf := bytes.NewBuffer(data)
-	return binary.Read(buf, binary.LittleEndian, ir)
+	if len(data) < RecordHeaderSize {
+		return fmt.Errorf("数据长度不足: %d", len(data))
+	}
+	if err := binary.Read(bytes.NewReader(data[:RecordHeaderSize]), binary.LittleEndian, &ir.Header); err != nil {
+		return err
+	}
+	keyEnd := RecordHeaderSize + int(ir.Header.KeySize)
+	if keyEnd+PointerSize > len(data) {
+		return fmt.Errorf("数据长度不足: 期望 %d 字节, 实际 %d 字节", keyEnd+PointerSize, len(data))
+	}
+	ir.Key = append([]byte(nil), data[RecordHeaderSize:keyEnd]...)
+	ir.FrontPointer = binary.LittleEndian.Uint32(data[keyEnd:])
+	ir.NextPointer = binary.LittleEndian.Uint32(data[keyEnd+4:])
+	return nil
 }
@@ -3,69 +3,120 @@ package Record
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"time"
 )
 
+// 键和值都是变长的，序列化格式：记录头(32B) + 键 + 值
 type Record struct {
 	Header RecordHeader
-	Key    [32]byte
-	Value  [128]byte
+	Key    []byte
+	Value  []byte
 }
 
 const (
-	ValueSize = 128
-	KeySize   = 32
+	RecordHeaderSize = 32
+	MaxKeySize       = 64 // 键的最大长度
+
+	OverflowPointerSize = 8 // 溢出指针的大小
 )
 
-func NewRecord(header RecordHeader, key [32]byte, value [128]byte) *Record {
-	header.RecordLength = uint32(192)
-	return &Record{Header: header, Key: key, Value: value}
+func NewRecord(header RecordHeader, key []byte, value []byte) *Record {
+	r := &Record{Header: header}
+	r.SetKey(key)
+	r.SetValue(value)
+	return r
 }
 
-func NewRecordByTransaction(transactionID uint32, key [32]byte, value [128]byte) *Record {
-	return &Record{
-		Header: RecordHeader{
-			TransactionID: transactionID,
-			IsDeleted:     0,
-			RecordLength:  uint32(len(key) + len(value) + 32),
-			KeySize:       uint32(len(key)),
-			ValueSize:     uint32(len(value)),
-			Timestamp:     uint32(time.Now().Unix()),
-		},
-		Key:   key,
-		Value: value,
-	}
+func NewRecordByTransaction(transactionID uint32, key []byte, value []byte) *Record {
+	return NewRecord(RecordHeader{
+		TransactionID: transactionID,
+		IsDeleted:     0,
+		Timestamp:     uint32(time.Now().Unix()),
+	}, key, value)
 }
 
-func (r *Record) GetKey() [32]byte {
+func (r *Record) GetKey() []byte {
 	return r.Key
 }
 
-func (r *Record) GetValue() [128]byte {
+func (r *Record) GetValue() []byte {
 	return r.Value
 }
 
-func (r *Record) SetValue(value [128]byte) {
-	r.Value = value
+func (r *Record) SetValue(value []byte) {
+	r.Value = append([]byte(nil), value...)
+	r.updateLength()
 }
 
-func (r *Record) SetKey(key [32]byte) {
-	r.Key = key
+func (r *Record) SetKey(key []byte) {
+	r.Key = append([]byte(nil), key...)
+	r.updateLength()
 }
 
 func (r *Record) GetRecordSize() uint32 {
 	return r.Header.RecordLength
 }
 
+// 根据键和值的实际长度更新记录头
+func (r *Record) updateLength() {
+	r.Header.KeySize = uint32(len(r.Key))
+	r.Header.ValueSize = uint32(len(r.Value))
+	r.Header.RecordLength = uint32(RecordHeaderSize + len(r.Key) + len(r.Value))
+}
+
 func (r *Record) SerializeTo() ([]byte, error) {
-	buffer := bytes.NewBuffer(nil)
-	binary.Write(buffer, binary.LittleEndian, r.Header)
-	buffer.Write(r.Key[:])
-	buffer.Write(r.Value[:])
+	r.updateLength()
+	buffer := bytes.NewBuffer(make([]byte, 0, r.Header.RecordLength))
+	if err := binary.Write(buffer, binary.LittleEndian, r.Header); err != nil {
+		return nil, err
+	}
+	buffer.Write(r.Key)
+	buffer.Write(r.Value)
 	return buffer.Bytes(), nil
 }
 
 func (r *Record) DeserializeFrom(data []byte) error {
-	buffer := bytes.NewBuffer(data)
-	return binary.Read(buffer, binary.LittleEndian, r)
+	if len(data) < RecordHeaderSize {
+		return fmt.Errorf("数据长度不足: %d", len(data))
+	}
+	if err := binary.Read(bytes.NewReader(data[:RecordHeaderSize]), binary.LittleEndian, &r.Header); err != nil {
+		return err
+	}
+	keyEnd := RecordHeaderSize + int(r.Header.KeySize)
+	valueEnd := keyEnd + int(r.Header.ValueSize)
+	if valueEnd > len(data) {
+		return fmt.Errorf("数据长度不足: 期望 %d 字节, 实际 %d 字节", valueEnd, len(data))
+	}
+	r.Key = append([]byte(nil), data[RecordHeaderSize:keyEnd]...)
+	r.Value = append([]byte(nil), data[keyEnd:valueEnd]...)
+	return nil
+}
+
+// 值是否保存在溢出页中
+func (r *Record) IsOverflow() bool {
+	return r.Header.Flags&FlagOverflow != 0
+}
+
+// 把值替换为指向溢出页链表的指针：第一个溢出页ID(4B) + 值的总长度(4B)
+func (r *Record) SetOverflow(firstPageID uint32, valueLength uint32) {
+	pointer := make([]byte, OverflowPointerSize)
+	binary.LittleEndian.PutUint32(pointer[0:4], firstPageID)
+	binary.LittleEndian.PutUint32(pointer[4:8], valueLength)
+	r.SetValue(pointer)
+	r.Header.Flags |= FlagOverflow
+}
+
+// 获取溢出页链表的第一个页面ID和值的总长度
+func (r *Record) GetOverflow() (uint32, uint32) {
+	if !r.IsOverflow() || len(r.Value) < OverflowPointerSize {
+		return 0, 0
+	}
+	return binary.LittleEndian.Uint32(r.Value[0:4]), binary.LittleEndian.Uint32(r.Value[4:8])
+}
+
+// 从序列化后的记录（或内部记录）中直接取出键，不复制数据
+func ParseKey(data []byte) []byte {
+	keySize := binary.LittleEndian.Uint32(data[5:9])
+	return data[RecordHeaderSize : RecordHeaderSize+keySize]
 }
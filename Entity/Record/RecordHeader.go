@@ -10,15 +10,20 @@ type RecordHeader struct {
 	ValueSize     uint32
 	TransactionID uint32
 	Timestamp     uint32
-	Reserved      [11]byte
+	Flags         uint8 // 记录标志，例如值是否保存在溢出页中
+	Reserved      [10]byte
 }
 
+const (
+	FlagOverflow uint8 = 1 << 0 // 值保存在溢出页链表中，记录里只有指针
+)
+
 func NewRecordHeader() *RecordHeader {
 	return &RecordHeader{
 		IsDeleted:     0,
-		RecordLength:  192,
-		KeySize:       32,
-		ValueSize:     128,
+		RecordLength:  RecordHeaderSize, // 键和值的长度在序列化时填写
+		KeySize:       0,
+		ValueSize:     0,
 		TransactionID: 0,
 		Timestamp:     uint32(time.Now().Unix()),
 	}
@@ -49,7 +54,11 @@ func (rh *RecordHeader) GetTimestamp() uint32 {
 	return rh.Timestamp
 }
 
-func (rh *RecordHeader) GetReserved() [11]byte {
+func (rh *RecordHeader) GetFlags() uint8 {
+	return rh.Flags
+}
+
+func (rh *RecordHeader) GetReserved() [10]byte {
 	return rh.Reserved
 }
 
@@ -77,3 +86,7 @@ func (rh *RecordHeader) SetTransactionID(id uint32) {
 func (rh *RecordHeader) SetTimestamp(timestamp uint32) {
 	rh.Timestamp = timestamp
 }
+
+func (rh *RecordHeader) SetFlags(flags uint8) {
+	rh.Flags = flags
+}
@@ -7,13 +7,10 @@ import (
 
 func TestRecord_SerializeAndDeserialize(t *testing.T) {
 	// 创建测试记录
-	key := [32]byte{1, 2, 3}
-	value := [128]byte{4, 5, 6}
+	key := []byte{1, 2, 3}
+	value := []byte{4, 5, 6}
 	record := NewRecord(RecordHeader{
 		IsDeleted:     0,
-		RecordLength:  160, // 32 + 128
-		KeySize:       32,
-		ValueSize:     128,
 		TransactionID: 1,
 	}, key, value)
 
@@ -30,25 +27,57 @@ func TestRecord_SerializeAndDeserialize(t *testing.T) {
 	}
 
 	// 验证结果
-	if !bytes.Equal(newRecord.Key[:], key[:]) {
+	if !bytes.Equal(newRecord.Key, key) {
 		t.Error("键不匹配")
 	}
-	if !bytes.Equal(newRecord.Value[:], value[:]) {
+	if !bytes.Equal(newRecord.Value, value) {
 		t.Error("值不匹配")
 	}
-	if newRecord.Header.RecordLength != 160 {
+	if newRecord.Header.RecordLength != RecordHeaderSize+3+3 {
 		t.Error("记录长度不正确")
 	}
+	if !bytes.Equal(ParseKey(data), key) {
+		t.Error("从序列化数据中读取的键不匹配")
+	}
+}
+
+func TestRecord_VariableLength(t *testing.T) {
+	// 键和值使用实际长度，不补零
+	for _, tc := range []struct {
+		key   string
+		value string
+	}{
+		{"a", ""},
+		{"a\x00", "x"},
+		{"user:1001", string(bytes.Repeat([]byte("v"), 700))},
+	} {
+		record := NewRecordByTransaction(1, []byte(tc.key), []byte(tc.value))
+		data, err := record.SerializeTo()
+		if err != nil {
+			t.Fatalf("序列化失败: %v", err)
+		}
+		if len(data) != RecordHeaderSize+len(tc.key)+len(tc.value) {
+			t.Errorf("序列化长度不正确: %d", len(data))
+		}
+		newRecord := &Record{}
+		if err := newRecord.DeserializeFrom(data); err != nil {
+			t.Fatalf("反序列化失败: %v", err)
+		}
+		if string(newRecord.Key) != tc.key || string(newRecord.Value) != tc.value {
+			t.Errorf("记录不匹配: %q", tc.key)
+		}
+	}
+
+	if err := (&Record{}).DeserializeFrom([]byte{1, 2, 3}); err == nil {
+		t.Error("数据不完整时应该返回错误")
+	}
 }
 
 func TestInternalRecord_SerializeAndDeserialize(t *testing.T) {
 	// 创建测试内部记录
-	key := [32]byte{1, 2, 3}
+	key := []byte{1, 2, 3}
 	record := NewInternalRecord(RecordHeader{
 		IsDeleted:     0,
-		RecordLength:  192, // 32 + 128 + 32
-		KeySize:       32,
-		ValueSize:     128,
 		TransactionID: 1,
 	}, key, 1, 2)
 
@@ -57,6 +86,9 @@ func TestInternalRecord_SerializeAndDeserialize(t *testing.T) {
 	if err != nil {
 		t.Fatalf("序列化失败: %v", err)
 	}
+	if uint32(len(data)) != record.GetRecordSize() {
+		t.Error("内部记录长度不正确")
+	}
 
 	// 测试反序列化
 	newRecord := &InternalRecord{}
@@ -65,7 +97,7 @@ func TestInternalRecord_SerializeAndDeserialize(t *testing.T) {
 	}
 
 	// 验证结果
-	if !bytes.Equal(newRecord.Key[:], key[:]) {
+	if !bytes.Equal(newRecord.Key, key) {
 		t.Error("键不匹配")
 	}
 	if newRecord.FrontPointer != 1 {
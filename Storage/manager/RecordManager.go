@@ -2,19 +2,25 @@ package manager
 
 import (
 	"bytes"
-	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"sync"
 	"wudb/Entity/Page"
 	"wudb/Entity/Record"
+	"wudb/Storage/replacer"
 	"wudb/Transaction"
 	"wudb/Util"
 )
 
 const (
-	ErrPageFull  = Error("页面已满")
+	ErrPageFull  = Page.ErrPageFull
 	ErrPageSplit = Error("页面需要分裂")
 	ErrNotFound  = Error("记录不存在")
 	ErrUnderflow = Error("节点记录太少")
+
+	ErrKeyTooLarge = Error("键长度超出限制")
 )
 
 type Error string
@@ -26,93 +32,230 @@ func (e Error) Error() string {
 type RecordManager struct {
 	fileHandle         *Util.FileHandle
 	pageManager        *PageManager
+	bufferPool         *BufferPoolManager
 	transactionManager *Transaction.TransactionManager
+	overflowThreshold  int // 值超过这个长度时写入溢出页
+	archiveLog         bool
+	mvcc               bool          // 读操作使用快照，不加共享锁
+	versions           *versionStore // 多版本模式下被覆盖的旧版本
+	serializable       *ssiTracker   // 多版本模式下可串行化事务之间的读写依赖
+	// 写操作和回滚持有读锁并发执行；检查点、批量加载和关闭持有写锁，在两个操作之间执行。
+	// 读操作不持有它，只加页面的闩
+	opLatch sync.RWMutex
+	// 分配和释放页面、修改元数据页的操作串行执行，在加页面的闩之前获取
+	structureLatch sync.Mutex
+	rootLatch      sync.RWMutex // 保护元数据页中的根节点和树高
+	stopCheckpoint chan struct{}
+	checkpointDone sync.WaitGroup
+}
+
+// 按默认配置打开数据库，文件损坏或恢复失败时返回错误
+func NewRecordManager(fileHandle *Util.FileHandle) (*RecordManager, error) {
+	return NewRecordManagerWithConfig(fileHandle, DefaultConfig())
 }
 
-func NewRecordManager(fileHandle *Util.FileHandle) *RecordManager {
+// 按配置打开数据库，例如选择缓冲池大小和页面置换策略
+func NewRecordManagerWithConfig(fileHandle *Util.FileHandle, config *Config) (*RecordManager, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.OverflowThreshold <= 0 {
+		config.OverflowThreshold = DefaultOverflowThreshold
+	}
+	if config.OverflowThreshold > MaxOverflowThreshold {
+		return nil, fmt.Errorf("溢出阈值太大: %d, 最大 %d", config.OverflowThreshold, MaxOverflowThreshold)
+	}
+	if config.FillFactor != 0 {
+		if err := checkFillFactor(config.FillFactor); err != nil {
+			return nil, err
+		}
+	}
+	pageManager, err := OpenPageManager(fileHandle)
+	if err != nil {
+		return nil, err
+	}
+	bufferPool, err := NewBufferPoolManagerWithPolicy(pageManager, config.PoolSize, config.ReplacerPolicy)
+	if err != nil {
+		return nil, err
+	}
 	transactionManager := Transaction.NewTransactionManagerWithHandle(fileHandle)
-	return &RecordManager{
+	bufferPool.SetLogManager(transactionManager.GetLogManager())
+	rm := &RecordManager{
 		fileHandle:         fileHandle,
-		pageManager:        NewPageManager(fileHandle),
+		pageManager:        pageManager,
+		bufferPool:         bufferPool,
 		transactionManager: transactionManager,
+		overflowThreshold:  config.OverflowThreshold,
+		archiveLog:         config.ArchiveLog,
+		mvcc:               config.MVCC,
+		versions:           newVersionStore(),
+		serializable:       newSSITracker(),
+	}
+	transactionManager.SetRollbackTo(rm.RollbackTo)
+	transactionManager.SetCommitCheck(rm.checkCommit)
+	transactionManager.SetOnFinish(rm.finishTransaction)
+	if err := rm.recover(); err != nil {
+		return nil, fmt.Errorf("恢复数据库失败: %v", err)
+	}
+	if config.FillFactor != 0 {
+		if err := rm.SetFillFactor(config.FillFactor); err != nil {
+			return nil, err
+		}
+	}
+	if config.CheckpointInterval > 0 {
+		rm.startCheckpointer(config.CheckpointInterval)
+	}
+	return rm, nil
+}
+
+// 获取缓冲池的命中、未命中和淘汰计数
+func (rm *RecordManager) GetBufferPoolStats() replacer.Stats {
+	return rm.bufferPool.GetStats()
+}
+
+// 将缓冲池中的脏页全部写回磁盘
+func (rm *RecordManager) Flush() error {
+	rm.opLatch.Lock()
+	defer rm.opLatch.Unlock()
+	rm.structureLatch.Lock()
+	defer rm.structureLatch.Unlock()
+	return rm.bufferPool.FlushAll()
+}
+
+// 关闭前停止定期检查点并写回所有脏页，然后关闭日志文件
+func (rm *RecordManager) Close() error {
+	rm.stopCheckpointer()
+	if err := rm.Flush(); err != nil {
+		return err
 	}
+	return rm.transactionManager.Close()
 }
 
 // 插入记录
 func (rm *RecordManager) InsertRecord(record *Record.Record, tx *Transaction.Transaction) error {
-	operation := Transaction.Operation{
-		TransactionID: tx.TransactionID,
-		OperationType: Transaction.InsertOperation,
-		Record:        record,
-		OldRecord:     nil,
+	if err := checkKeySize(record.GetKey()); err != nil {
+		return err
+	}
+	if err := rm.lockExclusive(tx, record.GetKey()); err != nil {
+		return err
+	}
+	if err := rm.checkWriteConflict(tx, record.GetKey()); err != nil {
+		return err
 	}
-	rm.transactionManager.AddTransaction(tx)
-	rm.transactionManager.AddOperation(operation)
+	return rm.writeWithGapLock(tx, record.GetKey(), false, func() error {
+		if err := rm.transactionManager.AddTransaction(tx); err != nil {
+			return err
+		}
+		rm.stampRecord(record, tx)
+		if err := rm.saveVersion(record.GetKey(), tx); err != nil {
+			return err
+		}
+		op := rm.newOperation()
+		if err := rm.insertRecord(record, op); err != nil {
+			rm.discardVersion(record.GetKey(), tx)
+			op.commit(nil)
+			return err
+		}
+		rm.recordWrite(tx, record.GetKey())
+		logRecord := Transaction.NewLogRecord(tx.TransactionID, Transaction.LogInsert)
+		logRecord.Key = record.GetKey()
+		logRecord.After = recordImage(record)
+		_, err := op.commit(logRecord)
+		return err
+	})
+}
 
+// 把记录写入B+树，值太大时先写入溢出页
+func (rm *RecordManager) insertRecord(record *Record.Record, op *operation) error {
 	meta, err := rm.pageManager.GetMetaPage()
 	if err != nil {
 		return err
 	}
 
-	if meta.RootPageID == 0 {
-		if err := rm.initBPlusTree(); err != nil {
+	stored, err := rm.spillRecord(record, op)
+	if err != nil {
+		return err
+	}
+	rm.rootLatch.RLock()
+	empty := meta.RootPageID == 0
+	rm.rootLatch.RUnlock()
+	if empty {
+		op.lockStructure()
+		rm.rootLatch.Lock()
+		if meta.RootPageID == 0 {
+			err = rm.initBPlusTree(op)
+		}
+		rm.rootLatch.Unlock()
+		if err != nil {
+			rm.freeOverflow(stored, op)
 			return fmt.Errorf("初始化B+树失败: %v", err)
 		}
-		meta, _ = rm.pageManager.GetMetaPage()
 	}
 
-	err, _ = rm.insertRecordToTree(record, meta.RootPageID)
+	done, err := rm.insertOptimistic(stored, op)
+	if !done {
+		err = rm.insertPessimistic(stored, op)
+	}
 	if err != nil {
+		rm.freeOverflow(stored, op)
 		return err
 	}
 	return nil
 }
 
-// 初始化B+树
-func (rm *RecordManager) initBPlusTree() error {
+// 检查键的长度，值的长度不受限制，太大的值会写入溢出页
+func checkKeySize(key []byte) error {
+	if len(key) > Page.KeyMaxSize {
+		return ErrKeyTooLarge
+	}
+	return nil
+}
+
+// 初始化B+树，调用方持有结构闩
+func (rm *RecordManager) initBPlusTree(op *operation) error {
 	meta, err := rm.pageManager.GetMetaPage()
 	if err != nil {
 		return err
 	}
 
 	// 创建根节点
-	rootPage, err := rm.pageManager.CreatePage(Page.LeafPageID)
+	rootPage, err := op.newPage(Page.LeafPageID)
 	if err != nil {
 		return err
 	}
+	defer op.unpinPage(rootPage.Header.PageID, true)
 
 	rootPage.Header.PageType = Page.LeafPageID
 
 	// 更新元数据
 	meta.RootPageID = rootPage.Header.PageID
 	meta.FirstPageID = rootPage.Header.PageID
-	meta.LastPageID = rootPage.Header.PageID
 	meta.TreeHeight = 1
 
 	// 保存元数据更新
 	return rm.pageManager.WriteMetaPage()
 }
 
-// 递归插入记录
-func (rm *RecordManager) insertRecordToTree(record *Record.Record, pageID uint32) (error, *Record.InternalRecord) {
-	currentPage, err := rm.pageManager.GetPage(pageID)
+// 递归插入记录，调用方已经对路径加了写闩。
+// 下层分裂时返回上升的分隔键，appended表示分裂是在树的右边缘末尾追加，也就是顺序插入
+func (rm *RecordManager) insertRecordToTree(record *Record.Record, pageID uint32, op *operation) (error, *Record.InternalRecord, bool) {
+	currentPage, err := op.fetchPage(pageID)
 	if err != nil {
-		return err, nil
+		return err, nil, false
 	}
+	defer op.unpinPage(pageID, false)
 
 	// 如果是内部节点
 	if currentPage.Header.PageType == Page.InternalPageID {
 		// 找到下一层的页面ID
 		nextPageID := rm.findNextPage(currentPage, record.GetKey())
-		err, internalRecord := rm.insertRecordToTree(record, nextPageID)
+		err, internalRecord, appended := rm.insertRecordToTree(record, nextPageID, op)
 
 		// 如果下层分裂了，需要处理上升的键
-		if err != nil {
-			if err.Error() == "页面需要分裂" {
-				return rm.handleSplit(currentPage, internalRecord)
-			}
+		if err == ErrPageSplit {
+			return rm.handleSplit(currentPage, internalRecord, appended, op)
 		}
-		return err, internalRecord
+		return err, internalRecord, appended
 	}
 
 	// 如果是叶子节点
@@ -121,107 +264,98 @@ func (rm *RecordManager) insertRecordToTree(record *Record.Record, pageID uint32
 		err = currentPage.InsertRecord(record)
 		if err != nil {
 			// 如果节点已满，需要分裂
-			if err.Error() == "页面已满" {
-				internalRecord, err := rm.splitLeafPage(currentPage, record)
-				if err != nil {
-					return err, internalRecord
-				}
-				return nil, internalRecord
+			if errors.Is(err, ErrPageFull) {
+				return rm.splitLeafPage(currentPage, record, op)
 			}
-			return err, nil
+			return err, nil, false
 		}
 
 		// 更新页面
-		return rm.pageManager.UpdatePage(currentPage), nil
+		currentPage.Header.SetDirty(true)
+		return nil, nil, false
 	}
 
-	return fmt.Errorf("无效的页面类型"), nil
+	return fmt.Errorf("无效的页面类型"), nil, false
 }
 
-// 递归更新记录
-func (rm *RecordManager) updateRecordToTree(record *Record.Record, pageID uint32) (error, *Record.Record, uint32) {
-	currentPage, err := rm.pageManager.GetPage(pageID)
+// 分裂叶子节点：把原有记录和新记录一起按键排序后平分到两个页面
+func (rm *RecordManager) splitLeafPage(page *Page.Page, record *Record.Record, op *operation) (error, *Record.InternalRecord, bool) {
+	records, err := page.GetAllRecords()
 	if err != nil {
-		return err, nil, 0
-	}
-
-	// 如果是内部节点
-	if currentPage.Header.PageType == Page.InternalPageID {
-		// 找到下一层的页面ID
-		nextPageID := rm.findNextPage(currentPage, record.GetKey())
-		return rm.updateRecordToTree(record, nextPageID)
+		return err, nil, false
 	}
-
-	// 如果是叶子节点
-	if currentPage.Header.PageType == Page.LeafPageID {
-		// 尝试更新记录
-		err, oldRecord := currentPage.UpdateRecord(record)
-		if err != nil {
-			return err, nil, 0
-		}
-		// 更新页面
-		return rm.pageManager.UpdatePage(currentPage), oldRecord, currentPage.Header.PageID
+	pos := sort.Search(len(records), func(i int) bool {
+		return bytes.Compare(records[i].Key, record.Key) >= 0
+	})
+	if pos < len(records) && bytes.Equal(records[pos].Key, record.Key) {
+		return Page.ErrKeyExists, nil, false
 	}
+	records = append(records, nil)
+	copy(records[pos+1:], records[pos:])
+	records[pos] = record
 
-	return fmt.Errorf("无效的页面类型"), nil, 0
-}
-
-// 分裂叶子节点
-func (rm *RecordManager) splitLeafPage(page *Page.Page, record *Record.Record) (*Record.InternalRecord, error) {
 	// 创建新页面
-	newPage, err := rm.pageManager.CreatePage(Page.LeafPageID)
+	newPage, err := op.newPage(Page.LeafPageID)
 	if err != nil {
-		return nil, err
+		return err, nil, false
 	}
+	defer op.unpinPage(newPage.Header.PageID, true)
 	newPage.Header.PageType = Page.LeafPageID
 
-	// 分裂记录
-	middleKey, err := page.SplitRecords(newPage)
-	if err != nil {
-		return nil, err
+	// 按字节数平分，前一半留在原页面，后一半移到新页面。
+	// 在最右边的叶子末尾追加是顺序插入，原页面按填充因子保留记录，新页面留给之后追加的记录
+	sizes := recordSizes(records)
+	mid := splitIndex(sizes)
+	appended := pos == len(records)-1 && page.Header.NextPageID == 0
+	if appended {
+		mid = fillIndex(sizes, rm.fillLimit())
+	}
+	if err := fillLeafPage(page, records[:mid]); err != nil {
+		return err, nil, false
+	}
+	if err := fillLeafPage(newPage, records[mid:]); err != nil {
+		return err, nil, false
 	}
+	middleKey := records[mid].Key
 
 	// 更新链表指针
 	newPage.Header.NextPageID = page.Header.NextPageID
-	page.Header.NextPageID = newPage.Header.PageID
 	newPage.Header.PrevPageID = page.Header.PageID
-	// 根据中间键决定记录应该插入哪个页面
-	if bytes.Compare(record.Key[:], middleKey[:]) < 0 {
-		err = page.InsertRecord(record)
-	} else {
-		err = newPage.InsertRecord(record)
+	page.Header.NextPageID = newPage.Header.PageID
+	if newPage.Header.NextPageID != 0 {
+		nextPage, err := op.fetchPage(newPage.Header.NextPageID)
+		if err != nil {
+			return err, nil, false
+		}
+		nextPage.Header.PrevPageID = newPage.Header.PageID
+		op.unpinPage(nextPage.Header.PageID, true)
 	}
-	if err != nil {
-		return nil, err
+
+	// 保存更改
+	page.Header.SetDirty(true)
+	newPage.Header.SetDirty(true)
+
+	// 如果是根节点分裂，需要创建新的根节点
+	if page.Header.PageID == rm.pageManager.metaPage.RootPageID {
+		return rm.createNewRoot(page.Header.PageID, newPage.Header.PageID, middleKey, op), nil, false
 	}
+
 	internalRecord := Record.NewInternalRecord(
 		*Record.NewRecordHeader(),
 		middleKey,
 		page.Header.PageID,
 		newPage.Header.PageID,
 	)
-	// 保存更改
-	if err := rm.pageManager.UpdatePage(page); err != nil {
-		return nil, err
-	}
-	if err := rm.pageManager.UpdatePage(newPage); err != nil {
-		return nil, err
-	}
-
-	// 如果是根节点分裂，需要创建新的根节点
-	if page.Header.PageID == rm.pageManager.metaPage.RootPageID {
-		return nil, rm.createNewRoot(page.Header.PageID, newPage.Header.PageID, middleKey)
-	}
-
-	return internalRecord, fmt.Errorf("页面需要分裂")
+	return ErrPageSplit, internalRecord, appended
 }
 
 // 创建新的根节点
-func (rm *RecordManager) createNewRoot(leftPageID, rightPageID uint32, key [32]byte) error {
-	newRoot, err := rm.pageManager.CreatePage(Page.InternalPageID)
+func (rm *RecordManager) createNewRoot(leftPageID, rightPageID uint32, key []byte, op *operation) error {
+	newRoot, err := op.newPage(Page.InternalPageID)
 	if err != nil {
 		return err
 	}
+	defer op.unpinPage(newRoot.Header.PageID, true)
 
 	newRoot.Header.PageType = Page.InternalPageID
 
@@ -246,71 +380,90 @@ func (rm *RecordManager) createNewRoot(leftPageID, rightPageID uint32, key [32]b
 
 	meta.RootPageID = newRoot.Header.PageID
 	meta.TreeHeight++
-	if err := rm.pageManager.UpdatePage(newRoot); err != nil {
-		return err
-	}
+	newRoot.Header.SetDirty(true)
 	return rm.pageManager.WriteMetaPage()
 }
 
 // 在内部节点中查找下一个要访问的页面ID
-func (rm *RecordManager) findNextPage(page *Page.Page, key [32]byte) uint32 {
-	if page.Header.RecordCount == 0 {
-		return 0
-	}
-	internalRecord := page.FindInternalRecord(key)
-	if internalRecord == nil {
-		return 0
-	}
-	if bytes.Compare(internalRecord.Key[:], key[:]) <= 0 {
-		return internalRecord.GetNextPointer()
-	}
-	return internalRecord.GetFrontPointer()
+func (rm *RecordManager) findNextPage(page *Page.Page, key []byte) uint32 {
+	return page.GetChildPageID(page.FindChildIndex(key))
 }
 
 // 处理节点分裂
-func (rm *RecordManager) handleSplit(page *Page.Page, internalRecord *Record.InternalRecord) (error, *Record.InternalRecord) {
+// 内部节点保持第i条记录的前驱指针等于第i个子节点，插入分隔键后要同步修正下一条记录的前驱指针
+func (rm *RecordManager) handleSplit(page *Page.Page, internalRecord *Record.InternalRecord, appended bool, op *operation) (error, *Record.InternalRecord, bool) {
 	// 尝试插入内部记录
 	err := page.InsertInternalRecord(internalRecord)
 	if err != nil {
 		// 如果节点已满，需要分裂
-		if err.Error() == "页面已满" {
-			return rm.splitInternalPage(page, internalRecord)
+		if errors.Is(err, ErrPageFull) {
+			return rm.splitInternalPage(page, internalRecord, appended, op)
+		}
+		return err, nil, false
+	}
+
+	index := page.FindChildIndex(internalRecord.Key)
+	if index < int(page.Header.RecordCount) {
+		next := page.GetInternalRecord(index)
+		next.SetFrontPointer(internalRecord.GetNextPointer())
+		if err := page.UpdateInternalRecordAt(index, next); err != nil {
+			return err, nil, false
 		}
-		return err, nil
 	}
 
 	// 更新页面
-	return rm.pageManager.UpdatePage(page), nil
+	page.Header.SetDirty(true)
+	return nil, nil, false
 }
 
-// 分裂内部节点
-func (rm *RecordManager) splitInternalPage(page *Page.Page, record *Record.InternalRecord) (error, *Record.InternalRecord) {
+// 分裂内部节点：中间的分隔键上移到父节点，不在子节点中保留。
+// 下层是在树的右边缘末尾追加时，分隔键插在最后也还在右边缘上
+func (rm *RecordManager) splitInternalPage(page *Page.Page, record *Record.InternalRecord, appended bool, op *operation) (error, *Record.InternalRecord, bool) {
+	records := page.GetAllInternalRecords()
+	pos := sort.Search(len(records), func(i int) bool {
+		return bytes.Compare(records[i].Key, record.Key) >= 0
+	})
+	records = append(records, nil)
+	copy(records[pos+1:], records[pos:])
+	records[pos] = record
+	if pos+1 < len(records) {
+		records[pos+1].SetFrontPointer(record.GetNextPointer())
+	}
+
 	// 创建新的内部节点页面
-	newPage, err := rm.pageManager.CreatePage(Page.InternalPageID)
+	newPage, err := op.newPage(Page.InternalPageID)
 	if err != nil {
-		return err, nil
+		return err, nil, false
 	}
+	defer op.unpinPage(newPage.Header.PageID, true)
 	newPage.Header.PageType = Page.InternalPageID
 
-	// 分裂记录
-	middleKey, err := page.SplitRecords(newPage)
-	if err != nil {
-		return err, nil
+	// 树的右边缘上的节点在末尾插入时是顺序插入，原页面按填充因子保留记录，两边至少各有一条记录
+	mid := len(records) / 2
+	appended = appended && pos == len(records)-1
+	if appended {
+		sizes := make([]int, len(records)-1)
+		for i := range sizes {
+			sizes[i] = internalRecordSize(records[i].Key)
+		}
+		mid = fillIndex(sizes, rm.fillLimit())
+	}
+	if err := fillInternalPage(page, records[:mid]); err != nil {
+		return err, nil, false
 	}
+	if err := fillInternalPage(newPage, records[mid+1:]); err != nil {
+		return err, nil, false
+	}
+	middleKey := records[mid].Key
 
-	// 更新页面链接
-	newPage.Header.NextPageID = page.Header.NextPageID
-	page.Header.NextPageID = newPage.Header.PageID
-	newPage.Header.PrevPageID = page.Header.PageID
+	// 保存更改
+	page.Header.SetDirty(true)
+	newPage.Header.SetDirty(true)
 
-	// 根据中间键决定记录应该插入哪个页面
-	if bytes.Compare(record.Key[:], middleKey[:]) < 0 {
-		err = page.InsertInternalRecord(record)
-	} else {
-		err = newPage.InsertInternalRecord(record)
-	}
-	if err != nil {
-		return err, nil
+	// 如果是根节点分裂，需要创建新的根节点
+	if page.Header.PageID == rm.pageManager.metaPage.RootPageID {
+		err := rm.createNewRoot(page.Header.PageID, newPage.Header.PageID, middleKey, op)
+		return err, nil, false
 	}
 
 	// 创建新的内部记录（用于上层节点）
@@ -321,516 +474,604 @@ func (rm *RecordManager) splitInternalPage(page *Page.Page, record *Record.Inter
 		newPage.Header.PageID,
 	)
 
-	// 保存更改
-	if err := rm.pageManager.UpdatePage(page); err != nil {
-		return err, nil
-	}
-	if err := rm.pageManager.UpdatePage(newPage); err != nil {
-		return err, nil
-	}
-
-	// 如果是根节点分裂，需要创建新的根节点
-	if page.Header.PageID == rm.pageManager.metaPage.RootPageID {
-		err := rm.createNewRoot(page.Header.PageID, newPage.Header.PageID, middleKey)
-		return err, nil
-	}
-
 	// 返回分裂错误和升的记录
-	return fmt.Errorf("页面需要分裂"), upRecord
+	return ErrPageSplit, upRecord, appended
 }
 
 // 删除记录
-func (rm *RecordManager) DeleteRecord(key [32]byte, tx *Transaction.Transaction) error {
-	operation := Transaction.Operation{
-		TransactionID: tx.TransactionID,
-		OperationType: Transaction.DeleteOperation,
-		Record:        nil,
-		OldRecord:     nil,
-		PageID:        0,
-	}
-	rm.transactionManager.AddTransaction(tx)
-	rm.transactionManager.AddOperation(operation)
+func (rm *RecordManager) DeleteRecord(key []byte, tx *Transaction.Transaction) error {
+	if err := rm.lockExclusive(tx, key); err != nil {
+		return err
+	}
+	if err := rm.checkWriteConflict(tx, key); err != nil {
+		return err
+	}
+	return rm.writeWithGapLock(tx, key, true, func() error {
+		if err := rm.transactionManager.AddTransaction(tx); err != nil {
+			return err
+		}
+		if err := rm.saveVersion(key, tx); err != nil {
+			return err
+		}
+		op := rm.newOperation()
+		oldRecord, err := rm.deleteRecord(key, op)
+		if err != nil {
+			rm.discardVersion(key, tx)
+			op.commit(nil)
+			return err
+		}
+		rm.recordWrite(tx, key)
+		logRecord := Transaction.NewLogRecord(tx.TransactionID, Transaction.LogDelete)
+		logRecord.Key = key
+		logRecord.Before = recordImage(oldRecord)
+		_, err = op.commit(logRecord)
+		return err
+	})
+}
+
+// 从B+树中删除记录并释放它的溢出页，返回被删除的完整记录
+func (rm *RecordManager) deleteRecord(key []byte, op *operation) (*Record.Record, error) {
 	meta, err := rm.pageManager.GetMetaPage()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if meta.RootPageID == 0 {
-		return ErrNotFound
+		return nil, ErrNotFound
 	}
 
-	_, err = rm.deleteRecordFromTree(key, meta.RootPageID, nil)
-	if err != nil {
-		return err
+	stored, done, err := rm.deleteOptimistic(key, op)
+	if !done {
+		stored, err = rm.deletePessimistic(key, op)
 	}
-	return nil
-}
-
-type DelResult struct {
-	InternalRecord *Record.InternalRecord
+	if err != nil && err != ErrUnderflow {
+		return nil, err
+	}
+	return rm.releaseRecord(stored, op)
 }
 
-// 从树中删除记录
-func (rm *RecordManager) deleteRecordFromTree(key [32]byte, pageID uint32, internalRecord *Record.InternalRecord) (DelResult, error) {
-	currentPage, err := rm.pageManager.GetPage(pageID)
+// 从树中删除记录并返回叶子节点中保存的记录，子节点下溢时返回ErrUnderflow，由父节点负责借用或合并。
+// 调用方已经对路径加了写闩
+func (rm *RecordManager) deleteRecordFromTree(key []byte, pageID uint32, op *operation) (*Record.Record, error) {
+	currentPage, err := op.fetchPage(pageID)
 	if err != nil {
-		return DelResult{}, err
+		return nil, err
 	}
+	defer op.unpinPage(pageID, false)
+
+	isRoot := pageID == rm.pageManager.metaPage.RootPageID
 
 	// 如果是内部节点
 	if currentPage.Header.PageType == Page.InternalPageID {
-		nextPageID := rm.findNextPage(currentPage, key)
-
-		result, err := rm.deleteRecordFromTree(key, nextPageID, internalRecord)
+		childIndex := currentPage.FindChildIndex(key)
+		deleted, err := rm.deleteRecordFromTree(key, currentPage.GetChildPageID(childIndex), op)
+		if err != ErrUnderflow {
+			return deleted, err
+		}
 
-		// 如果子节点记录太少，需要重新平衡
+		// 子节点记录太少，需要重新平衡
+		survivorID, err := rm.rebalanceChild(currentPage, childIndex, op)
 		if err != nil {
-			if err.Error() == "节点记录太少" {
-				return result, rm.handleUnderflow(currentPage)
+			return nil, err
+		}
+		currentPage.Header.SetDirty(true)
+		if isRoot {
+			// 根节点只剩一个子节点时降低树高
+			if currentPage.Header.RecordCount == 0 {
+				return deleted, rm.decreaseTreeHeight(currentPage, survivorID)
 			}
-			return DelResult{}, err
+			return deleted, nil
 		}
-
-		return DelResult{}, nil
+		if currentPage.IsUnderflow() {
+			return deleted, ErrUnderflow
+		}
+		return deleted, nil
 	}
 
 	// 如果是叶子节点
 	if currentPage.Header.PageType == Page.LeafPageID {
-		// 尝试删除记录
-		err := currentPage.DeleteRecord(key)
-		// 检查是否需要合并
+		deleted, err := currentPage.FindRecord(key)
 		if err != nil {
-			if err.Error() == "记录不存在" {
-				return DelResult{}, ErrNotFound
-			} else if err.Error() == "节点记录太少" {
-				// 如果是根节点且不为空，允许记录数少于一半
-				if currentPage.Header.PageID == rm.pageManager.metaPage.RootPageID &&
-					currentPage.Header.RecordCount > 0 {
-					return DelResult{}, rm.pageManager.UpdatePage(currentPage)
-				}
-				//借节点或者是合并节点，借和合并都有可能改变上层的索引值
-				err, internalRecord := rm.mergeLeafNodes(currentPage, nil)
-				if err != nil {
-					return DelResult{}, err
-				}
-				return DelResult{InternalRecord: internalRecord}, err
-			}
-			return DelResult{}, err
+			return nil, ErrNotFound
 		}
+		if err := currentPage.DeleteRecord(key); err != nil {
+			return nil, err
+		}
+		currentPage.Header.SetDirty(true)
 
-		//先更新然后再想办法平衡
-		rm.pageManager.UpdatePage(currentPage)
-		return DelResult{}, fmt.Errorf("节点记录太少")
-	}
-
-	return DelResult{}, fmt.Errorf("无效的页面类型")
-}
-
-// 更新记录
-func (rm *RecordManager) UpdateRecord(record *Record.Record, tx *Transaction.Transaction) error {
-	operation := Transaction.Operation{
-		TransactionID: tx.TransactionID,
-		OperationType: Transaction.UpdateOperation,
-		Record:        record,
-		OldRecord:     nil,
-		PageID:        0,
-	}
-	rm.transactionManager.AddTransaction(tx)
-	rm.transactionManager.AddOperation(operation)
-	meta, err := rm.pageManager.GetMetaPage()
-	if err != nil {
-		return err
-	}
-
-	if meta.RootPageID == 0 {
-		if err := rm.initBPlusTree(); err != nil {
-			return fmt.Errorf("初始化B+树失败: %v", err)
+		// 根节点允许记录数少于一半
+		if !isRoot && currentPage.IsUnderflow() {
+			return deleted, ErrUnderflow
 		}
-		meta, _ = rm.pageManager.GetMetaPage()
+		return deleted, nil
 	}
 
-	err, oldRecord, pageID := rm.updateRecordToTree(record, meta.RootPageID)
-	if err != nil {
-		return err
-	}
-	operation.OldRecord = oldRecord
-	operation.PageID = int32(pageID)
-	tx.AddOperation(operation)
-	return nil
+	return nil, fmt.Errorf("无效的页面类型")
 }
 
-// 合并叶子节点
-func (rm *RecordManager) mergeLeafNodes(page *Page.Page, internalRecord *Record.InternalRecord) (error, *Record.InternalRecord) {
-	meta, err := rm.pageManager.GetMetaPage()
-	if err != nil {
-		return err, nil
+// 重新平衡父节点下第childIndex个子节点：与相邻兄弟放得进一个页面时合并，否则在两者之间重新分配记录
+// 发生合并时返回合并后保留的页面ID
+func (rm *RecordManager) rebalanceChild(parent *Page.Page, childIndex int, op *operation) (uint32, error) {
+	// 优先与左兄弟配对，最左边的子节点与右兄弟配对
+	separatorIndex := childIndex - 1
+	if childIndex == 0 {
+		separatorIndex = 0
 	}
-
-	// 如果是根节点，且记录数不为0，则不需要合并
-	if page.Header.PageID == meta.RootPageID && page.Header.RecordCount > 0 {
-		return nil, nil
+	if separatorIndex >= int(parent.Header.RecordCount) {
+		return 0, fmt.Errorf("节点没有兄弟节点")
 	}
 
-	// 获取兄弟节点
-	isLeft := false
-	siblingPage := &Page.Page{}
-	if page.Header.PageID == internalRecord.FrontPointer {
-		isLeft = false
-		siblingPage, err = rm.pageManager.GetPage(internalRecord.NextPointer)
-	} else {
-		isLeft = true
-		siblingPage, err = rm.pageManager.GetPage(internalRecord.FrontPointer)
-	}
-	//siblingPage, isLeft, err := rm.getSiblingPage(page)
+	// 兄弟节点从左到右加写闩，与沿叶子链表扫描的顺序一致
+	left, err := op.fetchPage(parent.GetChildPageID(separatorIndex))
 	if err != nil {
-		return err, nil
+		return 0, err
 	}
-
-	// 如果可以借用记录
-	if siblingPage.Header.RecordCount > siblingPage.Header.MaxRecordCount/2 {
-		rm.redistributeRecords(page, siblingPage, isLeft)
-		//借用成功之后，范围值改变，需要更新上层索引值
-		if internalRecord != nil && isLeft {
-			internalRecord.FrontPointer = binary.LittleEndian.Uint32(siblingPage.GetMaxKey())
-			internalRecord.NextPointer = binary.LittleEndian.Uint32(page.GetMinKey())
-		}
-
-		rm.pageManager.UpdatePage(page)
-		rm.pageManager.UpdatePage(siblingPage)
-		return nil, internalRecord
-	}
-
-	// 否则需要合并节点
-	return rm.mergeSiblingPages(page, siblingPage, isLeft), internalRecord
-}
-
-// 查找记录
-func (rm *RecordManager) FindRecord(key [32]byte) (*Record.Record, error) {
-	meta, err := rm.pageManager.GetMetaPage()
-	if err != nil {
-		return nil, err
-	}
-
-	if meta.RootPageID == 0 {
-		return nil, ErrNotFound
-	}
-
-	return rm.findRecordInTree(key, meta.RootPageID)
-}
-
-// 在树中查找记录
-func (rm *RecordManager) findRecordInTree(key [32]byte, pageID uint32) (*Record.Record, error) {
-	currentPage, err := rm.pageManager.GetPage(pageID)
+	right, err := op.fetchPage(parent.GetChildPageID(separatorIndex + 1))
 	if err != nil {
-		return nil, err
+		op.unpinPage(left.Header.PageID, false)
+		return 0, err
 	}
+	defer op.unpinPage(left.Header.PageID, true)
 
-	// 如果是内部节点
-	if currentPage.Header.PageType == Page.InternalPageID {
-		nextPageID := rm.findNextPage(currentPage, key)
-		return rm.findRecordInTree(key, nextPageID)
+	merged, err := rm.buildMergedPage(parent, separatorIndex, left, right)
+	if err == nil {
+		// 合并后right页面被释放，不能再取消固定
+		*left = *merged
+		return left.Header.PageID, rm.mergePages(parent, separatorIndex, left, right, op)
 	}
-
-	// 如果是叶子节点
-	if currentPage.Header.PageType == Page.LeafPageID {
-		return currentPage.FindRecord(key)
+	defer op.unpinPage(right.Header.PageID, true)
+	if !errors.Is(err, ErrPageFull) {
+		return 0, err
 	}
-
-	return nil, fmt.Errorf("无效的页面类型")
+	return 0, rm.redistribute(parent, separatorIndex, left, right)
 }
 
-// 范围查询
-func (rm *RecordManager) RangeQuery(startKey, endKey [32]byte) ([]*Record.Record, error) {
-	if rm.pageManager.metaPage == nil {
-		return nil, ErrNotFound
-	}
-
-	var results []*Record.Record
-
-	// 找到第一个叶子节点
-	currentPage, err := rm.findLeafPage(startKey)
-	if err != nil {
-		return nil, err
-	}
-
-	// 遍历叶子节点链表
-	for currentPage != nil {
-		records, err := currentPage.RangeQuery(startKey, endKey)
+// 在left的副本上合并right的内容，放不下时返回页面已满
+func (rm *RecordManager) buildMergedPage(parent *Page.Page, separatorIndex int, left, right *Page.Page) (*Page.Page, error) {
+	merged := *left
+	if left.Header.PageType == Page.LeafPageID {
+		records, err := right.GetAllRecords()
 		if err != nil {
 			return nil, err
 		}
-		results = append(results, records...)
-
-		// 如果当前页面的最大键大于等于结束键，说明已经找完了
-		if bytes.Compare(currentPage.GetMaxKey(), endKey[:]) >= 0 {
-			break
+		for _, record := range records {
+			if err := merged.InsertRecord(record); err != nil {
+				return nil, err
+			}
 		}
+		return &merged, nil
+	}
 
-		// 获取下一个叶子节点
-		currentPage, err = rm.pageManager.GetPage(currentPage.Header.NextPageID)
-		if err != nil {
+	// 分隔键下移，连接left的最后一个子节点和right的第一个子节点
+	separator := parent.GetInternalRecord(separatorIndex)
+	down := Record.NewInternalRecord(*Record.NewRecordHeader(), separator.Key,
+		left.GetChildPageID(int(left.Header.RecordCount)), right.GetChildPageID(0))
+	if err := merged.InsertInternalRecord(down); err != nil {
+		return nil, err
+	}
+	for _, record := range right.GetAllInternalRecords() {
+		if err := merged.InsertInternalRecord(record); err != nil {
 			return nil, err
 		}
 	}
-
-	return results, nil
+	return &merged, nil
 }
 
-// 处理节点下溢
-func (rm *RecordManager) handleUnderflow(page *Page.Page) error {
-	// 如果是根节点，且只有一个子节点，则需要降低树高
-	if page.Header.PageID == rm.pageManager.metaPage.RootPageID {
-		if page.Header.RecordCount == 0 {
-			return rm.decreaseTreeHeight(page)
+// 把right合并到left之后，删除父节点中第separatorIndex条分隔记录，并释放right页面
+func (rm *RecordManager) mergePages(parent *Page.Page, separatorIndex int, left, right *Page.Page, op *operation) error {
+	// 更新叶子链表指针
+	if left.Header.PageType == Page.LeafPageID {
+		left.Header.NextPageID = right.Header.NextPageID
+		if right.Header.NextPageID != 0 {
+			nextPage, err := op.fetchPage(right.Header.NextPageID)
+			if err != nil {
+				return err
+			}
+			nextPage.Header.PrevPageID = left.Header.PageID
+			op.unpinPage(nextPage.Header.PageID, true)
 		}
-		return nil
 	}
+	left.Header.SetDirty(true)
 
-	// 获取兄弟节点
-	siblingPage, isLeft, err := rm.getSiblingPage(page)
-	if err != nil {
+	// 删除分隔记录，它的后继指针就是right，下一条记录的前驱指针改为left
+	if err := parent.RemoveInternalRecordAt(separatorIndex); err != nil {
 		return err
 	}
-
-	// 如果可以借用记录
-	if siblingPage.Header.RecordCount > siblingPage.Header.MaxRecordCount/2 {
-		return rm.redistributeInternalRecords(page, siblingPage, isLeft)
+	if separatorIndex < int(parent.Header.RecordCount) {
+		next := parent.GetInternalRecord(separatorIndex)
+		next.SetFrontPointer(left.Header.PageID)
+		if err := parent.UpdateInternalRecordAt(separatorIndex, next); err != nil {
+			return err
+		}
 	}
 
-	// 否则需要合并节点
-	return rm.mergeInternalPages(page, siblingPage, isLeft)
+	// 删除源页面
+	return rm.bufferPool.DeletePage(right.Header.PageID)
 }
 
-// 获取兄弟节点
-func (rm *RecordManager) getSiblingPage(page *Page.Page) (*Page.Page, bool, error) {
-	// 如果有左兄弟节点
-	if page.Header.PrevPageID != 0 {
-		siblingPage, err := rm.pageManager.GetPage(page.Header.PrevPageID)
+// 在两个相邻兄弟之间按字节数重新分配记录，并更新父节点的分隔键
+func (rm *RecordManager) redistribute(parent *Page.Page, separatorIndex int, left, right *Page.Page) error {
+	var separatorKey []byte
+	if left.Header.PageType == Page.LeafPageID {
+		leftRecords, err := left.GetAllRecords()
 		if err != nil {
-			return nil, false, err
+			return err
 		}
-		return siblingPage, true, nil
-	}
-
-	// 如果有右兄弟节点
-	if page.Header.NextPageID != 0 {
-		siblingPage, err := rm.pageManager.GetPage(page.Header.NextPageID)
+		rightRecords, err := right.GetAllRecords()
 		if err != nil {
-			return nil, false, err
+			return err
 		}
-		return siblingPage, false, nil
+		records := append(leftRecords, rightRecords...)
+		mid := splitIndex(recordSizes(records))
+		if err := fillLeafPage(left, records[:mid]); err != nil {
+			return err
+		}
+		if err := fillLeafPage(right, records[mid:]); err != nil {
+			return err
+		}
+		separatorKey = records[mid].Key
+	} else {
+		separator := parent.GetInternalRecord(separatorIndex)
+		down := Record.NewInternalRecord(*Record.NewRecordHeader(), separator.Key,
+			left.GetChildPageID(int(left.Header.RecordCount)), right.GetChildPageID(0))
+		records := append(append(left.GetAllInternalRecords(), down), right.GetAllInternalRecords()...)
+		mid := len(records) / 2
+		if err := fillInternalPage(left, records[:mid]); err != nil {
+			return err
+		}
+		if err := fillInternalPage(right, records[mid+1:]); err != nil {
+			return err
+		}
+		separatorKey = records[mid].Key
 	}
+	left.Header.SetDirty(true)
+	right.Header.SetDirty(true)
+	return rm.updateSeparator(parent, separatorIndex, separatorKey)
+}
 
-	return nil, false, fmt.Errorf("节点没有兄弟节点")
+// 修改父节点第index条记录的分隔键
+func (rm *RecordManager) updateSeparator(parent *Page.Page, index int, key []byte) error {
+	record := parent.GetInternalRecord(index)
+	record.SetKey(key)
+	return parent.UpdateInternalRecordAt(index, record)
 }
 
-// 重新分配记录（叶子节点）
-func (rm *RecordManager) redistributeRecords(page, siblingPage *Page.Page, isLeft bool) error {
-	if isLeft {
-		// 从左兄弟节点借一个记录
-		record, err := siblingPage.RemoveLastRecord()
-		if err != nil {
+// 清空叶子页面并按顺序写入记录
+func fillLeafPage(page *Page.Page, records []*Record.Record) error {
+	page.ClearRecords()
+	for _, record := range records {
+		if err := page.InsertRecord(record); err != nil {
 			return err
 		}
-		return page.InsertRecord(record)
-	} else {
-		// 从右兄弟节点借一个记录
-		record, err := siblingPage.RemoveFirstRecord()
-		if err != nil {
+	}
+	return nil
+}
+
+// 清空内部页面并按顺序写入内部记录
+func fillInternalPage(page *Page.Page, records []*Record.InternalRecord) error {
+	page.ClearRecords()
+	for _, record := range records {
+		if err := page.InsertInternalRecord(record); err != nil {
 			return err
 		}
-		return page.InsertRecord(record)
 	}
+	return nil
 }
 
-// 重新分配记录（内部节点）
-func (rm *RecordManager) redistributeInternalRecords(page, siblingPage *Page.Page, isLeft bool) error {
-	if isLeft {
-		// 从左兄弟节点借一个记录
-		record, err := siblingPage.RemoveLastInternalRecord()
-		if err != nil {
-			return err
+// 每条记录在页面中占用的字节数，包括槽
+func recordSizes(records []*Record.Record) []int {
+	sizes := make([]int, len(records))
+	for i, record := range records {
+		sizes[i] = recordSize(record)
+	}
+	return sizes
+}
+
+func recordSize(record *Record.Record) int {
+	return Record.RecordHeaderSize + len(record.Key) + len(record.Value) + Page.SlotEntrySize
+}
+
+// 选择分裂位置，使前后两部分的字节数尽量相等，两边至少各有一条记录
+func splitIndex(sizes []int) int {
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+	best, bestDiff := 1, -1
+	prefix := 0
+	for k := 1; k < len(sizes); k++ {
+		prefix += sizes[k-1]
+		diff := 2*prefix - total
+		if diff < 0 {
+			diff = -diff
 		}
-		return page.InsertInternalRecord(record)
-	} else {
-		// 从右兄弟节点借一个记录
-		record, err := siblingPage.RemoveFirstInternalRecord()
-		if err != nil {
-			return err
+		if bestDiff < 0 || diff < bestDiff {
+			best, bestDiff = k, diff
 		}
-		return page.InsertInternalRecord(record)
 	}
+	return best
 }
 
-// 合并叶子节点
-func (rm *RecordManager) mergeSiblingPages(page, siblingPage *Page.Page, isLeft bool) error {
-	var targetPage, sourcePage *Page.Page
-	if isLeft {
-		targetPage = siblingPage
-		sourcePage = page
-	} else {
-		targetPage = page
-		sourcePage = siblingPage
+// 按填充因子选择分裂位置：前一部分保留不超过limit字节的尽量多的记录，两边至少各有一条记录
+func fillIndex(sizes []int, limit int) int {
+	used, mid := 0, 0
+	for mid < len(sizes)-1 && used+sizes[mid] <= limit {
+		used += sizes[mid]
+		mid++
+	}
+	if mid < 1 {
+		mid = 1
 	}
+	return mid
+}
 
-	// 将源页面的记录复制到目标页面
-	records, err := sourcePage.GetAllRecords()
+// 更新记录
+func (rm *RecordManager) UpdateRecord(record *Record.Record, tx *Transaction.Transaction) error {
+	if err := checkKeySize(record.GetKey()); err != nil {
+		return err
+	}
+	if err := rm.lockExclusive(tx, record.GetKey()); err != nil {
+		return err
+	}
+	if err := rm.checkWriteConflict(tx, record.GetKey()); err != nil {
+		return err
+	}
+	rm.opLatch.RLock()
+	defer rm.opLatch.RUnlock()
+	if err := rm.transactionManager.AddTransaction(tx); err != nil {
+		return err
+	}
+	rm.stampRecord(record, tx)
+	if err := rm.saveVersion(record.GetKey(), tx); err != nil {
+		return err
+	}
+	op := rm.newOperation()
+	oldRecord, _, err := rm.updateRecord(record, op)
 	if err != nil {
+		rm.discardVersion(record.GetKey(), tx)
+		op.commit(nil)
 		return err
 	}
+	rm.recordWrite(tx, record.GetKey())
+	logRecord := Transaction.NewLogRecord(tx.TransactionID, Transaction.LogUpdate)
+	logRecord.Key = record.GetKey()
+	logRecord.Before = recordImage(oldRecord)
+	logRecord.After = recordImage(record)
+	_, err = op.commit(logRecord)
+	return err
+}
 
-	for _, record := range records {
-		if err := targetPage.InsertRecord(record); err != nil {
-			return err
-		}
+// 用新记录替换B+树中键相同的记录，释放旧值的溢出页，返回旧的完整记录和所在的叶子页面
+func (rm *RecordManager) updateRecord(record *Record.Record, op *operation) (*Record.Record, uint32, error) {
+	meta, err := rm.pageManager.GetMetaPage()
+	if err != nil {
+		return nil, 0, err
 	}
 
-	// 更新链表指针
-	targetPage.Header.NextPageID = sourcePage.Header.NextPageID
-	if sourcePage.Header.NextPageID != 0 {
-		nextPage, err := rm.pageManager.GetPage(sourcePage.Header.NextPageID)
-		if err != nil {
-			return err
-		}
-		nextPage.Header.PrevPageID = targetPage.Header.PageID
-		if err := rm.pageManager.UpdatePage(nextPage); err != nil {
-			return err
-		}
+	if meta.RootPageID == 0 {
+		return nil, 0, ErrNotFound
 	}
 
-	// 更新页面
-	if err := rm.pageManager.UpdatePage(targetPage); err != nil {
-		return err
+	stored, err := rm.spillRecord(record, op)
+	if err != nil {
+		return nil, 0, err
+	}
+	oldStored, pageID, done, err := rm.updateOptimistic(stored, op)
+	if !done {
+		// 新记录在原页面放不下或者旧值在溢出页中，先删除旧记录再重新插入
+		oldStored, err = rm.updatePessimistic(stored, op)
+		pageID = 0
+	}
+	if err != nil {
+		rm.freeOverflow(stored, op)
+		if errors.Is(err, Page.ErrRecordNotFound) {
+			err = ErrNotFound
+		}
+		return nil, 0, err
 	}
 
-	// 删除源页面
-	return rm.pageManager.DisposePage(sourcePage)
+	oldRecord, err := rm.releaseRecord(oldStored, op)
+	return oldRecord, pageID, err
 }
 
-// 降低树的高度
-func (rm *RecordManager) decreaseTreeHeight(rootPage *Page.Page) error {
-	meta, err := rm.pageManager.GetMetaPage()
+// 在B+树中查找记录并读出溢出页中的值
+func (rm *RecordManager) findRecord(key []byte) (*Record.Record, error) {
+	leaf, err := rm.findLeaf(key, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	childRecord := rootPage.GetFirstInternalRecord()
-	if childRecord == nil {
-		return fmt.Errorf("根节点没有子节点")
+	if leaf == nil {
+		return nil, ErrNotFound
 	}
+	defer rm.bufferPool.UnpinPageRead(leaf.Header.PageID)
+	stored, err := leaf.FindRecord(key)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	// 持有叶子的读闩时读溢出页，写操作修改叶子之后才会释放旧值的溢出页
+	return rm.loadRecord(stored)
+}
+
+// 沿叶子链表查找键在[startKey, endKey]中的记录
+func (rm *RecordManager) rangeQuery(startKey, endKey []byte) ([]*Record.Record, error) {
+	return rm.scanRange(ClosedRange(startKey, endKey), ScanOptions{})
+}
 
-	childPage, err := rm.pageManager.GetPage(childRecord.GetFrontPointer())
+// 降低树的高度，根节点已经没有分隔键，唯一的子节点成为新的根节点。调用方持有结构闩
+func (rm *RecordManager) decreaseTreeHeight(rootPage *Page.Page, childPageID uint32) error {
+	meta, err := rm.pageManager.GetMetaPage()
 	if err != nil {
 		return err
 	}
+	if childPageID == 0 {
+		return fmt.Errorf("根节点没有子节点")
+	}
 
 	// 更新元数据
-	meta.RootPageID = childPage.Header.PageID
+	meta.RootPageID = childPageID
 	meta.TreeHeight--
 
 	if err := rm.pageManager.WriteMetaPage(); err != nil {
 		return err
 	}
 
-	return rm.pageManager.DisposePage(rootPage)
+	return rm.bufferPool.DeletePage(rootPage.Header.PageID)
 }
 
-// 查找叶子节点
-func (rm *RecordManager) findLeafPage(key [32]byte) (*Page.Page, error) {
-	if rm.pageManager.metaPage == nil {
-		return nil, ErrNotFound
-	}
+// 开始一个事务，事务ID由事务管理器分配，重启后不会重复
+func (rm *RecordManager) Begin(isolationLevel int32) (*Transaction.Transaction, error) {
+	return rm.transactionManager.Begin(isolationLevel)
+}
 
-	currentPageID := rm.pageManager.metaPage.RootPageID
-	for {
-		currentPage, err := rm.pageManager.GetPage(currentPageID)
-		if err != nil {
-			return nil, err
-		}
+// 把下一个事务ID保存到元数据页，元数据页随下一条日志写入，检查点和关闭时写回
+func (rm *RecordManager) saveNextTransactionID(nextTransactionID int32) error {
+	rm.structureLatch.Lock()
+	defer rm.structureLatch.Unlock()
+	meta, err := rm.pageManager.GetMetaPage()
+	if err != nil {
+		return err
+	}
+	// 并发开始的事务保存的顺序不确定，计数器只增不减
+	if uint32(nextTransactionID) <= meta.GetNextTransactionID() {
+		return nil
+	}
+	meta.SetNextTransactionID(uint32(nextTransactionID))
+	return rm.pageManager.WriteMetaPage()
+}
 
-		if currentPage.Header.PageType == Page.LeafPageID {
-			return currentPage, nil
-		}
+// 设置树的填充因子并保存到元数据页：批量加载按它填充页面，顺序插入分裂时原页面保留这么多数据
+func (rm *RecordManager) SetFillFactor(fillFactor float64) error {
+	if err := checkFillFactor(fillFactor); err != nil {
+		return err
+	}
+	rm.structureLatch.Lock()
+	defer rm.structureLatch.Unlock()
+	meta, err := rm.pageManager.GetMetaPage()
+	if err != nil {
+		return err
+	}
+	meta.SetFillFactor(uint32(math.Round(fillFactor * 100)))
+	return rm.pageManager.WriteMetaPage()
+}
 
-		currentPageID = rm.findNextPage(currentPage, key)
+// 获取树的填充因子
+func (rm *RecordManager) GetFillFactor() (float64, error) {
+	rm.structureLatch.Lock()
+	defer rm.structureLatch.Unlock()
+	if _, err := rm.pageManager.GetMetaPage(); err != nil {
+		return 0, err
 	}
+	return rm.fillFactor(), nil
 }
 
-// 合并内部节点
-func (rm *RecordManager) mergeInternalPages(page, siblingPage *Page.Page, isLeft bool) error {
-	var targetPage, sourcePage *Page.Page
-	if isLeft {
-		targetPage = siblingPage
-		sourcePage = page
-	} else {
-		targetPage = page
-		sourcePage = siblingPage
+// 树的填充因子，调用方持有结构闩并且已经读取了元数据页
+func (rm *RecordManager) fillFactor() float64 {
+	if percent := rm.pageManager.metaPage.GetFillFactor(); percent != 0 {
+		return float64(percent) / 100
 	}
+	return DefaultFillFactor
+}
 
-	// 将源页面的记录复制到目标页面
-	for i := uint32(0); i < sourcePage.Header.RecordCount; i++ {
-		record := sourcePage.GetInternalRecord(int(i))
-		if err := targetPage.InsertInternalRecord(record); err != nil {
-			return err
-		}
+// 按填充因子每个页面最多使用的字节数
+func (rm *RecordManager) fillLimit() int {
+	return int(rm.fillFactor() * Page.DataAreaSize)
+}
+
+// 回滚事务，已经回滚的事务直接返回
+func (rm *RecordManager) Rollback(transaction *Transaction.Transaction) error {
+	rm.opLatch.RLock()
+	defer rm.opLatch.RUnlock()
+	if transaction.Status == Transaction.Aborted {
+		return nil
+	}
+	if err := rm.undoLog(transaction, 0, 0); err != nil {
+		return fmt.Errorf("回滚操作失败: %v", err)
 	}
+	return rm.transactionManager.Rollback(transaction.TransactionID)
+}
 
-	// 更新页面链接
-	targetPage.Header.NextPageID = sourcePage.Header.NextPageID
-	if sourcePage.Header.NextPageID != 0 {
-		nextPage, err := rm.pageManager.GetPage(sourcePage.Header.NextPageID)
-		if err != nil {
-			return err
-		}
-		nextPage.Header.PrevPageID = targetPage.Header.PageID
-		if err := rm.pageManager.UpdatePage(nextPage); err != nil {
-			return err
-		}
+// 撤销事务最后一个还没有撤销的操作
+func (rm *RecordManager) Undo(transaction *Transaction.Transaction) error {
+	rm.opLatch.RLock()
+	defer rm.opLatch.RUnlock()
+	if err := rm.undoLog(transaction, 0, 1); err != nil {
+		return fmt.Errorf("撤销操作失败: %v", err)
 	}
+	return nil
+}
 
-	// 更新页面
-	if err := rm.pageManager.UpdatePage(targetPage); err != nil {
+// 回滚到保存点：按相反的顺序撤销保存点之后的操作并写入补偿日志，事务继续活动，持有的锁不释放
+func (rm *RecordManager) RollbackTo(transaction *Transaction.Transaction, name string) error {
+	rm.opLatch.RLock()
+	defer rm.opLatch.RUnlock()
+	savepointLSN, err := transaction.RewindSavepoint(name)
+	if err != nil {
 		return err
 	}
-
-	// 删除源页面
-	return rm.pageManager.DisposePage(sourcePage)
+	if err := rm.undoLog(transaction, savepointLSN, 0); err != nil {
+		return fmt.Errorf("回滚到保存点失败: %v", err)
+	}
+	return nil
 }
 
-// 回滚事务
-func (rm *RecordManager) Rollback(transaction *Transaction.Transaction) error {
-	for i := len(transaction.Operations) - 1; i >= 0; i-- {
-		operation := transaction.Operations[i]
-		if operation.OperationType == Transaction.UpdateOperation {
-			_, _, pageID := rm.updateRecordToTree(operation.OldRecord, uint32(operation.PageID))
-			operation.PageID = int32(pageID)
-		}
-		if operation.OperationType == Transaction.DeleteOperation {
-			rm.InsertRecord(operation.Record, transaction)
+// 从事务的最后一条日志开始沿PrevLSN撤销LSN大于stopLSN的操作，遇到补偿日志时跳到它的UndoNextLSN，
+// 已经撤销过的操作不会重复撤销。limit大于0时最多撤销limit个操作。
+// 撤销需要的记录镜像都从日志中读取，事务不在内存中保存它的操作
+func (rm *RecordManager) undoLog(transaction *Transaction.Transaction, stopLSN uint64, limit int) error {
+	logManager := rm.transactionManager.GetLogManager()
+	undone := 0
+	for lsn := transaction.LastLSN; lsn > stopLSN && (limit <= 0 || undone < limit); {
+		record, err := logManager.ReadRecord(lsn)
+		if err != nil {
+			return err
 		}
-		if operation.OperationType == Transaction.InsertOperation {
-			rm.DeleteRecord(operation.Record.Key, transaction)
+		lsn = record.PrevLSN
+		switch {
+		case record.Type == Transaction.LogCLR:
+			lsn = record.UndoNextLSN
+		case record.IsUndoable():
+			if err := rm.undoOperation(record); err != nil {
+				return err
+			}
+			undone++
 		}
 	}
-	rm.transactionManager.Rollback(transaction.TransactionID)
 	return nil
 }
 
-// 撤销事务
-func (rm *RecordManager) Undo(transaction *Transaction.Transaction) error {
-	operation := transaction.Operations[len(transaction.Operations)-1]
-	if operation.OperationType == Transaction.UpdateOperation {
-		_, _, pageID := rm.updateRecordToTree(operation.OldRecord, uint32(operation.PageID))
-		operation.PageID = int32(pageID)
-	}
-	if operation.OperationType == Transaction.DeleteOperation {
-		rm.InsertRecord(operation.Record, transaction)
+// 按操作日志中的键和修改前的镜像执行逆操作并写入补偿日志，溢出页随记录一起重写或释放
+func (rm *RecordManager) undoOperation(record *Transaction.LogRecord) error {
+	logRecord := Transaction.NewLogRecord(record.TransactionID, Transaction.LogCLR)
+	logRecord.UndoNextLSN = record.PrevLSN
+	logRecord.Key = record.Key
+
+	op := rm.newOperation()
+	var err error
+	switch record.Type {
+	case Transaction.LogUpdate:
+		var oldRecord *Record.Record
+		if oldRecord, err = parseRecordImage(record.Before); err == nil {
+			_, _, err = rm.updateRecord(oldRecord, op)
+			logRecord.After = record.Before
+		}
+	case Transaction.LogDelete:
+		var oldRecord *Record.Record
+		if oldRecord, err = parseRecordImage(record.Before); err == nil {
+			err = rm.insertRecord(oldRecord, op)
+			logRecord.After = record.Before
+		}
+	case Transaction.LogInsert:
+		_, err = rm.deleteRecord(record.Key, op)
+	default:
+		return fmt.Errorf("LSN %d 不是操作日志", record.LSN)
 	}
-	if operation.OperationType == Transaction.InsertOperation {
-		rm.DeleteRecord(operation.Record.Key, transaction)
+	if err != nil {
+		op.commit(nil)
+		return err
 	}
-	rm.transactionManager.Undo(transaction.TransactionID)
-	return nil
+	rm.versions.pop(logRecord.Key, record.TransactionID)
+	_, err = op.commit(logRecord)
+	return err
 }
 
 // TreeReverse 遍历并输出B+树的结构
@@ -869,7 +1110,7 @@ func (rm *RecordManager) TreeReverse() error {
 		}
 
 		// 获取页面
-		page, err := rm.pageManager.GetPage(item.pageID)
+		page, err := rm.bufferPool.FetchPage(item.pageID)
 		if err != nil {
 			return fmt.Errorf("获取页面失败 (ID=%d): %v", item.pageID, err)
 		}
@@ -890,15 +1131,11 @@ func (rm *RecordManager) TreeReverse() error {
 
 		// 输出键值
 		fmt.Print("键值: [")
-		for i := uint32(0); i < page.Header.RecordCount; i++ {
-			key, err := page.ReadKey(i*32, 32)
-			if err != nil {
-				return fmt.Errorf("读取键值失败: %v", err)
-			}
+		for i := 0; i < int(page.Header.RecordCount); i++ {
 			if i > 0 {
 				fmt.Print(", ")
 			}
-			fmt.Printf("%d", key[3]) // 假设键值在最后一个字节
+			fmt.Printf("%q", page.KeyAt(i))
 		}
 		fmt.Println("]")
 
@@ -920,6 +1157,7 @@ func (rm *RecordManager) TreeReverse() error {
 				}
 			}
 		}
+		rm.bufferPool.UnpinPage(item.pageID, false)
 	}
 
 	fmt.Println("====================")
@@ -935,6 +1173,8 @@ func getPageTypeName(pageType uint32) string {
 		return "Internal"
 	case Page.LeafPageID:
 		return "Leaf"
+	case Page.OverflowPageID:
+		return "Overflow"
 	default:
 		return "Unknown"
 	}
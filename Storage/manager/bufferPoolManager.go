@@ -0,0 +1,622 @@
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"wudb/Entity/Page"
+	"wudb/Storage/replacer"
+	"wudb/Transaction"
+)
+
+const (
+	DefaultPoolSize = 64 // 默认缓冲池帧数
+)
+
+const (
+	ErrNoFreeFrame   = Error("缓冲池没有可用的帧")
+	ErrPageNotInBuf  = Error("页面不在缓冲池中")
+	ErrPagePinned    = Error("页面仍被占用")
+	ErrPageNotLogged = Error("页面的修改还没有写入日志")
+)
+
+// 缓冲池中的一帧
+type frame struct {
+	page     *Page.Page
+	pageID   uint32 // 页面头可能正被持有写闩的操作整体替换，固定和取消固定只用这里的页ID
+	pinCount int
+	dirty    bool   // 修改已经写入日志，等待写回
+	recLSN   uint64 // 第一条还没写回的修改的日志，用于检查点的脏页表
+
+	// 页面闩，读页面内容时持有读闩，修改时持有写闩。持有写闩的一方可以重复获取，
+	// writeHolds是它持有的次数；kept表示它修改过页面，放开所有写闩后仍然保留一次固定和写闩，
+	// 直到修改写入日志
+	latch      sync.RWMutex
+	writer     *latchOwner
+	writeHolds int
+	kept       bool
+}
+
+// 持有写闩的一方，通常是一次写操作。修改过的页面在写入日志之前一直由它持有，
+// 其他操作看不到还没有写入日志的修改，同一个页面的修改和日志的顺序一致
+type latchOwner struct {
+	modified []uint32 // 保留写闩的页面，按第一次放开的顺序
+}
+
+// 缓冲池管理器，位于PageManager之前，所有页面访问都经过它
+type BufferPoolManager struct {
+	pageManager *PageManager
+	frames      []*frame
+	pageTable   map[uint32]int // 页ID -> 帧下标
+	freeFrames  []int          // 空闲帧
+	replacer    replacer.Replacer
+	stats       replacer.Stats
+	logManager  *Transaction.LogManager // 为nil时不使用预写日志
+	mutex       sync.Mutex
+	unpinned    *sync.Cond // 页面被取消固定时通知等待删除页面的写操作
+}
+
+// 使用LRU策略创建缓冲池
+func NewBufferPoolManager(pageManager *PageManager, poolSize int) *BufferPoolManager {
+	bpm, _ := NewBufferPoolManagerWithPolicy(pageManager, poolSize, replacer.PolicyLRU)
+	return bpm
+}
+
+// 使用指定的页面置换策略创建缓冲池
+func NewBufferPoolManagerWithPolicy(pageManager *PageManager, poolSize int, policy replacer.Policy) (*BufferPoolManager, error) {
+	if poolSize <= 0 {
+		poolSize = DefaultPoolSize
+	}
+	r, err := replacer.NewReplacer(policy, poolSize)
+	if err != nil {
+		return nil, err
+	}
+	bpm := &BufferPoolManager{
+		pageManager: pageManager,
+		frames:      make([]*frame, poolSize),
+		pageTable:   make(map[uint32]int),
+		freeFrames:  make([]int, 0, poolSize),
+		replacer:    r,
+		stats:       replacer.Stats{Policy: r.Policy()},
+	}
+	bpm.unpinned = sync.NewCond(&bpm.mutex)
+	for i := 0; i < poolSize; i++ {
+		bpm.frames[i] = &frame{}
+		bpm.freeFrames = append(bpm.freeFrames, i)
+	}
+	return bpm, nil
+}
+
+// 开启预写日志：页面头的脏标记表示还没写入日志的修改，这样的页面不会被淘汰；
+// 写回页面前先把日志写到页面的LSN
+func (bpm *BufferPoolManager) SetLogManager(logManager *Transaction.LogManager) {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+	bpm.logManager = logManager
+	bpm.pageManager.SetDeferWrites(logManager != nil)
+}
+
+// 获取页面并固定，使用完后必须调用UnpinPage
+func (bpm *BufferPoolManager) FetchPage(pageID uint32) (*Page.Page, error) {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+	f, err := bpm.fetch(pageID)
+	if err != nil {
+		return nil, err
+	}
+	return f.page, nil
+}
+
+// 获取页面并加读闩，使用完后必须调用UnpinPageRead
+func (bpm *BufferPoolManager) FetchPageRead(pageID uint32) (*Page.Page, error) {
+	bpm.mutex.Lock()
+	f, err := bpm.fetch(pageID)
+	bpm.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	// 页面已经固定，等闩时帧不会被淘汰
+	f.latch.RLock()
+	return f.page, nil
+}
+
+// 获取页面并尝试加读闩，闩被占用时不等待，返回false
+func (bpm *BufferPoolManager) TryFetchPageRead(pageID uint32) (*Page.Page, bool, error) {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+	f, err := bpm.fetch(pageID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !f.latch.TryRLock() {
+		bpm.unpin(f, false)
+		return nil, false, nil
+	}
+	return f.page, true, nil
+}
+
+// 释放读闩并取消固定
+func (bpm *BufferPoolManager) UnpinPageRead(pageID uint32) error {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+	frameID, ok := bpm.pageTable[pageID]
+	if !ok {
+		return ErrPageNotInBuf
+	}
+	f := bpm.frames[frameID]
+	// 先取消固定再释放闩，固定计数没有归零时写操作还不能修改页面
+	err := bpm.unpin(f, false)
+	f.latch.RUnlock()
+	return err
+}
+
+// 获取页面并由owner加写闩，owner已经持有时直接返回，使用完后必须调用UnpinPageWrite
+func (bpm *BufferPoolManager) FetchPageWrite(pageID uint32, owner *latchOwner) (*Page.Page, error) {
+	bpm.mutex.Lock()
+	f, err := bpm.fetch(pageID)
+	if err != nil {
+		bpm.mutex.Unlock()
+		return nil, err
+	}
+	if f.writer == owner {
+		f.writeHolds++
+		bpm.mutex.Unlock()
+		return f.page, nil
+	}
+	bpm.mutex.Unlock()
+
+	f.latch.Lock()
+	bpm.mutex.Lock()
+	f.writer = owner
+	f.writeHolds = 1
+	bpm.mutex.Unlock()
+	return f.page, nil
+}
+
+// 分配一个新页面，固定并由owner加写闩
+func (bpm *BufferPoolManager) NewPageWrite(pageType uint32, owner *latchOwner) (*Page.Page, error) {
+	page, err := bpm.NewPage(pageType)
+	if err != nil {
+		return nil, err
+	}
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+	// 新页面的帧之前没有被固定，闩一定是空闲的
+	f := bpm.frames[bpm.pageTable[page.Header.PageID]]
+	f.latch.Lock()
+	f.writer = owner
+	f.writeHolds = 1
+	return page, nil
+}
+
+// 释放owner的一次写闩并取消固定，isDirty为true时标记为脏页。
+// 最后一次放开时页面还有没写入日志的修改，owner继续持有它，写完日志后由releaseWrites放开
+func (bpm *BufferPoolManager) UnpinPageWrite(pageID uint32, owner *latchOwner, isDirty bool) error {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+	frameID, ok := bpm.pageTable[pageID]
+	if !ok {
+		return ErrPageNotInBuf
+	}
+	f := bpm.frames[frameID]
+	if f.writer != owner || f.writeHolds == 0 {
+		return fmt.Errorf("页面 %d 没有加写闩", pageID)
+	}
+	if isDirty {
+		f.page.Header.SetDirty(true)
+	}
+	if f.writeHolds == 1 && !f.kept && bpm.isUnlogged(f) {
+		f.writeHolds = 0
+		f.kept = true
+		owner.modified = append(owner.modified, pageID)
+		return nil
+	}
+	err := bpm.unpin(f, false)
+	f.writeHolds--
+	if f.writeHolds == 0 && !f.kept {
+		f.writer = nil
+		f.latch.Unlock()
+	}
+	return err
+}
+
+// 修改已经写入日志，放开owner保留的页面
+func (bpm *BufferPoolManager) releaseWrites(owner *latchOwner) {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+	for _, pageID := range owner.modified {
+		frameID, ok := bpm.pageTable[pageID]
+		if !ok {
+			continue
+		}
+		f := bpm.frames[frameID]
+		if f.writer != owner || !f.kept {
+			continue
+		}
+		f.kept = false
+		bpm.unpin(f, false)
+		if f.writeHolds == 0 {
+			f.writer = nil
+			f.latch.Unlock()
+		}
+	}
+	owner.modified = owner.modified[:0]
+}
+
+// 分配一个新页面并固定在缓冲池中
+func (bpm *BufferPoolManager) NewPage(pageType uint32) (*Page.Page, error) {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+
+	frameID, err := bpm.getVictimFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := bpm.pageManager.CreatePage(pageType)
+	if err != nil {
+		bpm.freeFrames = append(bpm.freeFrames, frameID)
+		return nil, err
+	}
+	page.Header.SetDirty(true)
+
+	bpm.install(frameID, page)
+	return page, nil
+}
+
+// 取消固定页面，isDirty为true时标记为脏页
+func (bpm *BufferPoolManager) UnpinPage(pageID uint32, isDirty bool) error {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+
+	frameID, ok := bpm.pageTable[pageID]
+	if !ok {
+		return ErrPageNotInBuf
+	}
+	return bpm.unpin(bpm.frames[frameID], isDirty)
+}
+
+// 将页面写回磁盘
+func (bpm *BufferPoolManager) FlushPage(pageID uint32) error {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+
+	frameID, ok := bpm.pageTable[pageID]
+	if !ok {
+		return ErrPageNotInBuf
+	}
+	return bpm.flushFrame(bpm.frames[frameID])
+}
+
+// 将所有脏页写回磁盘
+func (bpm *BufferPoolManager) FlushAll() error {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+
+	if bpm.logManager != nil {
+		if err := bpm.logManager.FlushAll(); err != nil {
+			return err
+		}
+	}
+	for _, frameID := range bpm.pageTable {
+		if err := bpm.flushFrame(bpm.frames[frameID]); err != nil {
+			return err
+		}
+	}
+	return bpm.pageManager.Flush()
+}
+
+// 从缓冲池中删除页面并释放
+func (bpm *BufferPoolManager) DeletePage(pageID uint32) error {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+
+	frameID, ok := bpm.pageTable[pageID]
+	if !ok {
+		page, err := bpm.pageManager.GetPage(pageID)
+		if err != nil {
+			return err
+		}
+		return bpm.pageManager.DisposePage(page)
+	}
+
+	f := bpm.frames[frameID]
+	// 调用方持有写闩时，其他固定只能来自正在尝试加闩的读操作，等它们放弃
+	for f.writer != nil && f.pinCount > f.ownPins() {
+		bpm.unpinned.Wait()
+	}
+	// 调用方自己持有的一次固定（或者全部写闩对应的固定）允许删除
+	if f.pinCount > 1 && f.pinCount > f.ownPins() {
+		return ErrPagePinned
+	}
+	bpm.replacer.Remove(pageID)
+	page := f.page
+	delete(bpm.pageTable, pageID)
+	f.page = nil
+	f.pinCount = 0
+	f.dirty = false
+	f.recLSN = 0
+	if f.writer != nil {
+		f.writer.forget(pageID)
+		f.writer = nil
+		f.writeHolds = 0
+		f.kept = false
+		f.latch.Unlock()
+	}
+	bpm.freeFrames = append(bpm.freeFrames, frameID)
+
+	page.Header.SetDirty(false)
+	return bpm.pageManager.DisposePage(page)
+}
+
+// 获取页面的固定次数，不在缓冲池中返回0
+func (bpm *BufferPoolManager) GetPinCount(pageID uint32) int {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+
+	frameID, ok := bpm.pageTable[pageID]
+	if !ok {
+		return 0
+	}
+	return bpm.frames[frameID].pinCount
+}
+
+// 获取缓冲池大小
+func (bpm *BufferPoolManager) GetPoolSize() int {
+	return len(bpm.frames)
+}
+
+// 获取命中、未命中和淘汰计数
+func (bpm *BufferPoolManager) GetStats() replacer.Stats {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+	return bpm.stats
+}
+
+// 清零统计计数
+func (bpm *BufferPoolManager) ResetStats() {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+	bpm.stats = replacer.Stats{Policy: bpm.replacer.Policy()}
+}
+
+// 把owner保留的页面镜像加入日志记录，返回加入的页面。
+// withDeferred为true时把元数据页等延迟写回的镜像一起加入，只有持有结构闩的操作会修改它们
+func (bpm *BufferPoolManager) addImages(record *Transaction.LogRecord, owner *latchOwner, withDeferred bool) ([]uint32, error) {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+
+	var pageIDs []uint32
+	for _, pageID := range owner.modified {
+		frameID, ok := bpm.pageTable[pageID]
+		if !ok {
+			continue
+		}
+		f := bpm.frames[frameID]
+		if f.writer != owner || !bpm.isUnlogged(f) {
+			continue
+		}
+		data, err := f.page.SerializeTo()
+		if err != nil {
+			return nil, err
+		}
+		record.AddPage(pageID, data)
+		pageIDs = append(pageIDs, pageID)
+	}
+	if withDeferred {
+		if err := bpm.pageManager.addUnloggedImages(record); err != nil {
+			return nil, err
+		}
+	}
+	return pageIDs, nil
+}
+
+// 页面的修改已经写入日志：记下LSN，页面等待写回并且可以被淘汰
+func (bpm *BufferPoolManager) markLogged(pageIDs []uint32, lsn uint64, withDeferred bool) {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+
+	for _, pageID := range pageIDs {
+		frameID, ok := bpm.pageTable[pageID]
+		if !ok {
+			continue
+		}
+		f := bpm.frames[frameID]
+		if !f.dirty {
+			f.recLSN = lsn
+		}
+		f.page.Header.LSN = lsn
+		f.page.Header.SetDirty(false)
+		f.dirty = true
+		if f.pinCount == 0 {
+			bpm.replacer.SetEvictable(pageID, true)
+		}
+	}
+	if withDeferred {
+		bpm.pageManager.markLogged(lsn)
+	}
+}
+
+// 脏页表：页ID -> 第一条还没写回的修改的日志，包括延迟写回的元数据页等
+func (bpm *BufferPoolManager) dirtyPageTable() map[uint32]uint64 {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+
+	dirtyPages := make(map[uint32]uint64)
+	for pageID, frameID := range bpm.pageTable {
+		if f := bpm.frames[frameID]; f.dirty {
+			dirtyPages[pageID] = f.recLSN
+		}
+	}
+	bpm.pageManager.addDirtyPages(dirtyPages)
+	return dirtyPages
+}
+
+// 写回recLSN早于lsn的脏页，热点页面一直不被淘汰，检查点靠它推进重做的起点。
+// 写回页面前日志先写到页面的LSN
+func (bpm *BufferPoolManager) flushOlderThan(lsn uint64) error {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+
+	for _, frameID := range bpm.pageTable {
+		f := bpm.frames[frameID]
+		if !f.dirty || f.recLSN >= lsn || bpm.isUnlogged(f) {
+			continue
+		}
+		if err := bpm.flushFrame(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 写回延迟写入的元数据页、文件头和释放的页面，它们很小，但是修改频繁
+func (bpm *BufferPoolManager) flushDeferred() error {
+	bpm.mutex.Lock()
+	defer bpm.mutex.Unlock()
+
+	if bpm.logManager != nil {
+		if err := bpm.logManager.FlushAll(); err != nil {
+			return err
+		}
+	}
+	return bpm.pageManager.Flush()
+}
+
+// 页面有没有写入日志的修改
+func (bpm *BufferPoolManager) isUnlogged(f *frame) bool {
+	return bpm.logManager != nil && f.page.Header.IsDirtyPage()
+}
+
+// 获取页面并固定，调用方持有mutex
+func (bpm *BufferPoolManager) fetch(pageID uint32) (*frame, error) {
+	// 1. 命中缓冲池
+	if frameID, ok := bpm.pageTable[pageID]; ok {
+		bpm.stats.Hits++
+		bpm.pin(bpm.frames[frameID])
+		return bpm.frames[frameID], nil
+	}
+
+	// 2. 未命中，找一个可用的帧
+	bpm.stats.Misses++
+	frameID, err := bpm.getVictimFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 从磁盘读取页面
+	page, err := bpm.pageManager.GetPage(pageID)
+	if err != nil {
+		bpm.freeFrames = append(bpm.freeFrames, frameID)
+		return nil, err
+	}
+
+	bpm.install(frameID, page)
+	return bpm.frames[frameID], nil
+}
+
+// 取消固定，调用方持有mutex
+func (bpm *BufferPoolManager) unpin(f *frame, isDirty bool) error {
+	pageID := f.pageID
+	if f.pinCount <= 0 {
+		return fmt.Errorf("页面 %d 未被固定", pageID)
+	}
+	if isDirty {
+		f.page.Header.SetDirty(true)
+	}
+	f.pinCount--
+	if f.pinCount == 0 && !bpm.isUnlogged(f) {
+		bpm.replacer.SetEvictable(pageID, true)
+	}
+	bpm.unpinned.Broadcast()
+	return nil
+}
+
+// 持有写闩的一方自己的固定次数
+func (f *frame) ownPins() int {
+	if f.kept {
+		return f.writeHolds + 1
+	}
+	return f.writeHolds
+}
+
+// 页面被删除，不再由owner保留
+func (owner *latchOwner) forget(pageID uint32) {
+	for i, id := range owner.modified {
+		if id == pageID {
+			owner.modified = append(owner.modified[:i], owner.modified[i+1:]...)
+			return
+		}
+	}
+}
+
+func (bpm *BufferPoolManager) pin(f *frame) {
+	pageID := f.pageID
+	bpm.replacer.RecordAccess(pageID)
+	bpm.replacer.SetEvictable(pageID, false)
+	f.pinCount++
+}
+
+// 将页面放入帧中并固定
+func (bpm *BufferPoolManager) install(frameID int, page *Page.Page) {
+	f := bpm.frames[frameID]
+	f.page = page
+	f.pageID = page.Header.PageID
+	f.pinCount = 0
+	f.dirty = false
+	f.recLSN = 0
+	bpm.pageTable[page.Header.PageID] = frameID
+	bpm.pin(f)
+}
+
+// 找一个可用的帧：优先使用空闲帧，否则由置换器选出一个页面淘汰
+func (bpm *BufferPoolManager) getVictimFrame() (int, error) {
+	if n := len(bpm.freeFrames); n > 0 {
+		frameID := bpm.freeFrames[n-1]
+		bpm.freeFrames = bpm.freeFrames[:n-1]
+		return frameID, nil
+	}
+
+	victimID, ok := bpm.replacer.Evict()
+	if !ok {
+		return 0, ErrNoFreeFrame
+	}
+	frameID := bpm.pageTable[victimID]
+	f := bpm.frames[frameID]
+
+	// 脏页先写回
+	if err := bpm.flushFrame(f); err != nil {
+		bpm.replacer.Restore(victimID)
+		return 0, err
+	}
+	bpm.stats.Evictions++
+	delete(bpm.pageTable, victimID)
+	f.page = nil
+	return frameID, nil
+}
+
+func (bpm *BufferPoolManager) flushFrame(f *frame) error {
+	if f.page == nil || !(f.dirty || f.page.Header.IsDirtyPage()) {
+		return nil
+	}
+	if bpm.logManager != nil {
+		if f.page.Header.IsDirtyPage() {
+			return fmt.Errorf("%w: 页面 %d", ErrPageNotLogged, f.page.Header.PageID)
+		}
+		// 先写日志，再写数据页
+		if err := bpm.logManager.Flush(f.page.Header.LSN); err != nil {
+			return err
+		}
+		if err := bpm.pageManager.UpdatePage(f.page); err != nil {
+			return err
+		}
+		f.dirty = false
+		f.recLSN = 0
+		return nil
+	}
+	f.page.Header.SetDirty(false)
+	if err := bpm.pageManager.UpdatePage(f.page); err != nil {
+		f.page.Header.SetDirty(true)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+	"wudb/Entity/Page"
+	"wudb/Storage/replacer"
+)
+
+// 统计缓冲池中仍被固定的帧数
+func pinnedFrameCount(bpm *BufferPoolManager) int {
+	count := 0
+	for _, f := range bpm.frames {
+		if f.page != nil && f.pinCount > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// 测试命中缓冲池时返回同一个页面对象
+func TestBufferPoolManager_FetchHit(t *testing.T) {
+	pm, _, cleanup := setupPageManagerTest(t)
+	defer cleanup()
+
+	bpm := NewBufferPoolManager(pm, 4)
+	page, err := bpm.NewPage(Page.LeafPageID)
+	if err != nil {
+		t.Fatalf("创建页面失败: %v", err)
+	}
+	pageID := page.Header.PageID
+	if err := bpm.UnpinPage(pageID, false); err != nil {
+		t.Fatalf("取消固定失败: %v", err)
+	}
+
+	fetched, err := bpm.FetchPage(pageID)
+	if err != nil {
+		t.Fatalf("获取页面失败: %v", err)
+	}
+	if fetched != page {
+		t.Error("命中缓冲池时应返回同一个页面")
+	}
+	if bpm.GetPinCount(pageID) != 1 {
+		t.Errorf("固定次数不正确: 期望 1, 实际 %d", bpm.GetPinCount(pageID))
+	}
+	bpm.UnpinPage(pageID, false)
+	if err := bpm.UnpinPage(pageID, false); err == nil {
+		t.Error("重复取消固定应该返回错误")
+	}
+}
+
+// 测试淘汰脏页时写回磁盘
+func TestBufferPoolManager_EvictDirtyPage(t *testing.T) {
+	pm, _, cleanup := setupPageManagerTest(t)
+	defer cleanup()
+
+	bpm := NewBufferPoolManager(pm, 2)
+	page, err := bpm.NewPage(Page.LeafPageID)
+	if err != nil {
+		t.Fatalf("创建页面失败: %v", err)
+	}
+	pageID := page.Header.PageID
+	testKey := []byte("dirty")
+	if err := page.WriteData(0, testKey); err != nil {
+		t.Fatalf("写入Key失败: %v", err)
+	}
+	bpm.UnpinPage(pageID, true)
+
+	// 创建更多页面，迫使第一个页面被淘汰
+	for i := 0; i < 2; i++ {
+		p, err := bpm.NewPage(Page.LeafPageID)
+		if err != nil {
+			t.Fatalf("创建页面失败: %v", err)
+		}
+		bpm.UnpinPage(p.Header.PageID, false)
+	}
+	if _, ok := bpm.pageTable[pageID]; ok {
+		t.Fatal("页面应该已被淘汰")
+	}
+
+	// 直接从磁盘读取，验证脏页已写回
+	onDisk, err := pm.GetPage(pageID)
+	if err != nil {
+		t.Fatalf("读取页面失败: %v", err)
+	}
+	readKey, _ := onDisk.ReadData(0, uint32(len(testKey)))
+	if string(readKey) != string(testKey) {
+		t.Error("脏页没有被写回磁盘")
+	}
+	if onDisk.Header.IsDirtyPage() {
+		t.Error("写回磁盘的页面不应带有脏页标记")
+	}
+}
+
+// 测试所有帧都被固定时无法获取新页面
+func TestBufferPoolManager_AllPinned(t *testing.T) {
+	pm, _, cleanup := setupPageManagerTest(t)
+	defer cleanup()
+
+	bpm := NewBufferPoolManager(pm, 2)
+	for i := 0; i < 2; i++ {
+		if _, err := bpm.NewPage(Page.LeafPageID); err != nil {
+			t.Fatalf("创建页面失败: %v", err)
+		}
+	}
+	if _, err := bpm.NewPage(Page.LeafPageID); err != ErrNoFreeFrame {
+		t.Errorf("期望 ErrNoFreeFrame, 实际 %v", err)
+	}
+}
+
+// 测试FlushAll后重新打开文件数据仍然存在
+func TestBufferPoolManager_FlushAndReopen(t *testing.T) {
+	rm, fm, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	recordCount := 100
+	for i := 0; i < recordCount; i++ {
+		record := createTestRecord(uint32(i), "value")
+		if err := rm.InsertRecord(record, tx); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+
+	// 操作结束后不应有页面仍被固定
+	if n := pinnedFrameCount(rm.bufferPool); n != 0 {
+		t.Errorf("仍有 %d 个页面被固定", n)
+	}
+
+	// 没有提交的事务在重新打开时会被回滚
+	if err := rm.transactionManager.Commit(tx.TransactionID); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	if err := rm.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	rm.fileHandle.Close()
+
+	handle, err := fm.OpenFile("test_record_manager")
+	if err != nil {
+		t.Fatalf("重新打开文件失败: %v", err)
+	}
+	defer handle.Close()
+	reopened, err := NewRecordManager(handle)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	for i := 0; i < recordCount; i++ {
+		if _, err := reopened.findRecord(createTestRecord(uint32(i), "").GetKey()); err != nil {
+			t.Errorf("重新打开后查找第 %d 条记录失败: %v", i, err)
+		}
+	}
+}
+
+// 测试每种置换策略下的记录读写和统计计数
+func TestBufferPoolManager_ReplacerPolicies(t *testing.T) {
+	for _, policy := range []replacer.Policy{replacer.PolicyLRU, replacer.PolicyClock, replacer.PolicyLRUK, replacer.PolicyARC} {
+		t.Run(string(policy), func(t *testing.T) {
+			rm, _, cleanup := setupRecordManagerTest(t)
+			defer cleanup()
+
+			// 用很小的缓冲池迫使页面被淘汰
+			small, err := NewRecordManagerWithConfig(rm.fileHandle, &Config{PoolSize: 8, ReplacerPolicy: policy})
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			tx := createTestTransaction(t, small)
+			recordCount := 200
+			// 值足够大，使页面数超过缓冲池大小
+			value := strings.Repeat("v", 500)
+			for i := 0; i < recordCount; i++ {
+				if err := small.InsertRecord(createTestRecord(uint32(i), value), tx); err != nil {
+					t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+				}
+			}
+			for i := 0; i < recordCount; i++ {
+				if _, err := small.findRecord(createTestRecord(uint32(i), "").GetKey()); err != nil {
+					t.Errorf("查找第 %d 条记录失败: %v", i, err)
+				}
+			}
+
+			stats := small.GetBufferPoolStats()
+			t.Log(stats)
+			if stats.Policy != policy {
+				t.Errorf("策略不正确: 期望 %s, 实际 %s", policy, stats.Policy)
+			}
+			if stats.Evictions == 0 || stats.Hits == 0 {
+				t.Errorf("统计计数不正确: %v", stats)
+			}
+			if n := pinnedFrameCount(small.bufferPool); n != 0 {
+				t.Errorf("仍有 %d 个页面被固定", n)
+			}
+		})
+	}
+
+	if _, err := NewBufferPoolManagerWithPolicy(nil, 4, "MRU"); err == nil {
+		t.Error("未知策略应该返回错误")
+	}
+}
@@ -0,0 +1,362 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"wudb/Entity/Page"
+	"wudb/Entity/Record"
+)
+
+// 批量加载：从已经按键排好序的记录自底向上建树。叶子从左到右按填充因子写满，
+// 再逐层建立内部节点，最后写一次元数据页。写好的页面镜像随时写入日志，
+// 缓冲池不会被占满；加载不属于任何事务，元数据页写入之前崩溃时已经写好的页面不会被引用
+
+const (
+	ErrTreeNotEmpty    = Error("B+树中已经有记录，不能批量加载")
+	ErrUnsortedRecords = Error("批量加载的记录没有按键严格递增排列")
+)
+
+// 批量加载的记录来源，按键严格递增的顺序返回记录，没有更多记录时返回io.EOF
+type RecordSource interface {
+	Next() (*Record.Record, error)
+}
+
+type sliceSource struct {
+	records []*Record.Record
+}
+
+// 按顺序返回切片中的记录
+func NewSliceSource(records []*Record.Record) RecordSource {
+	return &sliceSource{records: records}
+}
+
+func (s *sliceSource) Next() (*Record.Record, error) {
+	if len(s.records) == 0 {
+		return nil, io.EOF
+	}
+	record := s.records[0]
+	s.records = s.records[1:]
+	return record, nil
+}
+
+// 把source中的记录批量加载到空的B+树中，每个页面按fillFactor填充，fillFactor为0时使用树的填充因子。
+// 记录没有按键严格递增排列时返回错误，已经写好的页面全部释放，树保持为空
+func (rm *RecordManager) BulkLoad(source RecordSource, fillFactor float64) error {
+	if fillFactor != 0 {
+		if err := checkFillFactor(fillFactor); err != nil {
+			return err
+		}
+	}
+
+	// 加载时没有其他写操作，整个加载是一个持有结构闩的操作
+	rm.opLatch.Lock()
+	defer rm.opLatch.Unlock()
+	op := rm.newOperation()
+	op.lockStructure()
+	defer op.finish()
+	meta, err := rm.pageManager.GetMetaPage()
+	if err != nil {
+		return err
+	}
+	if fillFactor == 0 {
+		fillFactor = rm.fillFactor()
+	}
+	oldRootPageID, err := rm.emptyRootPageID(meta)
+	if err != nil {
+		return err
+	}
+
+	loader := &bulkLoader{rm: rm, op: op, limit: int(fillFactor * Page.DataAreaSize)}
+	level, err := loader.buildLeaves(source)
+	if err != nil {
+		return loader.discard(err)
+	}
+	if len(level) == 0 {
+		return nil
+	}
+	firstPageID, height := level[0].pageID, uint32(1)
+	for len(level) > 1 {
+		if level, err = loader.buildInternalLevel(level); err != nil {
+			return loader.discard(err)
+		}
+		height++
+	}
+	return rm.installTree(meta, level[0].pageID, firstPageID, height, oldRootPageID, op)
+}
+
+// 检查B+树是空的，返回需要替换掉的空根节点，还没有初始化时返回0
+func (rm *RecordManager) emptyRootPageID(meta *Page.PageBPlusTree) (uint32, error) {
+	if meta.RootPageID == 0 {
+		return 0, nil
+	}
+	root, err := rm.bufferPool.FetchPageRead(meta.RootPageID)
+	if err != nil {
+		return 0, err
+	}
+	defer rm.bufferPool.UnpinPageRead(meta.RootPageID)
+	if root.Header.PageType != Page.LeafPageID || root.Header.RecordCount != 0 {
+		return 0, ErrTreeNotEmpty
+	}
+	return meta.RootPageID, nil
+}
+
+// 用建好的树替换空树，写入元数据页并把日志落盘
+func (rm *RecordManager) installTree(meta *Page.PageBPlusTree, rootPageID, firstPageID, height, oldRootPageID uint32, op *operation) error {
+	rm.rootLatch.Lock()
+	defer rm.rootLatch.Unlock()
+	if oldRootPageID != 0 {
+		// 持有rootLatch时不会有新的读操作到达旧的根节点，等已经到达的读操作离开
+		if _, err := op.fetchPage(oldRootPageID); err != nil {
+			return err
+		}
+	}
+	meta.RootPageID = rootPageID
+	meta.FirstPageID = firstPageID
+	meta.TreeHeight = height
+	if err := rm.pageManager.WriteMetaPage(); err != nil {
+		return err
+	}
+	if oldRootPageID != 0 {
+		if err := rm.bufferPool.DeletePage(oldRootPageID); err != nil {
+			return err
+		}
+	}
+	if _, err := op.log(nil); err != nil {
+		return err
+	}
+	return rm.transactionManager.GetLogManager().FlushAll()
+}
+
+// 下一层的一个页面和其中的最小键
+type bulkEntry struct {
+	key    []byte
+	pageID uint32
+}
+
+type bulkLoader struct {
+	rm      *RecordManager
+	op      *operation
+	limit   int      // 每个页面按填充因子最多使用的字节数
+	pageIDs []uint32 // 已经写好的页面，加载失败时释放
+}
+
+// 从左到右写满叶子并连成链表，返回每个叶子和它的最小键
+func (l *bulkLoader) buildLeaves(source RecordSource) ([]bulkEntry, error) {
+	var leaves []bulkEntry
+	var page *Page.Page
+	var lastKey []byte
+	used := 0
+	defer func() {
+		if page != nil {
+			l.finishPage(page)
+		}
+	}()
+	for {
+		record, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取记录失败: %v", err)
+		}
+		key := record.GetKey()
+		if err := checkKeySize(key); err != nil {
+			return nil, err
+		}
+		if lastKey != nil && bytes.Compare(key, lastKey) <= 0 {
+			return nil, fmt.Errorf("%w: 键 %q 不大于前一个键 %q", ErrUnsortedRecords, key, lastKey)
+		}
+		lastKey = append(lastKey[:0], key...)
+
+		stored, err := l.rm.spillRecord(record, l.op)
+		if err != nil {
+			return nil, err
+		}
+		size := recordSize(stored)
+		if page == nil || used+size > l.limit {
+			next, err := l.newPage(Page.LeafPageID)
+			if err != nil {
+				l.rm.freeOverflow(stored, l.op)
+				return nil, err
+			}
+			if page != nil {
+				page.Header.NextPageID = next.Header.PageID
+				next.Header.PrevPageID = page.Header.PageID
+				if err := l.finishPage(page); err != nil {
+					page = next
+					l.rm.freeOverflow(stored, l.op)
+					return nil, err
+				}
+			}
+			page, used = next, 0
+			leaves = append(leaves, bulkEntry{key: append([]byte(nil), key...), pageID: page.Header.PageID})
+		}
+		if err := page.InsertRecord(stored); err != nil {
+			l.rm.freeOverflow(stored, l.op)
+			return nil, err
+		}
+		used += size
+	}
+	if page != nil {
+		err := l.finishPage(page)
+		page = nil
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := l.rebalanceLastLeaf(leaves); err != nil {
+		return nil, err
+	}
+	_, err := l.op.log(nil)
+	return leaves, err
+}
+
+// 最后一个叶子太空时和前一个叶子按字节数平分记录
+func (l *bulkLoader) rebalanceLastLeaf(leaves []bulkEntry) error {
+	if len(leaves) < 2 {
+		return nil
+	}
+	// 新建的页面还没有被引用，加闩的顺序无关紧要
+	last := &leaves[len(leaves)-1]
+	page, err := l.op.fetchPage(last.pageID)
+	if err != nil {
+		return err
+	}
+	if !page.IsUnderflow() {
+		return l.op.unpinPage(last.pageID, false)
+	}
+	defer l.op.unpinPage(last.pageID, true)
+	prevPageID := leaves[len(leaves)-2].pageID
+	prev, err := l.op.fetchPage(prevPageID)
+	if err != nil {
+		return err
+	}
+	defer l.op.unpinPage(prevPageID, true)
+
+	prevRecords, err := prev.GetAllRecords()
+	if err != nil {
+		return err
+	}
+	records, err := page.GetAllRecords()
+	if err != nil {
+		return err
+	}
+	records = append(prevRecords, records...)
+	mid := splitIndex(recordSizes(records))
+	if err := fillLeafPage(prev, records[:mid]); err != nil {
+		return err
+	}
+	if err := fillLeafPage(page, records[mid:]); err != nil {
+		return err
+	}
+	last.key = append([]byte(nil), records[mid].Key...)
+	return nil
+}
+
+// 把下一层的页面按填充因子分组，每组建立一个内部节点，返回这一层的节点和它们的最小键
+func (l *bulkLoader) buildInternalLevel(children []bulkEntry) ([]bulkEntry, error) {
+	var level []bulkEntry
+	for _, group := range l.groupChildren(children) {
+		page, err := l.newPage(Page.InternalPageID)
+		if err != nil {
+			return nil, err
+		}
+		// 第一个子节点的最小键上移到父节点，其余子节点各对应一条内部记录
+		for i := 1; i < len(group); i++ {
+			record := Record.NewInternalRecord(*Record.NewRecordHeader(), group[i].key, group[i-1].pageID, group[i].pageID)
+			if err = page.InsertInternalRecord(record); err != nil {
+				break
+			}
+		}
+		if finishErr := l.finishPage(page); err == nil {
+			err = finishErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		level = append(level, bulkEntry{key: group[0].key, pageID: page.Header.PageID})
+	}
+	return level, nil
+}
+
+// 按字节数分组，每组至少两个子节点。最后一组太小时和前一组合并后重新平分
+func (l *bulkLoader) groupChildren(children []bulkEntry) [][]bulkEntry {
+	var groups [][]bulkEntry
+	start, used := 0, 0
+	for i := 1; i < len(children); i++ {
+		size := internalRecordSize(children[i].key)
+		if used+size > l.limit && i-start >= 2 {
+			groups = append(groups, children[start:i])
+			start, used = i, 0
+			continue
+		}
+		used += size
+	}
+	groups = append(groups, children[start:])
+
+	n := len(groups)
+	if n < 2 || len(groups[n-1]) >= 2 && used >= Page.DataAreaSize/4 {
+		return groups
+	}
+	merged := children[len(children)-len(groups[n-2])-len(groups[n-1]):]
+	if len(merged) < 4 {
+		return append(groups[:n-2], merged)
+	}
+	sizes := make([]int, len(merged))
+	for i, child := range merged {
+		sizes[i] = internalRecordSize(child.key)
+	}
+	mid := splitIndex(sizes)
+	if mid < 2 {
+		mid = 2
+	} else if mid > len(merged)-2 {
+		mid = len(merged) - 2
+	}
+	return append(groups[:n-2], merged[:mid], merged[mid:])
+}
+
+// 内部记录在页面中占用的字节数，包括槽
+func internalRecordSize(key []byte) int {
+	return Record.RecordHeaderSize + len(key) + Record.PointerSize + Page.SlotEntrySize
+}
+
+// 分配一个新页面并加写闩，记下它以便失败时释放
+func (l *bulkLoader) newPage(pageType uint32) (*Page.Page, error) {
+	page, err := l.op.newPage(pageType)
+	if err != nil {
+		return nil, err
+	}
+	l.pageIDs = append(l.pageIDs, page.Header.PageID)
+	return page, nil
+}
+
+// 写好一个页面：放开写闩，把镜像写入日志，之后页面可以被淘汰
+func (l *bulkLoader) finishPage(page *Page.Page) error {
+	if err := l.op.unpinPage(page.Header.PageID, true); err != nil {
+		return err
+	}
+	_, err := l.op.log(nil)
+	return err
+}
+
+// 加载失败时释放已经写好的页面和叶子中记录的溢出页，返回原来的错误
+func (l *bulkLoader) discard(cause error) error {
+	for _, pageID := range l.pageIDs {
+		page, err := l.op.fetchPage(pageID)
+		if err != nil {
+			continue
+		}
+		if page.Header.PageType == Page.LeafPageID {
+			records, _ := page.GetAllRecords()
+			for _, record := range records {
+				l.rm.freeOverflow(record, l.op)
+			}
+		}
+		if err := l.rm.bufferPool.DeletePage(pageID); err != nil {
+			l.op.unpinPage(pageID, false)
+		}
+	}
+	l.op.log(nil)
+	return cause
+}
@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"wudb/Entity/Page"
+	"wudb/Entity/Record"
+)
+
+// 键为0, 2, 4, ...的有序记录
+func sortedTestRecords(count int) []*Record.Record {
+	records := make([]*Record.Record, count)
+	for i := range records {
+		records[i] = createTestRecord(uint32(i*2), fmt.Sprintf("value-%d", i*2))
+	}
+	return records
+}
+
+// 测试批量加载建出的树：页面按填充因子写满，查询、之后的插入删除和崩溃恢复都正常
+func TestBulkLoad_BuildTree(t *testing.T) {
+	rm, fm, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	count := 20000
+	if err := rm.BulkLoad(NewSliceSource(sortedTestRecords(count)), 0.9); err != nil {
+		t.Fatalf("批量加载失败: %v", err)
+	}
+	meta := rm.pageManager.metaPage
+	if meta.TreeHeight < 3 {
+		t.Errorf("树高度应该至少为3, 实际 %d", meta.TreeHeight)
+	}
+
+	// 除了最后两个叶子，每个叶子都填到填充因子附近；最后一个叶子不会太空
+	var leaves []*Page.Page
+	for pageID := meta.FirstPageID; pageID != 0; {
+		page, err := rm.bufferPool.FetchPageRead(pageID)
+		if err != nil {
+			t.Fatalf("读取叶子失败: %v", err)
+		}
+		copied := *page
+		leaves = append(leaves, &copied)
+		rm.bufferPool.UnpinPageRead(pageID)
+		pageID = copied.Header.NextPageID
+	}
+	limit := 0.9 * Page.DataAreaSize
+	for i, leaf := range leaves[:len(leaves)-2] {
+		if used := float64(leaf.UsedSpace()); used > limit || used < limit-100 {
+			t.Fatalf("第 %d 个叶子的填充不正确: %v 字节", i, used)
+		}
+	}
+	if leaves[len(leaves)-1].IsUnderflow() {
+		t.Error("最后一个叶子太空")
+	}
+
+	// 正向和反向都能读到全部记录
+	records, err := rm.rangeQuery(createTestKey(0), createTestKey(1<<20))
+	if err != nil || len(records) != count {
+		t.Fatalf("范围查询失败: 读到 %d 条记录, %v", len(records), err)
+	}
+	for i, record := range records {
+		if keyOf(record.GetKey()) != uint32(i*2) || string(record.Value) != fmt.Sprintf("value-%d", i*2) {
+			t.Fatalf("第 %d 条记录不正确", i)
+		}
+	}
+	tx := createTestTransaction(t, rm)
+	reversed, err := rm.Scan(KeyRange{Unbounded(), Unbounded()}, ScanOptions{Descending: true}, tx)
+	if err != nil || len(reversed) != count {
+		t.Fatalf("降序查询失败: 读到 %d 条记录, %v", len(reversed), err)
+	}
+
+	// 插入奇数键、删除一部分偶数键，树结构保持正确
+	for i := 1; i < 2000; i += 2 {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "inserted"), tx); err != nil {
+			t.Fatalf("插入记录 %d 失败: %v", i, err)
+		}
+	}
+	for i := 0; i < 4000; i += 4 {
+		if err := rm.DeleteRecord(createTestKey(uint32(i)), tx); err != nil {
+			t.Fatalf("删除记录 %d 失败: %v", i, err)
+		}
+	}
+	if err := rm.Commit(tx); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+
+	// 加载的页面镜像写入了日志，崩溃后可以恢复。插入和删除的记录一样多
+	reopened := crashAndReopen(t, rm, fm, nil)
+	checkRecords(t, reopened, 1, 2, "inserted", count)
+	if record, err := reopened.findRecord(createTestKey(39998)); err != nil || string(record.Value) != "value-39998" {
+		t.Errorf("最后一条加载的记录不正确: %v", err)
+	}
+	if _, err := reopened.findRecord(createTestKey(4)); err != ErrNotFound {
+		t.Errorf("删除的记录不应该存在: %v", err)
+	}
+}
+
+// 测试无序的输入被拒绝并释放已经写好的页面，以及只能加载到空树中
+func TestBulkLoad_Reject(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	// 后半部分有重复的键
+	records := sortedTestRecords(3000)
+	records = append(records, createTestRecord(5998, "duplicate"))
+	err := rm.BulkLoad(NewSliceSource(records), 1)
+	if !errors.Is(err, ErrUnsortedRecords) {
+		t.Fatalf("无序的输入应该被拒绝: %v", err)
+	}
+	if _, err := rm.findRecord(createTestKey(0)); err != ErrNotFound {
+		t.Errorf("加载失败后树应该是空的: %v", err)
+	}
+	freePages, err := rm.pageManager.GetFreePageIDs()
+	if err != nil || len(freePages) == 0 {
+		t.Errorf("写好的页面应该被释放: %v", err)
+	}
+
+	if err := rm.BulkLoad(NewSliceSource(nil), 0.3); err == nil {
+		t.Error("填充因子太小应该报错")
+	}
+
+	// 插入后删除，只剩空的根节点时可以加载；溢出的值写入溢出页
+	tx := createTestTransaction(t, rm)
+	if err := rm.InsertRecord(createTestRecord(1, "value"), tx); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	if err := rm.DeleteRecord(createTestKey(1), tx); err != nil {
+		t.Fatalf("删除记录失败: %v", err)
+	}
+	if err := rm.Commit(tx); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	largeValue := bytes.Repeat([]byte("v"), 3*Page.PageSize)
+	records = sortedTestRecords(500)
+	records[100].Value = largeValue
+	if err := rm.BulkLoad(NewSliceSource(records), 0); err != nil {
+		t.Fatalf("加载到空树失败: %v", err)
+	}
+	record, err := rm.findRecord(createTestKey(200))
+	if err != nil || !bytes.Equal(record.Value, largeValue) {
+		t.Errorf("溢出的值不正确: %v", err)
+	}
+
+	if err := rm.BulkLoad(NewSliceSource(sortedTestRecords(1)), 0); err != ErrTreeNotEmpty {
+		t.Errorf("不能加载到非空的树中: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"wudb/Transaction"
+)
+
+// 模糊检查点：只在两个操作之间短暂持有写锁，记录活动事务表和脏页表，不等待事务结束。
+// 上一个检查点之前弄脏的页面在这时写回，否则一直留在缓冲池中的页面会让日志无法截断。
+// 恢复从最后一个检查点开始，检查点之前不再需要的日志被截断。
+
+// 做一次检查点，返回检查点日志的LSN
+func (rm *RecordManager) Checkpoint() (uint64, error) {
+	logManager := rm.transactionManager.GetLogManager()
+	rm.CollectGarbage()
+
+	// 等正在执行的写操作写完日志，元数据页等延迟写回的页面只由持有结构闩的操作修改
+	rm.opLatch.Lock()
+	rm.structureLatch.Lock()
+	lsn, checkpoint, err := rm.writeCheckpoint()
+	rm.structureLatch.Unlock()
+	rm.opLatch.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := logManager.Flush(lsn); err != nil {
+		return 0, err
+	}
+	if err := logManager.SetCheckpointLSN(lsn); err != nil {
+		return 0, err
+	}
+	if err := logManager.Truncate(checkpoint.OldestLSN(lsn), rm.archiveLog); err != nil {
+		return 0, fmt.Errorf("截断日志失败: %v", err)
+	}
+	return lsn, nil
+}
+
+// 写回需要写回的页面并写入检查点日志，调用方持有opLatch的写锁和结构闩
+func (rm *RecordManager) writeCheckpoint() (uint64, *Transaction.Checkpoint, error) {
+	logManager := rm.transactionManager.GetLogManager()
+	// 元数据页和文件头修改频繁，顺便写回，否则它们会一直占住旧的日志
+	if err := rm.bufferPool.flushDeferred(); err != nil {
+		return 0, nil, err
+	}
+	// 经过了一个检查点间隔还没写回的脏页
+	if err := rm.bufferPool.flushOlderThan(logManager.GetCheckpointLSN()); err != nil {
+		return 0, nil, err
+	}
+	checkpoint := Transaction.NewCheckpoint()
+	checkpoint.Transactions = rm.transactionManager.ActiveTransactions()
+	checkpoint.DirtyPages = rm.bufferPool.dirtyPageTable()
+	lsn, err := logManager.Append(Transaction.NewCheckpointLogRecord(checkpoint))
+	return lsn, checkpoint, err
+}
+
+// 启动定期检查点
+func (rm *RecordManager) startCheckpointer(interval time.Duration) {
+	rm.stopCheckpoint = make(chan struct{})
+	rm.checkpointDone.Add(1)
+	go func() {
+		defer rm.checkpointDone.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := rm.Checkpoint(); err != nil {
+					log.Printf("定期检查点失败: %v", err)
+				}
+			case <-rm.stopCheckpoint:
+				return
+			}
+		}
+	}()
+}
+
+// 停止定期检查点并等待正在进行的检查点完成
+func (rm *RecordManager) stopCheckpointer() {
+	if rm.stopCheckpoint == nil {
+		return
+	}
+	close(rm.stopCheckpoint)
+	rm.checkpointDone.Wait()
+	rm.stopCheckpoint = nil
+}
@@ -0,0 +1,234 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wudb/Transaction"
+)
+
+// 测试检查点之后截断日志，跨越检查点的未提交事务在崩溃后被回滚
+func TestCheckpoint_RecoverFromCheckpoint(t *testing.T) {
+	rm, fm, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+	logManager := rm.transactionManager.GetLogManager()
+
+	tx1 := createTestTransaction(t, rm)
+	for i := 0; i < 100; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), tx1); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	rm.transactionManager.Commit(tx1.TransactionID)
+	if err := rm.Flush(); err != nil {
+		t.Fatalf("写回失败: %v", err)
+	}
+	// 没有活动事务和脏页，检查点之前的日志都不再需要
+	lsn, err := rm.Checkpoint()
+	if err != nil {
+		t.Fatalf("检查点失败: %v", err)
+	}
+	if logManager.GetBaseLSN() != lsn {
+		t.Errorf("日志应该截断到检查点: 期望 %d, 实际 %d", lsn, logManager.GetBaseLSN())
+	}
+
+	tx2 := Transaction.NewTransaction(2, 3, Transaction.ReadCommitted)
+	for i := 100; i < 150; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "new"), tx2); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	// 有活动事务和脏页时，日志只截断到还需要的位置
+	lsn, err = rm.Checkpoint()
+	if err != nil {
+		t.Fatalf("检查点失败: %v", err)
+	}
+	if logManager.GetBaseLSN() != tx2.BeginLSN {
+		t.Errorf("日志应该保留到活动事务的开始: 期望 %d, 实际 %d", tx2.BeginLSN, logManager.GetBaseLSN())
+	}
+	for i := 0; i < 50; i++ {
+		if err := rm.DeleteRecord(createTestKey(uint32(i)), tx2); err != nil {
+			t.Fatalf("删除第 %d 条记录失败: %v", i, err)
+		}
+	}
+	logManager.FlushAll()
+
+	reopened := crashAndReopen(t, rm, fm, nil)
+	if reopened.transactionManager.GetLogManager().GetCheckpointLSN() != lsn {
+		t.Errorf("重新打开后检查点不正确")
+	}
+	checkRecords(t, reopened, 0, 100, "value", 100)
+}
+
+// 测试截断的日志被归档
+func TestCheckpoint_ArchiveLog(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	archived, err := NewRecordManagerWithConfig(rm.fileHandle, &Config{ArchiveLog: true})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	tx := createTestTransaction(t, archived)
+	for i := 0; i < 10; i++ {
+		archived.InsertRecord(createTestRecord(uint32(i), "value"), tx)
+	}
+	archived.transactionManager.Commit(tx.TransactionID)
+	archived.Flush()
+
+	logManager := archived.transactionManager.GetLogManager()
+	baseLSN := logManager.GetBaseLSN()
+	if _, err := archived.Checkpoint(); err != nil {
+		t.Fatalf("检查点失败: %v", err)
+	}
+	archiveName := Transaction.ArchiveLogFileName(archived.fileHandle.GetFile().Name()+Transaction.LogFileSuffix, baseLSN)
+	if _, err := os.Stat(archiveName); err != nil {
+		t.Errorf("旧日志应该被归档: %v", err)
+	}
+	if err := archived.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+}
+
+// 测试定期检查点
+func TestCheckpoint_Periodic(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	periodic, err := NewRecordManagerWithConfig(rm.fileHandle, &Config{CheckpointInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	tx := createTestTransaction(t, periodic)
+	logManager := periodic.transactionManager.GetLogManager()
+	deadline := time.Now().Add(2 * time.Second)
+	for i := 0; logManager.GetCheckpointLSN() == 0; i++ {
+		if time.Now().After(deadline) {
+			t.Fatal("没有做定期检查点")
+		}
+		// 检查点和写入同时进行
+		if err := periodic.InsertRecord(createTestRecord(uint32(i), "value"), tx); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	if err := periodic.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+}
+
+// 测试反复做检查点时日志不会一直增长：一直留在缓冲池中的脏页也会被写回
+func TestCheckpoint_LogStaysBounded(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+	logFileName := rm.fileHandle.GetFile().Name() + Transaction.LogFileSuffix
+
+	var sizes []int64
+	for round := 0; round < 6; round++ {
+		tx := createTestTransaction(t, rm)
+		for i := 0; i < 500; i++ {
+			key := uint32(round*500 + i)
+			if err := rm.InsertRecord(createTestRecord(key, "value"), tx); err != nil {
+				t.Fatalf("插入第 %d 条记录失败: %v", key, err)
+			}
+		}
+		rm.transactionManager.Commit(tx.TransactionID)
+		if _, err := rm.Checkpoint(); err != nil {
+			t.Fatalf("检查点失败: %v", err)
+		}
+		info, err := os.Stat(logFileName)
+		if err != nil {
+			t.Fatalf("读取日志文件失败: %v", err)
+		}
+		sizes = append(sizes, info.Size())
+	}
+	// 每次检查点之后只剩上一个检查点以来的日志
+	for round := 2; round < len(sizes); round++ {
+		if sizes[round] > 2*sizes[1] {
+			t.Fatalf("日志在检查点之后仍然增长: %v", sizes)
+		}
+	}
+}
+
+// 测试写入一直在进行时反复做检查点，日志文件只保留上一个检查点之后的日志，不随写入总量增长。
+// 写入反复更新同一批记录，它们所在的页面一直留在缓冲池中
+func TestCheckpoint_LogBoundedUnderSteadyWrites(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+	logManager := rm.transactionManager.GetLogManager()
+	logFileName := rm.fileHandle.GetFile().Name() + Transaction.LogFileSuffix
+
+	const keys, perRound, rounds = 200, 100, 20
+	setup := createTestTransaction(t, rm)
+	for k := uint32(0); k < keys; k++ {
+		if err := rm.InsertRecord(createTestRecord(k, "value"), setup); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+	rm.Commit(setup)
+
+	var committed atomic.Int64
+	stop := make(chan struct{})
+	writing := make(chan error, 1)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				writing <- nil
+				return
+			default:
+			}
+			tx, err := rm.Begin(Transaction.ReadCommitted)
+			if err == nil {
+				err = rm.UpdateRecord(createTestRecord(uint32(i%keys), fmt.Sprintf("value-%d", i)), tx)
+			}
+			if err == nil {
+				err = rm.Commit(tx)
+			}
+			if err != nil {
+				writing <- err
+				return
+			}
+			committed.Add(1)
+		}
+	}()
+	defer func() {
+		close(stop)
+		if err := <-writing; err != nil {
+			t.Errorf("写入失败: %v", err)
+		}
+	}()
+
+	var checkpoints []uint64
+	var size int64
+	deadline := time.Now().Add(10 * time.Second)
+	for round := 1; round <= rounds; round++ {
+		for committed.Load() < int64(round*perRound) {
+			if time.Now().After(deadline) {
+				t.Fatalf("写入停止了, 只提交了 %d 个事务", committed.Load())
+			}
+			time.Sleep(time.Millisecond)
+		}
+		lsn, err := rm.Checkpoint()
+		if err != nil {
+			t.Fatalf("第 %d 次检查点失败: %v", round, err)
+		}
+		info, err := os.Stat(logFileName)
+		if err != nil {
+			t.Fatalf("读取日志文件失败: %v", err)
+		}
+		size = info.Size()
+		// 上一个检查点之前的脏页都已经写回，之前的日志都被截断
+		if len(checkpoints) > 0 {
+			kept := int64(Transaction.LogFileHeaderSize) + int64(logManager.GetNextLSN()-checkpoints[len(checkpoints)-1])
+			if size > kept {
+				t.Fatalf("第 %d 次检查点之后日志文件 %d 字节, 上一个检查点之后只写了 %d 字节", round, size, kept)
+			}
+		}
+		checkpoints = append(checkpoints, lsn)
+	}
+	if written := int64(logManager.GetNextLSN() - Transaction.FirstLSN); size*4 > written {
+		t.Errorf("日志文件 %d 字节, 一共写了 %d 字节, 检查点没有截断日志", size, written)
+	}
+}
@@ -0,0 +1,43 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+	"wudb/Storage/replacer"
+)
+
+// 默认每隔多久做一次检查点
+const DefaultCheckpointInterval = 5 * time.Minute
+
+const (
+	DefaultFillFactor = 0.9 // 默认填充因子，给之后的插入留一些空间
+	MinFillFactor     = 0.5 // 最小填充因子，不比平分后的页面更空
+)
+
+// 打开数据库时使用的配置
+type Config struct {
+	PoolSize           int             // 缓冲池帧数
+	ReplacerPolicy     replacer.Policy // 页面置换策略
+	OverflowThreshold  int             // 值超过这个长度时写入溢出页
+	CheckpointInterval time.Duration   // 定期检查点的间隔，0表示只在调用Checkpoint时做检查点
+	ArchiveLog         bool            // 检查点截断日志时保留旧日志文件，否则删除
+	MVCC               bool            // 使用多版本并发控制，读操作读快照而不加共享锁
+	FillFactor         float64         // 页面的目标填充因子，保存在元数据页中，0表示沿用保存的值
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		PoolSize:           DefaultPoolSize,
+		ReplacerPolicy:     replacer.PolicyLRU,
+		OverflowThreshold:  DefaultOverflowThreshold,
+		CheckpointInterval: DefaultCheckpointInterval,
+	}
+}
+
+// 填充因子必须在MinFillFactor到1之间
+func checkFillFactor(fillFactor float64) error {
+	if fillFactor < MinFillFactor || fillFactor > 1 {
+		return fmt.Errorf("填充因子必须在 %.1f 到 1 之间: %v", MinFillFactor, fillFactor)
+	}
+	return nil
+}
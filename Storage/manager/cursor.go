@@ -0,0 +1,335 @@
+package manager
+
+import (
+	"bytes"
+	"wudb/Entity/Page"
+	"wudb/Entity/Record"
+	"wudb/Transaction"
+)
+
+// 游标：沿叶子链表逐条读取记录，只缓存当前叶子中的记录，内存占用不随记录数增长。
+// 游标不持有页面的闩，读完当前叶子后重新给它加读闩，沿兄弟指针移动到相邻的叶子；
+// 当前叶子已经被释放或者不再覆盖读到的键时从读到的键重新下降。
+// 游标属于一个事务：多版本模式下只返回事务快照中的记录，否则按隔离级别对读到的键加锁，
+// 可重复读和可串行化读到最后时还锁住最后一个键之后的间隙。
+// 定位和移动方法返回游标是否指向一条记录，出错时返回false，由Err返回错误
+type Cursor struct {
+	rm      *RecordManager
+	tx      *Transaction.Transaction
+	records []*Record.Record // 当前叶子中缓存的记录，溢出的值已经加载
+	pageID  uint32           // 缓存的记录所在的叶子
+	pos     int
+	err     error
+	closed  bool
+}
+
+// 一次扫描收集到的记录和它们所在的叶子
+type leafRecords struct {
+	records []*Record.Record
+	pageID  uint32
+	last    bool // 扫描方向上没有更多的叶子
+}
+
+// 在事务中创建游标，定位之前不指向任何记录
+func (rm *RecordManager) NewCursor(tx *Transaction.Transaction) *Cursor {
+	return &Cursor{rm: rm, tx: tx, pos: -1}
+}
+
+// 定位到第一个键不小于key的记录
+func (c *Cursor) Seek(key []byte) bool {
+	return c.loadForward(0, key, true)
+}
+
+// 定位到第一条记录
+func (c *Cursor) First() bool {
+	return c.loadForward(0, nil, true)
+}
+
+// 定位到最后一条记录
+func (c *Cursor) Last() bool {
+	return c.loadBackward(0, nil)
+}
+
+// 移动到下一条记录，没有时游标失效
+func (c *Cursor) Next() bool {
+	if !c.Valid() {
+		return false
+	}
+	if c.pos+1 < len(c.records) {
+		c.pos++
+		return true
+	}
+	return c.loadForward(c.pageID, c.Key(), false)
+}
+
+// 移动到上一条记录，没有时游标失效
+func (c *Cursor) Prev() bool {
+	if !c.Valid() {
+		return false
+	}
+	if c.pos > 0 {
+		c.pos--
+		return true
+	}
+	return c.loadBackward(c.pageID, c.Key())
+}
+
+// 游标是否指向一条记录
+func (c *Cursor) Valid() bool {
+	return !c.closed && c.err == nil && c.pos >= 0 && c.pos < len(c.records)
+}
+
+// 当前记录的键，游标失效时返回nil
+func (c *Cursor) Key() []byte {
+	if !c.Valid() {
+		return nil
+	}
+	return c.records[c.pos].GetKey()
+}
+
+// 当前记录的值，游标失效时返回nil。
+// 溢出的值在持有叶子读闩时和叶子中的记录一起加载，之后记录被修改或删除不影响已经读到的值
+func (c *Cursor) Value() []byte {
+	if !c.Valid() {
+		return nil
+	}
+	return c.records[c.pos].Value
+}
+
+// 定位或移动时遇到的错误
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// 关闭游标，释放缓存的记录
+func (c *Cursor) Close() error {
+	c.closed = true
+	c.records = nil
+	return nil
+}
+
+// 从from开始向右找到第一批符合条件的记录并缓存，inclusive为false时只要大于from的记录。
+// pageID不为0时先从缓存的记录所在的叶子继续
+func (c *Cursor) loadForward(pageID uint32, from []byte, inclusive bool) bool {
+	if c.closed {
+		return false
+	}
+	result, err := c.fetchForward(pageID, from, inclusive)
+	return c.load(result, 0, err)
+}
+
+// 从before开始向左找到第一批更小的记录并缓存，before为nil时从最后一条记录开始
+func (c *Cursor) loadBackward(pageID uint32, before []byte) bool {
+	if c.closed {
+		return false
+	}
+	result, err := c.fetchBackward(pageID, before)
+	if err != nil {
+		return c.load(nil, 0, err)
+	}
+	return c.load(result, len(result.records)-1, nil)
+}
+
+// 按事务读取向右的下一批记录。多版本模式下跳过快照中没有记录的叶子；
+// 基于锁的模式下对读到的记录加锁，读到最后时锁住上界
+func (c *Cursor) fetchForward(pageID uint32, from []byte, inclusive bool) (*leafRecords, error) {
+	switch {
+	case c.rm.mvcc:
+		for {
+			// 快照要在读树之前取得
+			snapshot := c.rm.transactionManager.Snapshot(c.tx)
+			result, err := c.readForward(pageID, from, inclusive)
+			if err != nil {
+				return nil, err
+			}
+			covered := KeyRange{Start: Unbounded(), End: Unbounded()}
+			if from != nil {
+				covered.Start = Bound{Key: from, Exclusive: !inclusive}
+			}
+			if !result.last {
+				covered.End = Included(result.records[len(result.records)-1].GetKey())
+			}
+			result.records = c.rm.visibleRecords(c.tx, snapshot, result.records, covered, false)
+			if len(result.records) > 0 || result.last {
+				return result, nil
+			}
+			pageID, from, inclusive = result.pageID, covered.End.Key, false
+		}
+	case c.tx.IsolationLevel == Transaction.ReadUncommitted:
+		return c.readForward(pageID, from, inclusive)
+	default:
+		var result *leafRecords
+		_, err := c.rm.lockRecords(c.tx, func() ([]*Record.Record, []string, error) {
+			var err error
+			if result, err = c.readForward(pageID, from, inclusive); err != nil {
+				return nil, nil, err
+			}
+			if result.last && lockGaps(c.tx) {
+				return result.records, []string{supremumResource}, nil
+			}
+			return result.records, nil, nil
+		})
+		return result, err
+	}
+}
+
+// 按事务读取向左的下一批记录。向左读到的键之间和它们与before之间的间隙由这些键和before上的锁锁住，
+// before为nil时还要锁住上界
+func (c *Cursor) fetchBackward(pageID uint32, before []byte) (*leafRecords, error) {
+	switch {
+	case c.rm.mvcc:
+		for {
+			snapshot := c.rm.transactionManager.Snapshot(c.tx)
+			result, err := c.readBackward(pageID, before)
+			if err != nil {
+				return nil, err
+			}
+			covered := KeyRange{Start: Unbounded(), End: Unbounded()}
+			if before != nil {
+				covered.End = Excluded(before)
+			}
+			if !result.last {
+				covered.Start = Included(result.records[0].GetKey())
+			}
+			result.records = c.rm.visibleRecords(c.tx, snapshot, result.records, covered, false)
+			if len(result.records) > 0 || result.last {
+				return result, nil
+			}
+			pageID, before = result.pageID, covered.Start.Key
+		}
+	case c.tx.IsolationLevel == Transaction.ReadUncommitted:
+		return c.readBackward(pageID, before)
+	default:
+		var result *leafRecords
+		_, err := c.rm.lockRecords(c.tx, func() ([]*Record.Record, []string, error) {
+			var err error
+			if result, err = c.readBackward(pageID, before); err != nil {
+				return nil, nil, err
+			}
+			if before == nil && lockGaps(c.tx) {
+				return result.records, []string{supremumResource}, nil
+			}
+			return result.records, nil, nil
+		})
+		return result, err
+	}
+}
+
+// 不加锁读取树中大于from（inclusive时不小于from）的第一批记录。
+// 叶子pageID仍然覆盖from时从它继续，否则从根节点下降
+func (c *Cursor) readForward(pageID uint32, from []byte, inclusive bool) (*leafRecords, error) {
+	result := &leafRecords{}
+	visit := c.forward(from, inclusive, result)
+	page := c.fetchLeaf(pageID, func(page *Page.Page) bool {
+		return bytes.Compare(page.GetMinKey(), from) <= 0
+	})
+	var err error
+	if page != nil {
+		err = c.rm.scanLeavesFrom(page, from, from, visit)
+	} else {
+		err = c.rm.scanLeaves(from, visit)
+	}
+	return result.finish(err)
+}
+
+// 不加锁读取树中小于before的最后一批记录，before为nil时读最右边的记录
+func (c *Cursor) readBackward(pageID uint32, before []byte) (*leafRecords, error) {
+	result := &leafRecords{}
+	visit := c.backward(result)
+	page := c.fetchLeaf(pageID, func(page *Page.Page) bool {
+		return before != nil && bytes.Compare(page.GetMaxKey(), before) >= 0
+	})
+	var err error
+	if page != nil {
+		err = c.rm.scanLeavesBackwardFrom(page, before, visit)
+	} else {
+		err = c.rm.scanLeavesBackward(before, visit)
+	}
+	return result.finish(err)
+}
+
+// 扫描结束：没有读到记录说明扫描方向上已经没有记录。还没有初始化的数据库没有记录
+func (r *leafRecords) finish(err error) (*leafRecords, error) {
+	if err == ErrNotFound {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(r.records) == 0 {
+		r.last = true
+	}
+	return r, nil
+}
+
+// 向右扫描时收集叶子中大于from（inclusive时不小于from）并且大于扫描过的键的记录，收集到记录后停止
+func (c *Cursor) forward(from []byte, inclusive bool, result *leafRecords) func(page *Page.Page, after []byte) (bool, error) {
+	return func(page *Page.Page, after []byte) (bool, error) {
+		pos := page.UpperBound(from)
+		if inclusive {
+			pos = page.LowerBound(from)
+		}
+		if after != nil {
+			if next := page.UpperBound(after); next > pos {
+				pos = next
+			}
+		}
+		result.last = page.Header.NextPageID == 0
+		return c.collect(page, pos, int(page.Header.RecordCount), result)
+	}
+}
+
+// 向左扫描时收集叶子中小于扫描过的键的记录，收集到记录后停止
+func (c *Cursor) backward(result *leafRecords) func(page *Page.Page, before []byte) (bool, error) {
+	return func(page *Page.Page, before []byte) (bool, error) {
+		end := int(page.Header.RecordCount)
+		if before != nil {
+			end = page.LowerBound(before)
+		}
+		result.last = page.Header.PrevPageID == 0
+		return c.collect(page, 0, end, result)
+	}
+}
+
+// 持有叶子的读闩时读取[start, end)中的记录和溢出的值，返回是否还要继续扫描
+func (c *Cursor) collect(page *Page.Page, start, end int, result *leafRecords) (bool, error) {
+	for pos := start; pos < end; pos++ {
+		stored, err := page.GetRecordAt(uint32(pos))
+		if err != nil {
+			return false, err
+		}
+		record, err := c.rm.loadRecord(stored)
+		if err != nil {
+			return false, err
+		}
+		result.records = append(result.records, record)
+	}
+	result.pageID = page.Header.PageID
+	return len(result.records) == 0, nil
+}
+
+// 给缓存的记录所在的叶子加读闩。它已经被释放、不再是叶子或者不再覆盖游标的位置时返回nil，
+// 由调用方重新下降；仍然覆盖时，游标之后（或之前）的键都在它和它的兄弟中
+func (c *Cursor) fetchLeaf(pageID uint32, covers func(page *Page.Page) bool) *Page.Page {
+	if pageID == 0 {
+		return nil
+	}
+	page, err := c.rm.bufferPool.FetchPageRead(pageID)
+	if err != nil {
+		return nil
+	}
+	if page.Header.PageType == Page.LeafPageID && page.Header.IsDeleted == 0 && page.Header.RecordCount > 0 && covers(page) {
+		return page
+	}
+	c.rm.bufferPool.UnpinPageRead(pageID)
+	return nil
+}
+
+func (c *Cursor) load(result *leafRecords, pos int, err error) bool {
+	if err != nil {
+		c.records, c.pos, c.err = nil, -1, err
+		return false
+	}
+	c.records, c.pageID, c.pos = result.records, result.pageID, pos
+	return c.Valid()
+}
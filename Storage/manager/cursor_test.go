@@ -0,0 +1,261 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"wudb/Entity/Page"
+	"wudb/Entity/Record"
+	"wudb/Transaction"
+)
+
+// 插入键为0, 2, 4, ...的记录，值足够长，记录分布在很多叶子中
+func setupCursorTest(t *testing.T, count int) (*RecordManager, func()) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	tx := createTestTransaction(t, rm)
+	for i := 0; i < count; i++ {
+		k := uint32(i * 2)
+		if err := rm.InsertRecord(createTestRecord(k, fmt.Sprintf("%0200d", k)), tx); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+	if err := rm.Commit(tx); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	return rm, cleanup
+}
+
+// 测试沿叶子链表正向和反向遍历全部记录
+func TestCursor_Iterate(t *testing.T) {
+	rm, cleanup := setupCursorTest(t, 500)
+	defer cleanup()
+
+	cursor := rm.NewCursor(createTestTransaction(t, rm))
+	defer cursor.Close()
+	count := 0
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		k := uint32(count * 2)
+		if keyOf(cursor.Key()) != k || string(cursor.Value()) != fmt.Sprintf("%0200d", k) {
+			t.Fatalf("第 %d 条记录不正确: 键 %d", count, keyOf(cursor.Key()))
+		}
+		count++
+	}
+	if cursor.Err() != nil || count != 500 {
+		t.Fatalf("正向遍历失败: 读到 %d 条记录, %v", count, cursor.Err())
+	}
+	if cursor.Valid() || cursor.Next() {
+		t.Error("遍历结束后游标应该失效")
+	}
+
+	count = 0
+	for ok := cursor.Last(); ok; ok = cursor.Prev() {
+		k := uint32((499 - count) * 2)
+		if keyOf(cursor.Key()) != k {
+			t.Fatalf("反向第 %d 条记录不正确: 期望 %d, 实际 %d", count, k, keyOf(cursor.Key()))
+		}
+		count++
+	}
+	if cursor.Err() != nil || count != 500 {
+		t.Fatalf("反向遍历失败: 读到 %d 条记录, %v", count, cursor.Err())
+	}
+}
+
+// 测试定位到存在的键、两个键之间和所有键之后，以及在定位处前后移动
+func TestCursor_Seek(t *testing.T) {
+	rm, cleanup := setupCursorTest(t, 300)
+	defer cleanup()
+
+	cursor := rm.NewCursor(createTestTransaction(t, rm))
+	if !cursor.Seek(createTestKey(100)) || keyOf(cursor.Key()) != 100 {
+		t.Fatalf("定位到存在的键失败: %v", cursor.Err())
+	}
+	if !cursor.Seek(createTestKey(101)) || keyOf(cursor.Key()) != 102 {
+		t.Fatalf("应该定位到下一个键: %d", keyOf(cursor.Key()))
+	}
+	if !cursor.Prev() || keyOf(cursor.Key()) != 100 {
+		t.Errorf("上一条记录不正确: %d", keyOf(cursor.Key()))
+	}
+	if !cursor.Next() || !cursor.Next() || keyOf(cursor.Key()) != 104 {
+		t.Errorf("下一条记录不正确: %d", keyOf(cursor.Key()))
+	}
+	if cursor.Seek(createTestKey(1000)) {
+		t.Error("所有键之后不应该有记录")
+	}
+	if !cursor.Seek(nil) || keyOf(cursor.Key()) != 0 {
+		t.Error("空键应该定位到第一条记录")
+	}
+	if cursor.Prev() {
+		t.Error("第一条记录之前不应该有记录")
+	}
+
+	cursor.Close()
+	if cursor.First() || cursor.Key() != nil {
+		t.Error("关闭后的游标不能再定位")
+	}
+}
+
+// 测试空树没有记录，溢出的值在读取时加载
+func TestCursor_OverflowValue(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	// 空树中没有记录
+	tx := createTestTransaction(t, rm)
+	cursor := rm.NewCursor(tx)
+	defer cursor.Close()
+	if cursor.First() || cursor.Last() || cursor.Err() != nil {
+		t.Errorf("空树的游标不应该指向记录: %v", cursor.Err())
+	}
+
+	largeValue := bytes.Repeat([]byte("v"), Page.MaxRecordSize)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := rm.InsertRecord(Record.NewRecordByTransaction(0, []byte(key), largeValue), tx); err != nil {
+			t.Fatalf("插入大记录失败: %v", err)
+		}
+	}
+	count := 0
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		if !bytes.Equal(cursor.Value(), largeValue) {
+			t.Errorf("记录 %s 的值不正确", cursor.Key())
+		}
+		count++
+	}
+	if cursor.Err() != nil || count != 3 {
+		t.Errorf("读到 %d 条记录, %v", count, cursor.Err())
+	}
+
+	// 溢出的值在定位时已经读出，之后记录被删除也能读到定位时的值
+	cursor.Seek([]byte("b"))
+	if err := rm.DeleteRecord([]byte("b"), tx); err != nil {
+		t.Fatalf("删除记录失败: %v", err)
+	}
+	if !bytes.Equal(cursor.Value(), largeValue) || cursor.Err() != nil {
+		t.Errorf("定位时读到的值应该保留: %v", cursor.Err())
+	}
+	if !cursor.Next() || string(cursor.Key()) != "c" || !bytes.Equal(cursor.Value(), largeValue) {
+		t.Errorf("下一条记录不正确: %q, %v", cursor.Key(), cursor.Err())
+	}
+}
+
+// 测试游标所在的叶子分裂、被清空合并之后，移动时从兄弟叶子或者重新下降读到正确的记录
+func TestCursor_LeafChanged(t *testing.T) {
+	rm, cleanup := setupCursorTest(t, 300)
+	defer cleanup()
+	tx := createTestTransaction(t, rm)
+
+	// 移动到缓存的最后一条记录，之后在它后面插入奇数键，叶子分裂
+	cursor := rm.NewCursor(tx)
+	defer cursor.Close()
+	cursor.Seek(createTestKey(100))
+	for cursor.pos+1 < len(cursor.records) {
+		cursor.Next()
+	}
+	last := keyOf(cursor.Key())
+	for k := last + 1; k < last+60; k += 2 {
+		if err := rm.InsertRecord(createTestRecord(k, fmt.Sprintf("%0200d", k)), tx); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+	for k := last + 1; k < last+60; k++ {
+		if !cursor.Next() || keyOf(cursor.Key()) != k {
+			t.Fatalf("分裂后下一条记录应该是 %d, 实际 %d, %v", k, keyOf(cursor.Key()), cursor.Err())
+		}
+	}
+
+	// 删除游标所在叶子中的全部记录，叶子被合并，移动时越过删除的记录
+	cursor.Seek(createTestKey(400))
+	first := keyOf(cursor.records[0].GetKey())
+	for _, record := range cursor.records {
+		if err := rm.DeleteRecord(record.GetKey(), tx); err != nil {
+			t.Fatalf("删除记录失败: %v", err)
+		}
+	}
+	for cursor.pos+1 < len(cursor.records) {
+		cursor.Next()
+	}
+	last = keyOf(cursor.Key())
+	if !cursor.Next() || keyOf(cursor.Key()) != last+2 {
+		t.Fatalf("清空的叶子之后应该是 %d, 实际 %d, %v", last+2, keyOf(cursor.Key()), cursor.Err())
+	}
+	for cursor.Prev() && keyOf(cursor.Key()) > last {
+	}
+	if keyOf(cursor.Key()) != first-2 || cursor.Err() != nil {
+		t.Errorf("清空的叶子之前应该是 %d, 实际 %d, %v", first-2, keyOf(cursor.Key()), cursor.Err())
+	}
+}
+
+// 测试写操作分裂和合并叶子时，游标双向遍历仍然按顺序读到不变的记录
+func TestCursor_ConcurrentWriters(t *testing.T) {
+	rm, cleanup := setupCursorTest(t, 400)
+	defer cleanup()
+
+	var writing sync.WaitGroup
+	writing.Add(1)
+	go func() {
+		defer writing.Done()
+		tx := Transaction.NewTransaction(2, 2, Transaction.ReadUncommitted)
+		// 插入奇数键再删除，键是偶数的记录一直存在
+		for round := 0; round < 3; round++ {
+			for k := uint32(1); k < 800; k += 2 {
+				if err := rm.InsertRecord(createTestRecord(k, fmt.Sprintf("%0300d", k)), tx); err != nil {
+					t.Errorf("插入记录失败: %v", err)
+					return
+				}
+			}
+			for k := uint32(1); k < 800; k += 2 {
+				if err := rm.DeleteRecord(createTestKey(k), tx); err != nil {
+					t.Errorf("删除记录失败: %v", err)
+					return
+				}
+			}
+		}
+		rm.Commit(tx)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		writing.Wait()
+		close(done)
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		// 读未提交不加锁，读者不会等写者的事务结束
+		cursor := rm.NewCursor(Transaction.NewTransaction(3, 3, Transaction.ReadUncommitted))
+		var keys []uint32
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			keys = append(keys, keyOf(cursor.Key()))
+		}
+		var reversed []uint32
+		for ok := cursor.Last(); ok; ok = cursor.Prev() {
+			reversed = append(reversed, keyOf(cursor.Key()))
+		}
+		if cursor.Err() != nil {
+			t.Fatalf("遍历失败: %v", cursor.Err())
+		}
+		cursor.Close()
+		checkCursorKeys(t, keys, false)
+		checkCursorKeys(t, reversed, true)
+	}
+}
+
+// 键严格有序，并且包含全部400个偶数键
+func checkCursorKeys(t *testing.T, keys []uint32, descending bool) {
+	t.Helper()
+	even := 0
+	for i, k := range keys {
+		if i > 0 && (keys[i-1] == k || (keys[i-1] < k) == descending) {
+			t.Fatalf("键没有按顺序排列: %d, %d", keys[i-1], k)
+		}
+		if k%2 == 0 {
+			even++
+		}
+	}
+	if even != 400 {
+		t.Fatalf("应该读到全部 400 个不变的记录, 实际 %d", even)
+	}
+}
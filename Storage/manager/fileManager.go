@@ -1,13 +1,13 @@
 package manager
 
 import (
-	"encoding/binary"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 	"wudb/Entity/File"
+	"wudb/Transaction"
 	"wudb/Util"
 )
 
@@ -101,6 +101,14 @@ func (fm *FileManager) DestroyFile(filename string) error {
 				if err := os.Remove(fullPath); err != nil {
 					return fmt.Errorf("删除文件失败: %v", err)
 				}
+				// 日志文件和数据文件一起删除
+				if err := os.Remove(fullPath + Transaction.LogFileSuffix); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("删除日志文件失败: %v", err)
+				}
+				archives, _ := filepath.Glob(fullPath + Transaction.LogFileSuffix + ".*")
+				for _, archive := range archives {
+					os.Remove(archive)
+				}
 				return nil // 找到并删除文件后返回
 			}
 		}
@@ -180,21 +188,12 @@ func (fm *FileManager) InitFileHeader() (*File.FileHeader, error) {
 	return header, nil
 }
 
+// 读取文件开始处的文件头，校验和不一致时返回CorruptionError
 func (fm *FileManager) GetFileHeader(file *Util.FileHandle) (*File.FileHeader, error) {
-	header := &File.FileHeader{}
-
-	// 1. 先将文件指针设置到文件开始处
-	if _, err := file.GetFile().Seek(0, 0); err != nil {
-		return nil, fmt.Errorf("设置文件指针失败: %v", err)
-	}
-	if err := binary.Read(file.GetFile(), binary.LittleEndian, header); err != nil {
-		return nil, fmt.Errorf("读取文件头失败: %v", err)
-	}
-	return header, nil
+	return readFileHeader(file)
 }
 
 func (fm *FileManager) UpdateFileHeader(file *Util.FileHandle, header *File.FileHeader) error {
-	file.SetOffset(0)
 	header.UpdateTime = time.Now().Unix()
 	return header.WriteToFile(file)
 }
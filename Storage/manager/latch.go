@@ -0,0 +1,358 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"wudb/Entity/Page"
+	"wudb/Entity/Record"
+)
+
+// B+树的闩协议：每个页面有一个读写闩（在缓冲池的帧上），元数据页中的根节点和树高由rootLatch保护。
+// 读操作从根节点开始交替加读闩下降，拿到子节点的闩之后才放开父节点；
+// 沿叶子链表向右移动时只尝试加闩，失败就放开当前叶子重新下降，避免和从左到右加闩的写操作死锁。
+// 写操作之间、写操作和读操作之间都并行：先乐观地用读闩下降，只对叶子加写闩，
+// 叶子不需要分裂或合并时直接修改；否则获取结构闩，从根节点开始对路径加写闩重新下降，
+// 遇到修改不会传到上层的安全节点时放开它上面的闩。改变结构的操作由结构闩串行执行，
+// 它们沿叶子链表从左到右加闩时只会等待乐观的写操作，乐观的写操作只持有一个叶子，不会反过来等待。
+// 写闩属于加闩的操作，修改过的页面一直持有到操作写完日志。
+
+// 一条内部记录最多占用的字节数，包括槽
+const maxSeparatorSize = Record.RecordHeaderSize + Page.KeyMaxSize + Record.PointerSize + Page.SlotEntrySize
+
+// 比所有合法的键都大，用来下降到最右边的叶子
+var maxSearchKey = bytes.Repeat([]byte{0xFF}, Page.KeyMaxSize+1)
+
+// 从根节点下降到包含key的叶子，返回加了闩并固定的叶子，树为空时返回nil。
+// op不为nil时叶子由op加写闩，内部节点都只加读闩
+func (rm *RecordManager) findLeaf(key []byte, op *operation) (*Page.Page, error) {
+	if rm.pageManager.metaPage == nil {
+		return nil, ErrNotFound
+	}
+	rm.rootLatch.RLock()
+	rootPageID, height := rm.pageManager.metaPage.RootPageID, rm.pageManager.metaPage.TreeHeight
+	if rootPageID == 0 {
+		rm.rootLatch.RUnlock()
+		return nil, nil
+	}
+	// 根节点之下的层数不会变化，树高只在根节点分裂或合并时改变
+	page, err := rm.fetchLatched(rootPageID, op, height == 1)
+	rm.rootLatch.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	for level := uint32(1); level < height; level++ {
+		if page.Header.PageType != Page.InternalPageID {
+			rm.bufferPool.UnpinPageRead(page.Header.PageID)
+			return nil, fmt.Errorf("页面 %d 不是内部节点", page.Header.PageID)
+		}
+		child, err := rm.fetchLatched(rm.findNextPage(page, key), op, level+1 == height)
+		rm.bufferPool.UnpinPageRead(page.Header.PageID)
+		if err != nil {
+			return nil, err
+		}
+		page = child
+	}
+	if page.Header.PageType != Page.LeafPageID {
+		rm.releaseLatched(page, op, true)
+		return nil, fmt.Errorf("页面 %d 不是叶子节点", page.Header.PageID)
+	}
+	return page, nil
+}
+
+// leaf为true并且op不为nil时加写闩，否则加读闩
+func (rm *RecordManager) fetchLatched(pageID uint32, op *operation, leaf bool) (*Page.Page, error) {
+	if op != nil && leaf {
+		return op.fetchPage(pageID)
+	}
+	return rm.bufferPool.FetchPageRead(pageID)
+}
+
+func (rm *RecordManager) releaseLatched(page *Page.Page, op *operation, leaf bool) {
+	if op != nil && leaf {
+		op.unpinPage(page.Header.PageID, false)
+		return
+	}
+	rm.bufferPool.UnpinPageRead(page.Header.PageID)
+}
+
+// 从包含startKey的叶子开始沿叶子链表向右扫描，持有叶子的读闩调用visit，visit返回false时停止。
+// after是已经扫描过的最大键，重新下降后再次访问的叶子中不大于它的键要跳过
+func (rm *RecordManager) scanLeaves(startKey []byte, visit func(page *Page.Page, after []byte) (bool, error)) error {
+	page, err := rm.findLeaf(startKey, nil)
+	if err != nil || page == nil {
+		return err
+	}
+	return rm.scanLeavesFrom(page, startKey, nil, visit)
+}
+
+// 从已经加了读闩的叶子page开始向右扫描，after不为nil时表示扫描过的最大键
+func (rm *RecordManager) scanLeavesFrom(page *Page.Page, startKey, after []byte, visit func(page *Page.Page, after []byte) (bool, error)) error {
+	for {
+		more, err := visit(page, after)
+		if err != nil || !more || page.Header.NextPageID == 0 {
+			rm.bufferPool.UnpinPageRead(page.Header.PageID)
+			return err
+		}
+		if page.Header.RecordCount > 0 {
+			after = append([]byte(nil), page.GetMaxKey()...)
+		}
+		next, ok, err := rm.bufferPool.TryFetchPageRead(page.Header.NextPageID)
+		rm.bufferPool.UnpinPageRead(page.Header.PageID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// 下一个叶子正在被修改，从扫描到的位置重新下降
+			seek := startKey
+			if after != nil {
+				seek = after
+			}
+			if next, err = rm.findLeaf(seek, nil); err != nil || next == nil {
+				return err
+			}
+		}
+		page = next
+	}
+}
+
+// 从包含before的叶子开始沿叶子链表向左扫描，before为nil时从最右边的叶子开始，visit返回false时停止。
+// before是已经扫描过的最小键，visit只需要看更小的键。向左加闩的顺序和写操作相反，
+// 只尝试加闩，失败时放开当前叶子，让出处理器后从before重新下降
+func (rm *RecordManager) scanLeavesBackward(before []byte, visit func(page *Page.Page, before []byte) (bool, error)) error {
+	seek := maxSearchKey
+	if before != nil {
+		seek = before
+	}
+	page, err := rm.findLeaf(seek, nil)
+	if err != nil || page == nil {
+		return err
+	}
+	return rm.scanLeavesBackwardFrom(page, before, visit)
+}
+
+// 从已经加了读闩的叶子page开始向左扫描，before不为nil时表示扫描过的最小键
+func (rm *RecordManager) scanLeavesBackwardFrom(page *Page.Page, before []byte, visit func(page *Page.Page, before []byte) (bool, error)) error {
+	seek := func() []byte {
+		if before == nil {
+			return maxSearchKey
+		}
+		return before
+	}
+	for {
+		more, err := visit(page, before)
+		if err != nil || !more || page.Header.PrevPageID == 0 {
+			rm.bufferPool.UnpinPageRead(page.Header.PageID)
+			return err
+		}
+		if page.Header.RecordCount > 0 {
+			before = append([]byte(nil), page.GetMinKey()...)
+		}
+		prev, ok, err := rm.bufferPool.TryFetchPageRead(page.Header.PrevPageID)
+		rm.bufferPool.UnpinPageRead(page.Header.PageID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// 前一个叶子正在被修改，写操作可能在等当前叶子的闩
+			runtime.Gosched()
+			if prev, err = rm.findLeaf(seek(), nil); err != nil || prev == nil {
+				return err
+			}
+		}
+		page = prev
+	}
+}
+
+// 悲观下降时加了写闩的路径，第一个页面是这次修改可能到达的最高节点
+type writePath struct {
+	op         *operation
+	pageIDs    []uint32
+	rootLocked bool // 修改可能改变根节点，持有rootLatch
+}
+
+// 获取结构闩后从根节点开始对路径上的页面加写闩，safe返回true的节点放得下下层传上来的修改，
+// 它上面的闩都可以释放。调用方完成修改后调用release，修改过的页面仍由op持有
+func (rm *RecordManager) lockPath(key []byte, safe func(page *Page.Page, isRoot bool) bool, op *operation) (*writePath, error) {
+	op.lockStructure()
+	rm.rootLatch.Lock()
+	path := &writePath{op: op, rootLocked: true}
+	rootPageID := rm.pageManager.metaPage.RootPageID
+	if rootPageID == 0 {
+		path.release()
+		return nil, ErrNotFound
+	}
+	for pageID := rootPageID; ; {
+		page, err := op.fetchPage(pageID)
+		if err != nil {
+			path.release()
+			return nil, err
+		}
+		if safe(page, pageID == rootPageID) {
+			path.release()
+		}
+		path.pageIDs = append(path.pageIDs, pageID)
+		if page.Header.PageType != Page.InternalPageID {
+			return path, nil
+		}
+		pageID = rm.findNextPage(page, key)
+	}
+}
+
+func (p *writePath) top() uint32 {
+	return p.pageIDs[0]
+}
+
+// 释放路径上的写闩，合并时已经删除的页面不再在缓冲池中，跳过
+func (p *writePath) release() {
+	for _, pageID := range p.pageIDs {
+		p.op.unpinPage(pageID, false)
+	}
+	p.pageIDs = nil
+	if p.rootLocked {
+		p.op.rm.rootLatch.Unlock()
+		p.rootLocked = false
+	}
+}
+
+// 插入后不会分裂：叶子放得下这条记录，内部节点放得下一条最长的分隔记录
+func insertSafe(page *Page.Page, record *Record.Record) bool {
+	if page.Header.PageType == Page.LeafPageID {
+		return page.FreeSpace() >= uint32(recordSize(record))
+	}
+	return page.FreeSpace() >= maxSeparatorSize
+}
+
+// 删除后不会下溢：叶子删除key之后、内部节点删除一条分隔记录之后仍然不少于四分之一，
+// 内部节点还要放得下重新分配记录时换上的更长的分隔键。
+// 根节点允许记录太少，但内部的根节点只剩一个子节点时树高会降低
+func deleteSafe(page *Page.Page, key []byte, isRoot bool) bool {
+	if page.Header.PageType == Page.LeafPageID {
+		if isRoot {
+			return true
+		}
+		record, err := page.FindRecord(key)
+		if err != nil {
+			return true
+		}
+		return page.UsedSpace()-uint32(recordSize(record)) >= Page.DataAreaSize/4
+	}
+	if page.FreeSpace() < Page.KeyMaxSize {
+		return false
+	}
+	if isRoot {
+		return page.Header.RecordCount > 1
+	}
+	return page.UsedSpace() >= Page.DataAreaSize/4+maxSeparatorSize
+}
+
+// 乐观插入：只对叶子加写闩，叶子放不下时返回false，由调用方悲观地重试
+func (rm *RecordManager) insertOptimistic(record *Record.Record, op *operation) (bool, error) {
+	leaf, err := rm.findLeaf(record.GetKey(), op)
+	if err != nil {
+		return true, err
+	}
+	err = leaf.InsertRecord(record)
+	if errors.Is(err, ErrPageFull) {
+		op.unpinPage(leaf.Header.PageID, false)
+		return false, nil
+	}
+	op.unpinPage(leaf.Header.PageID, err == nil)
+	return true, err
+}
+
+// 悲观插入：可能分裂的节点都加写闩
+func (rm *RecordManager) insertPessimistic(record *Record.Record, op *operation) error {
+	path, err := rm.lockPath(record.GetKey(), func(page *Page.Page, isRoot bool) bool {
+		return insertSafe(page, record)
+	}, op)
+	if err != nil {
+		return err
+	}
+	defer path.release()
+	err, _, _ = rm.insertRecordToTree(record, path.top(), op)
+	return err
+}
+
+// 乐观删除：叶子删除后会下溢，或者要释放溢出页时返回false，由调用方悲观地重试
+func (rm *RecordManager) deleteOptimistic(key []byte, op *operation) (*Record.Record, bool, error) {
+	leaf, err := rm.findLeaf(key, op)
+	if err != nil {
+		return nil, true, err
+	}
+	if leaf == nil {
+		return nil, true, ErrNotFound
+	}
+	// 叶子在树中总有兄弟，只有根节点没有
+	isRoot := leaf.Header.PrevPageID == 0 && leaf.Header.NextPageID == 0
+	if !deleteSafe(leaf, key, isRoot) {
+		op.unpinPage(leaf.Header.PageID, false)
+		return nil, false, nil
+	}
+	deleted, err := leaf.FindRecord(key)
+	if err != nil {
+		op.unpinPage(leaf.Header.PageID, false)
+		return nil, true, ErrNotFound
+	}
+	if deleted.IsOverflow() && !op.structural {
+		op.unpinPage(leaf.Header.PageID, false)
+		return nil, false, nil
+	}
+	err = leaf.DeleteRecord(key)
+	op.unpinPage(leaf.Header.PageID, err == nil)
+	return deleted, true, err
+}
+
+// 悲观删除：可能合并的节点都加写闩
+func (rm *RecordManager) deletePessimistic(key []byte, op *operation) (*Record.Record, error) {
+	path, err := rm.lockPath(key, func(page *Page.Page, isRoot bool) bool {
+		return deleteSafe(page, key, isRoot)
+	}, op)
+	if err != nil {
+		return nil, err
+	}
+	defer path.release()
+	return rm.deleteRecordFromTree(key, path.top(), op)
+}
+
+// 乐观更新：新记录在叶子中放不下，或者旧值的溢出页要释放时返回false，由调用方悲观地重试
+func (rm *RecordManager) updateOptimistic(record *Record.Record, op *operation) (*Record.Record, uint32, bool, error) {
+	leaf, err := rm.findLeaf(record.GetKey(), op)
+	if err != nil {
+		return nil, 0, true, err
+	}
+	if leaf == nil {
+		return nil, 0, true, ErrNotFound
+	}
+	pageID := leaf.Header.PageID
+	if old, err := leaf.FindRecord(record.GetKey()); err == nil && old.IsOverflow() && !op.structural {
+		op.unpinPage(pageID, false)
+		return nil, 0, false, nil
+	}
+	err, oldRecord := leaf.UpdateRecord(record)
+	if errors.Is(err, ErrPageFull) {
+		op.unpinPage(pageID, false)
+		return nil, 0, false, nil
+	}
+	op.unpinPage(pageID, err == nil)
+	return oldRecord, pageID, true, err
+}
+
+// 悲观更新：先删除旧记录再重新插入，两步都可能改变树的结构，整条路径和根节点都加写闩
+func (rm *RecordManager) updatePessimistic(record *Record.Record, op *operation) (*Record.Record, error) {
+	path, err := rm.lockPath(record.GetKey(), func(page *Page.Page, isRoot bool) bool {
+		return false
+	}, op)
+	if err != nil {
+		return nil, err
+	}
+	defer path.release()
+	oldRecord, err := rm.deleteRecordFromTree(record.GetKey(), path.top(), op)
+	if err != nil && err != ErrUnderflow {
+		return nil, err
+	}
+	// 删除可能降低了树高，从新的根节点插入
+	err, _, _ = rm.insertRecordToTree(record, rm.pageManager.metaPage.RootPageID, op)
+	return oldRecord, err
+}
@@ -0,0 +1,308 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"wudb/Entity/Page"
+	"wudb/Transaction"
+)
+
+// 测试写闩挡住读闩，同一个写操作可以重复获取写闩，其他写操作不能释放它
+func TestLatch_PageLatches(t *testing.T) {
+	pm, _, cleanup := setupPageManagerTest(t)
+	defer cleanup()
+
+	bpm := NewBufferPoolManager(pm, 4)
+	owner := &latchOwner{}
+	page, err := bpm.NewPageWrite(Page.LeafPageID, owner)
+	if err != nil {
+		t.Fatalf("创建页面失败: %v", err)
+	}
+	pageID := page.Header.PageID
+	if _, err := bpm.FetchPageWrite(pageID, owner); err != nil {
+		t.Fatalf("重复获取写闩失败: %v", err)
+	}
+	if err := bpm.UnpinPageWrite(pageID, &latchOwner{}, false); err == nil {
+		t.Error("其他写操作不应该能释放写闩")
+	}
+	if _, ok, _ := bpm.TryFetchPageRead(pageID); ok {
+		t.Fatal("持有写闩时不应该能加读闩")
+	}
+	if count := bpm.GetPinCount(pageID); count != 2 {
+		t.Errorf("加闩失败后应该取消固定: 期望固定 2 次, 实际 %d", count)
+	}
+
+	read := make(chan struct{})
+	go func() {
+		bpm.FetchPageRead(pageID)
+		close(read)
+	}()
+	bpm.UnpinPageWrite(pageID, owner, true)
+	select {
+	case <-read:
+		t.Fatal("写闩还没有完全释放，读操作应该等待")
+	case <-time.After(50 * time.Millisecond):
+	}
+	bpm.UnpinPageWrite(pageID, owner, false)
+	select {
+	case <-read:
+	case <-time.After(time.Second):
+		t.Fatal("写闩释放后读操作应该继续")
+	}
+	if err := bpm.UnpinPageWrite(pageID, owner, false); err == nil {
+		t.Error("没有写闩时释放写闩应该失败")
+	}
+	bpm.UnpinPageRead(pageID)
+	if count := pinnedFrameCount(bpm); count != 0 {
+		t.Errorf("所有页面都应该取消固定, 实际 %d", count)
+	}
+}
+
+// 测试多个写操作和读操作并发访问同一棵树，分裂和合并期间读操作总能看到不变的记录
+func TestLatch_ConcurrentOperations(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	const writers, regionSize = 4, 300
+	key := func(writer, i int) uint32 { return uint32(writer*1000 + i) }
+	value := func(k uint32) string { return fmt.Sprintf("%0400d", k) }
+
+	// 每个写操作只修改自己的键区间，区间最后一个键不删除，下一个键锁不会跨区间
+	setup := Transaction.NewTransaction(1, 1, Transaction.ReadCommitted)
+	for w := 0; w < writers; w++ {
+		for i := 0; i <= regionSize; i += 2 {
+			if err := rm.InsertRecord(createTestRecord(key(w, i), value(key(w, i))), setup); err != nil {
+				t.Fatalf("插入记录失败: %v", err)
+			}
+		}
+	}
+	rm.Commit(setup)
+
+	var writing sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		writing.Add(1)
+		go func(w int) {
+			defer writing.Done()
+			tx := Transaction.NewTransaction(int32(10+w), int32(10+w), Transaction.ReadCommitted)
+			for i := 1; i < regionSize; i += 2 {
+				if err := rm.InsertRecord(createTestRecord(key(w, i), value(key(w, i))), tx); err != nil {
+					t.Errorf("插入记录失败: %v", err)
+					return
+				}
+			}
+			// 删除一半的记录，叶子下溢后合并
+			for i := 2; i < regionSize; i += 4 {
+				for _, k := range []uint32{key(w, i), key(w, i+1)} {
+					if err := rm.DeleteRecord(createTestKey(k), tx); err != nil {
+						t.Errorf("删除记录失败: %v", err)
+						return
+					}
+				}
+			}
+			if err := rm.Commit(tx); err != nil {
+				t.Errorf("提交事务失败: %v", err)
+			}
+		}(w)
+	}
+
+	done := make(chan struct{})
+	var reading sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		reading.Add(1)
+		go func(r int) {
+			defer reading.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// 键是4的倍数的记录一直存在
+				k := key(r%writers, (r*37)%regionSize/4*4)
+				record, err := rm.findRecord(createTestKey(k))
+				if err != nil || string(record.Value) != value(k) {
+					t.Errorf("读操作没有找到不变的记录 %d: %v", k, err)
+					return
+				}
+				records, err := rm.rangeQuery(createTestKey(0), createTestKey(key(writers, 0)))
+				if err != nil {
+					t.Errorf("范围查询失败: %v", err)
+					return
+				}
+				unchanged := 0
+				for i, record := range records {
+					if i > 0 && bytes.Compare(records[i-1].Key, record.Key) >= 0 {
+						t.Errorf("范围查询的结果没有按键排序")
+						return
+					}
+					if k := keyOf(record.Key) % 1000; k%4 == 0 {
+						unchanged++
+					}
+				}
+				if unchanged != writers*(regionSize/4+1) {
+					t.Errorf("范围查询应该看到全部 %d 条不变的记录, 实际 %d", writers*(regionSize/4+1), unchanged)
+					return
+				}
+				r++
+			}
+		}(r)
+	}
+	writing.Wait()
+	close(done)
+	reading.Wait()
+
+	records, err := rm.rangeQuery(createTestKey(0), createTestKey(key(writers, 0)))
+	if err != nil {
+		t.Fatalf("范围查询失败: %v", err)
+	}
+	var expected []uint32
+	for w := 0; w < writers; w++ {
+		for i := 0; i <= regionSize; i++ {
+			if i%4 == 0 || i%4 == 1 {
+				expected = append(expected, key(w, i))
+			}
+		}
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("记录数不正确: 期望 %d, 实际 %d", len(expected), len(records))
+	}
+	for i, record := range records {
+		if keyOf(record.Key) != expected[i] {
+			t.Fatalf("第 %d 条记录的键不正确: 期望 %d, 实际 %d", i, expected[i], keyOf(record.Key))
+		}
+	}
+	if count := pinnedFrameCount(rm.bufferPool); count != 0 {
+		t.Errorf("操作结束后不应该有固定的页面, 实际 %d", count)
+	}
+}
+
+// 测试不同叶子上的写操作并行：一个写操作等待叶子的闩时，另一个叶子上的插入和删除照常完成
+func TestLatch_WritersOnDifferentLeaves(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	value := func(k uint32) string { return fmt.Sprintf("%0400d", k) }
+	setup := Transaction.NewTransaction(1, 1, Transaction.ReadCommitted)
+	for k := uint32(0); k < 200; k += 2 {
+		if err := rm.InsertRecord(createTestRecord(k, value(k)), setup); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+	rm.Commit(setup)
+
+	// 持有第一个叶子的读闩，它上面的写操作只能等待
+	first, err := rm.findLeaf(createTestKey(0), nil)
+	if err != nil {
+		t.Fatalf("查找叶子失败: %v", err)
+	}
+	last, err := rm.findLeaf(createTestKey(198), nil)
+	if err != nil {
+		t.Fatalf("查找叶子失败: %v", err)
+	}
+	rm.bufferPool.UnpinPageRead(last.Header.PageID)
+	if first.Header.PageID == last.Header.PageID {
+		t.Fatal("键 0 和 198 应该在不同的叶子中")
+	}
+
+	blocked := make(chan error, 1)
+	go func() {
+		tx := Transaction.NewTransaction(10, 10, Transaction.ReadCommitted)
+		err := rm.DeleteRecord(createTestKey(2), tx)
+		if err == nil {
+			err = rm.Commit(tx)
+		}
+		blocked <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-blocked:
+		t.Fatalf("持有叶子的读闩时删除应该等待: %v", err)
+	default:
+	}
+
+	other := make(chan error, 1)
+	go func() {
+		tx := Transaction.NewTransaction(11, 11, Transaction.ReadCommitted)
+		err := rm.InsertRecord(createTestRecord(197, value(197)), tx)
+		if err == nil {
+			err = rm.DeleteRecord(createTestKey(196), tx)
+		}
+		if err == nil {
+			err = rm.Commit(tx)
+		}
+		other <- err
+	}()
+	select {
+	case err := <-other:
+		if err != nil {
+			t.Fatalf("另一个叶子上的写操作失败: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		rm.bufferPool.UnpinPageRead(first.Header.PageID)
+		t.Fatal("另一个叶子上的写操作不应该等待第一个叶子上的写操作")
+	}
+
+	rm.bufferPool.UnpinPageRead(first.Header.PageID)
+	select {
+	case err := <-blocked:
+		if err != nil {
+			t.Fatalf("删除记录失败: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("放开读闩后删除应该继续")
+	}
+
+	for k, want := range map[uint32]bool{2: false, 196: false, 197: true, 4: true, 198: true} {
+		_, err := rm.findRecord(createTestKey(k))
+		if found := err == nil; found != want {
+			t.Errorf("键 %d 是否存在不正确: 期望 %v, 实际 %v", k, want, found)
+		}
+	}
+	if count := pinnedFrameCount(rm.bufferPool); count != 0 {
+		t.Errorf("操作结束后不应该有固定的页面, 实际 %d", count)
+	}
+}
+
+// 测试更新后的记录在叶子中放不下时先删除再插入，树结构的变化不影响其他记录
+func TestLatch_UpdateGrowsRecord(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	for k := uint32(0); k < 40; k++ {
+		if err := rm.InsertRecord(createTestRecord(k, fmt.Sprintf("%0180d", k)), tx); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+	for k := uint32(0); k < 40; k += 3 {
+		if err := rm.UpdateRecord(createTestRecord(k, fmt.Sprintf("%0500d", k)), tx); err != nil {
+			t.Fatalf("更新记录失败: %v", err)
+		}
+	}
+	records, err := rm.rangeQuery(createTestKey(0), createTestKey(40))
+	if err != nil {
+		t.Fatalf("范围查询失败: %v", err)
+	}
+	if len(records) != 40 {
+		t.Fatalf("记录数不正确: 期望 40, 实际 %d", len(records))
+	}
+	for k, record := range records {
+		expected := fmt.Sprintf("%0180d", k)
+		if k%3 == 0 {
+			expected = fmt.Sprintf("%0500d", k)
+		}
+		if string(record.Value) != expected {
+			t.Errorf("键 %d 的值不正确", k)
+		}
+	}
+	if count := pinnedFrameCount(rm.bufferPool); count != 0 {
+		t.Errorf("操作结束后不应该有固定的页面, 实际 %d", count)
+	}
+}
+
+func keyOf(key []byte) uint32 {
+	return uint32(key[0])<<24 | uint32(key[1])<<16 | uint32(key[2])<<8 | uint32(key[3])
+}
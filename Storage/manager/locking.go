@@ -0,0 +1,235 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"wudb/Entity/Page"
+	"wudb/Entity/Record"
+	"wudb/Transaction"
+)
+
+// 基于锁的并发控制：写操作对记录的键加排他锁，一直持有到事务结束；
+// 读操作按隔离级别加共享锁：读未提交不加锁，读已提交读完就释放，
+// 可重复读和可串行化持有到事务结束。加锁在获取树的闩之前，等待锁时不会挡住其他操作。
+// 被选为死锁牺牲者的事务在这里回滚，调用方得到ErrDeadlock后可以重试整个事务。
+//
+// 可重复读和可串行化用下一个键锁防止幻读：键上的锁同时锁住它和前一个键之间的间隙，
+// 最后一个键之后的间隙用上界资源表示。范围查询对读到的键和范围之后的下一个键加共享锁；
+// 插入在插入完成之前对下一个键加排他锁，读者锁住的间隙中的插入要等到读者结束；
+// 删除对下一个键加排他锁直到事务结束，删除回滚之前其他事务不能扫描合并后的间隙
+
+// 树中最后一个键之后的间隙对应的资源名
+const supremumResource = "supremum"
+
+// 锁管理器中记录键对应的资源名，加前缀与上界区分
+func recordResource(key []byte) string {
+	return "key:" + string(key)
+}
+
+// 锁住key之前的间隙的资源：下一个键，没有下一个键时是上界
+func gapResource(next []byte) string {
+	if next == nil {
+		return supremumResource
+	}
+	return recordResource(next)
+}
+
+// 树中大于key的最小键，没有时返回nil
+func (rm *RecordManager) nextKey(key []byte) ([]byte, error) {
+	return rm.keyAfter(Included(key))
+}
+
+// 树中超出上界end的最小键，没有上界或者没有这样的键时返回nil
+func (rm *RecordManager) keyAfter(end Bound) ([]byte, error) {
+	if end.Unbounded || rm.pageManager.metaPage == nil {
+		return nil, nil
+	}
+	var next []byte
+	err := rm.scanLeaves(end.Key, func(page *Page.Page, after []byte) (bool, error) {
+		pos := page.UpperBound(end.Key)
+		if end.Exclusive {
+			pos = page.LowerBound(end.Key)
+		}
+		if pos < int(page.Header.RecordCount) {
+			next = append([]byte(nil), page.KeyAt(pos)...)
+			return false, nil
+		}
+		return true, nil
+	})
+	return next, err
+}
+
+// 持有opLatch的读锁执行写操作。基于锁的模式下插入和删除先对key的下一个键加排他锁：
+// hold为false时写完就释放（插入），为true时持有到事务结束（删除）。
+// 等锁时不持有闩，拿到锁后确认下一个键没有变化，变化了就重试。
+// 下一个键的排他锁挡住了这个间隙中的插入和下一个键的删除，确认之后它不会再变
+func (rm *RecordManager) writeWithGapLock(tx *Transaction.Transaction, key []byte, hold bool, write func() error) error {
+	if rm.mvcc {
+		rm.opLatch.RLock()
+		defer rm.opLatch.RUnlock()
+		return write()
+	}
+	lockManager := rm.transactionManager.GetLockManager()
+	for {
+		next, err := rm.nextKey(key)
+		if err != nil {
+			return err
+		}
+		resource := gapResource(next)
+		held := lockManager.HeldMode(tx.TransactionID, resource)
+		if err := lockManager.Lock(tx, resource, Transaction.LockExclusive); err != nil {
+			return rm.abortOnConflict(tx, err)
+		}
+		// 重试时之前的锁没有用到，也释放掉
+		release := func(written bool) {
+			if held == 0 && (!hold || !written) {
+				lockManager.Unlock(tx.TransactionID, resource)
+			}
+		}
+
+		current, err := rm.nextKey(key)
+		if err == nil && (current == nil) == (next == nil) && bytes.Equal(current, next) {
+			rm.opLatch.RLock()
+			err = write()
+			rm.opLatch.RUnlock()
+			release(true)
+			return err
+		}
+		release(false)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// 写操作之前对键加排他锁
+func (rm *RecordManager) lockExclusive(tx *Transaction.Transaction, key []byte) error {
+	err := rm.transactionManager.GetLockManager().Lock(tx, recordResource(key), Transaction.LockExclusive)
+	return rm.abortOnConflict(tx, err)
+}
+
+// 读操作之前按隔离级别对资源加共享锁，返回读完之后调用的释放函数
+func (rm *RecordManager) lockShared(tx *Transaction.Transaction, resource string) (func(), error) {
+	// 只读的事务也要登记，提交时才能释放它的锁
+	rm.transactionManager.RegisterTransaction(tx)
+	lockManager := rm.transactionManager.GetLockManager()
+	if tx.IsolationLevel == Transaction.ReadUncommitted || lockManager.HeldMode(tx.TransactionID, resource) != 0 {
+		return func() {}, nil
+	}
+	if err := lockManager.Lock(tx, resource, Transaction.LockShared); err != nil {
+		return nil, rm.abortOnConflict(tx, err)
+	}
+	if tx.IsolationLevel == Transaction.ReadCommitted {
+		return func() { lockManager.Unlock(tx.TransactionID, resource) }, nil
+	}
+	return func() {}, nil
+}
+
+// 死锁、写冲突和可串行化冲突时回滚事务，释放它持有的锁
+func (rm *RecordManager) abortOnConflict(tx *Transaction.Transaction, err error) error {
+	if !errors.Is(err, Transaction.ErrDeadlock) && !errors.Is(err, ErrWriteConflict) && !errors.Is(err, ErrSerializationFailure) {
+		return err
+	}
+	// 还没有读写过的事务也要登记，才能回滚
+	rm.transactionManager.RegisterTransaction(tx)
+	if rollbackErr := rm.Rollback(tx); rollbackErr != nil {
+		return fmt.Errorf("%w: 回滚失败: %v", err, rollbackErr)
+	}
+	return err
+}
+
+// 在事务中查找记录，按事务的隔离级别加锁；多版本模式下读事务的快照。
+// 可重复读和可串行化找不到记录时锁住键所在的间隙，之后其他事务不能插入这个键
+func (rm *RecordManager) FindRecord(key []byte, tx *Transaction.Transaction) (*Record.Record, error) {
+	if rm.mvcc {
+		return rm.findVisibleRecord(key, tx)
+	}
+	unlock, err := rm.lockShared(tx, recordResource(key))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	record, err := rm.findRecord(key)
+	if err != ErrNotFound || !lockGaps(tx) {
+		return record, err
+	}
+	records, err := rm.RangeQuery(key, key, tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	return records[0], nil
+}
+
+// 可重复读和可串行化需要锁住间隙
+func lockGaps(tx *Transaction.Transaction) bool {
+	return tx.IsolationLevel >= Transaction.RepeatableRead
+}
+
+// 在事务中查找键在[startKey, endKey]中的记录
+func (rm *RecordManager) RangeQuery(startKey, endKey []byte, tx *Transaction.Transaction) ([]*Record.Record, error) {
+	return rm.Scan(ClosedRange(startKey, endKey), ScanOptions{}, tx)
+}
+
+// 基于锁的模式下按选项做范围查询：对扫描过的每个键（包括Offset跳过的键）按隔离级别加共享锁，
+// 可重复读和可串行化还锁住范围之后的下一个键。升序查询因为Limit停在范围中间时，
+// 读到的最后一个键之后的部分没有被读过，不锁它后面的间隙
+func (rm *RecordManager) scanLocked(keyRange KeyRange, options ScanOptions, tx *Transaction.Transaction) ([]*Record.Record, error) {
+	want := 0
+	if options.Limit > 0 {
+		want = options.Offset + options.Limit
+	}
+	records, err := rm.lockRecords(tx, func() ([]*Record.Record, []string, error) {
+		records, err := rm.scanRange(keyRange, ScanOptions{Descending: options.Descending, Limit: want})
+		if err != nil || !lockGaps(tx) || !options.Descending && want > 0 && len(records) == want {
+			return records, nil, err
+		}
+		next, err := rm.keyAfter(keyRange.End)
+		return records, []string{gapResource(next)}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return skipRecords(records, options.Offset), nil
+}
+
+// 对load读到的记录和它返回的间隙资源按隔离级别加共享锁，加锁后重新读，直到读到的键都已经加锁。
+// 读和加锁之间插入的键会在下一轮读到并加锁；读已提交在返回之前释放这些锁
+func (rm *RecordManager) lockRecords(tx *Transaction.Transaction, load func() ([]*Record.Record, []string, error)) ([]*Record.Record, error) {
+	var unlocks []func()
+	defer func() {
+		for _, unlock := range unlocks {
+			unlock()
+		}
+	}()
+	locked := make(map[string]bool)
+	for {
+		records, gaps, err := load()
+		if err != nil {
+			return nil, err
+		}
+		resources := make([]string, 0, len(records)+len(gaps))
+		for _, record := range records {
+			resources = append(resources, recordResource(record.GetKey()))
+		}
+		complete := true
+		for _, resource := range append(resources, gaps...) {
+			if locked[resource] {
+				continue
+			}
+			unlock, err := rm.lockShared(tx, resource)
+			if err != nil {
+				return nil, err
+			}
+			unlocks = append(unlocks, unlock)
+			locked[resource] = true
+			complete = false
+		}
+		if complete {
+			return records, nil
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"wudb/Transaction"
+)
+
+// 测试写操作持有排他锁到提交，其他事务的读和写都要等待
+func TestLocking_WriterBlocksOthers(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx1 := Transaction.NewTransaction(1, 2, Transaction.ReadCommitted)
+	if err := rm.InsertRecord(createTestRecord(1, "old"), tx1); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	rm.transactionManager.Commit(tx1.TransactionID)
+
+	tx2 := Transaction.NewTransaction(2, 3, Transaction.ReadCommitted)
+	if err := rm.UpdateRecord(createTestRecord(1, "new"), tx2); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+
+	tx3 := Transaction.NewTransaction(3, 4, Transaction.ReadCommitted)
+	read := make(chan string, 1)
+	go func() {
+		record, err := rm.FindRecord(createTestKey(1), tx3)
+		if err != nil {
+			t.Errorf("查找记录失败: %v", err)
+			read <- ""
+			return
+		}
+		read <- string(record.Value)
+	}()
+	tx4 := Transaction.NewTransaction(4, 5, Transaction.ReadCommitted)
+	written := make(chan error, 1)
+	go func() {
+		written <- rm.UpdateRecord(createTestRecord(1, "newer"), tx4)
+	}()
+
+	select {
+	case value := <-read:
+		t.Fatalf("读操作不应该读到未提交的数据: %q", value)
+	case <-written:
+		t.Fatal("写操作应该等待排他锁")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := rm.transactionManager.Commit(tx2.TransactionID); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatalf("更新记录失败: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("提交后写操作应该继续")
+	}
+	rm.transactionManager.Commit(tx4.TransactionID)
+	select {
+	case value := <-read:
+		if value != "new" && value != "newer" {
+			t.Errorf("读到的值不正确: %q", value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("提交后读操作应该继续")
+	}
+}
+
+// 测试可重复读持有共享锁到事务结束，读已提交读完就释放
+func TestLocking_ReadLocks(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	rm.InsertRecord(createTestRecord(1, "value"), tx)
+	rm.transactionManager.Commit(tx.TransactionID)
+
+	lockManager := rm.transactionManager.GetLockManager()
+	resource := recordResource(createTestKey(1))
+	committed := Transaction.NewTransaction(2, 3, Transaction.ReadCommitted)
+	if _, err := rm.FindRecord(createTestKey(1), committed); err != nil {
+		t.Fatalf("查找记录失败: %v", err)
+	}
+	if lockManager.HeldMode(committed.TransactionID, resource) != 0 {
+		t.Error("读已提交读完后应该释放共享锁")
+	}
+	repeatable := Transaction.NewTransaction(3, 4, Transaction.RepeatableRead)
+	if _, err := rm.FindRecord(createTestKey(1), repeatable); err != nil {
+		t.Fatalf("查找记录失败: %v", err)
+	}
+	if lockManager.HeldMode(repeatable.TransactionID, resource) != Transaction.LockShared {
+		t.Error("可重复读应该持有共享锁")
+	}
+}
+
+// 测试两个事务按相反顺序更新时，较年轻的事务被回滚并得到死锁错误
+func TestLocking_Deadlock(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	rm.InsertRecord(createTestRecord(1, "value"), tx)
+	rm.InsertRecord(createTestRecord(2, "value"), tx)
+	rm.transactionManager.Commit(tx.TransactionID)
+
+	older := Transaction.NewTransaction(2, 3, Transaction.ReadCommitted)
+	younger := Transaction.NewTransaction(3, 4, Transaction.ReadCommitted)
+	younger.BeginTime = older.BeginTime.Add(time.Second)
+	if err := rm.UpdateRecord(createTestRecord(1, "older"), older); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+	if err := rm.UpdateRecord(createTestRecord(2, "younger"), younger); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+
+	result := make(chan error, 1)
+	go func() { result <- rm.UpdateRecord(createTestRecord(2, "older"), older) }()
+	time.Sleep(50 * time.Millisecond)
+	if err := rm.UpdateRecord(createTestRecord(1, "younger"), younger); !errors.Is(err, Transaction.ErrDeadlock) {
+		t.Fatalf("应该返回死锁错误: %v", err)
+	}
+	if younger.Status != Transaction.Aborted {
+		t.Error("牺牲者应该被回滚")
+	}
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("牺牲者回滚后更新应该成功: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("牺牲者回滚后更新应该继续")
+	}
+	rm.transactionManager.Commit(older.TransactionID)
+	for _, key := range []uint32{1, 2} {
+		record, err := rm.findRecord(createTestKey(key))
+		if err != nil || string(record.Value) != "older" {
+			t.Errorf("第 %d 条记录不正确: %v, %v", key, record, err)
+		}
+	}
+}
+
+// 等待写操作的结果，blocked为true时期望它在超时之前没有返回
+func expectWrite(t *testing.T, result chan error, blocked bool) {
+	t.Helper()
+	timeout := time.Second
+	if blocked {
+		timeout = 50 * time.Millisecond
+	}
+	select {
+	case err := <-result:
+		if blocked {
+			t.Fatalf("写操作应该等待读者锁住的间隙: %v", err)
+		}
+		if err != nil {
+			t.Fatalf("写操作失败: %v", err)
+		}
+	case <-time.After(timeout):
+		if !blocked {
+			t.Fatal("写操作不应该等待")
+		}
+	}
+}
+
+// 测试可重复读的范围查询锁住间隙，范围中的插入要等读者结束，范围之外的插入不受影响
+func TestLocking_NextKeyLocks(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	for _, key := range []uint32{1, 3, 5, 8} {
+		rm.InsertRecord(createTestRecord(key, "value"), tx)
+	}
+	rm.transactionManager.Commit(tx.TransactionID)
+
+	reader := Transaction.NewTransaction(2, 3, Transaction.RepeatableRead)
+	records, err := rm.RangeQuery(createTestKey(2), createTestKey(6), reader)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("范围查询结果不正确: %d 条, %v", len(records), err)
+	}
+
+	// 范围之后的下一个键是8，8之后的间隙没有被锁住
+	outside := Transaction.NewTransaction(3, 4, Transaction.ReadCommitted)
+	if err := rm.InsertRecord(createTestRecord(10, "value"), outside); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	rm.transactionManager.Commit(outside.TransactionID)
+
+	inside := make(chan error, 1)
+	go func() {
+		inside <- rm.InsertRecord(createTestRecord(4, "value"), Transaction.NewTransaction(4, 5, Transaction.ReadCommitted))
+	}()
+	afterRange := make(chan error, 1)
+	go func() {
+		afterRange <- rm.InsertRecord(createTestRecord(7, "value"), Transaction.NewTransaction(5, 6, Transaction.ReadCommitted))
+	}()
+	expectWrite(t, inside, true)
+	expectWrite(t, afterRange, true)
+
+	// 读者再次查询看不到幻影
+	records, err = rm.RangeQuery(createTestKey(2), createTestKey(6), reader)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("再次范围查询结果不正确: %d 条, %v", len(records), err)
+	}
+	rm.transactionManager.Commit(reader.TransactionID)
+	expectWrite(t, inside, false)
+	expectWrite(t, afterRange, false)
+}
+
+// 测试可重复读的降序分页查询和游标对读到的键加锁，游标读到最后时锁住最后一个键之后的间隙
+func TestLocking_ScanAndCursor(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	for _, key := range []uint32{1, 3, 5, 8} {
+		rm.InsertRecord(createTestRecord(key, "value"), tx)
+	}
+	rm.transactionManager.Commit(tx.TransactionID)
+
+	reader := Transaction.NewTransaction(2, 3, Transaction.RepeatableRead)
+	records, err := rm.Scan(ClosedRange(createTestKey(2), createTestKey(6)), ScanOptions{Descending: true, Limit: 1}, reader)
+	if err != nil || len(records) != 1 || keyOf(records[0].GetKey()) != 5 {
+		t.Fatalf("降序查询结果不正确: %d 条, %v", len(records), err)
+	}
+	cursor := rm.NewCursor(reader)
+	count := 0
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		count++
+	}
+	if cursor.Err() != nil || count != 4 {
+		t.Fatalf("游标读到 %d 条记录, %v", count, cursor.Err())
+	}
+
+	// 5之前的间隙被降序查询锁住，8之后的间隙被读到最后的游标锁住
+	inside := make(chan error, 1)
+	go func() {
+		inside <- rm.InsertRecord(createTestRecord(4, "value"), Transaction.NewTransaction(3, 4, Transaction.ReadCommitted))
+	}()
+	afterLast := make(chan error, 1)
+	go func() {
+		afterLast <- rm.InsertRecord(createTestRecord(10, "value"), Transaction.NewTransaction(4, 5, Transaction.ReadCommitted))
+	}()
+	expectWrite(t, inside, true)
+	expectWrite(t, afterLast, true)
+	rm.transactionManager.Commit(reader.TransactionID)
+	expectWrite(t, inside, false)
+	expectWrite(t, afterLast, false)
+}
+
+// 测试未提交的删除锁住下一个键，可重复读的范围查询要等删除提交；读已提交不锁间隙
+func TestLocking_DeleteGap(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	for _, key := range []uint32{1, 3, 5} {
+		rm.InsertRecord(createTestRecord(key, "value"), tx)
+	}
+	rm.transactionManager.Commit(tx.TransactionID)
+
+	committed := Transaction.NewTransaction(2, 3, Transaction.ReadCommitted)
+	if _, err := rm.RangeQuery(createTestKey(0), createTestKey(9), committed); err != nil {
+		t.Fatalf("范围查询失败: %v", err)
+	}
+	if err := rm.InsertRecord(createTestRecord(2, "value"), committed); err != nil {
+		t.Fatalf("读已提交不应该锁住间隙: %v", err)
+	}
+	rm.transactionManager.Commit(committed.TransactionID)
+
+	deleter := Transaction.NewTransaction(3, 4, Transaction.ReadCommitted)
+	if err := rm.DeleteRecord(createTestKey(3), deleter); err != nil {
+		t.Fatalf("删除记录失败: %v", err)
+	}
+	result := make(chan int, 1)
+	go func() {
+		reader := Transaction.NewTransaction(4, 5, Transaction.RepeatableRead)
+		records, err := rm.RangeQuery(createTestKey(2), createTestKey(4), reader)
+		if err != nil {
+			t.Errorf("范围查询失败: %v", err)
+		}
+		rm.transactionManager.Commit(reader.TransactionID)
+		result <- len(records)
+	}()
+	select {
+	case <-result:
+		t.Fatal("范围查询应该等待删除提交")
+	case <-time.After(50 * time.Millisecond):
+	}
+	rm.transactionManager.Commit(deleter.TransactionID)
+	select {
+	case count := <-result:
+		if count != 1 {
+			t.Errorf("删除提交后范围中应该只剩 1 条记录, 实际 %d", count)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("删除提交后范围查询应该继续")
+	}
+}
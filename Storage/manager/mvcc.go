@@ -0,0 +1,348 @@
+package manager
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"wudb/Entity/Record"
+	"wudb/Transaction"
+)
+
+// 多版本并发控制：B+树中只保存每个键的最新版本，记录头中记下写入它的事务，被覆盖的旧版本按键串成版本链放在内存中。
+// 读操作不加锁，最新版本的写入者对快照可见时直接返回，否则沿版本链往回找到对快照可见的版本；
+// 读已提交每次读都使用最新的快照，可重复读和可串行化使用事务开始时的快照。
+// 写操作仍然对键加排他锁，可重复读和可串行化的事务覆盖快照之后提交的版本时回滚（先更新者胜）。
+// 版本链只在内存中，重启后所有数据都已提交，不再需要旧版本
+
+// 可重复读的事务要修改的记录在快照之后被其他事务修改过，事务已经回滚，可以重试
+const ErrWriteConflict = Error("写冲突，记录在快照之后被其他事务修改，事务被回滚")
+
+// 一个被覆盖的版本
+type recordVersion struct {
+	record     *Record.Record // 被覆盖之前的记录，nil表示键还不存在
+	overwriter int32          // 覆盖它的事务，也就是下一个较新版本的写入者
+}
+
+// 版本链，新的在前。keys按键排序索引有版本链的键，范围查询只看范围内的键。
+// 旧版本只保存在内存中，数量受最早的活动快照限制：写操作顺便回收同一个键上不再需要的版本，
+// 事务结束使最早的快照前进时回收全部；没有长时间活动的快照时只保留活动事务留下的版本
+type versionStore struct {
+	mutex     sync.RWMutex
+	chains    map[string][]recordVersion
+	keys      []string // 有版本链的键，按字节序排列
+	collected uint32   // 上一次全部回收时的最早快照
+}
+
+func newVersionStore() *versionStore {
+	return &versionStore{chains: make(map[string][]recordVersion)}
+}
+
+// 事务覆盖了键的当前版本，保存旧版本
+func (vs *versionStore) push(key []byte, record *Record.Record, overwriter int32) {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	chain, ok := vs.chains[string(key)]
+	if !ok {
+		i := sort.SearchStrings(vs.keys, string(key))
+		vs.keys = append(vs.keys, "")
+		copy(vs.keys[i+1:], vs.keys[i:])
+		vs.keys[i] = string(key)
+	}
+	vs.chains[string(key)] = append([]recordVersion{{record: record, overwriter: overwriter}}, chain...)
+}
+
+// 删除键的版本链和索引，调用方持有mutex
+func (vs *versionStore) remove(key string) {
+	delete(vs.chains, key)
+	if i := sort.SearchStrings(vs.keys, key); i < len(vs.keys) && vs.keys[i] == key {
+		vs.keys = append(vs.keys[:i], vs.keys[i+1:]...)
+	}
+}
+
+// 撤销事务最近一次对键的修改时丢弃它保存的旧版本
+func (vs *versionStore) pop(key []byte, overwriter int32) {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	chain := vs.chains[string(key)]
+	if len(chain) == 0 || chain[0].overwriter != overwriter {
+		return
+	}
+	if len(chain) == 1 {
+		vs.remove(string(key))
+		return
+	}
+	vs.chains[string(key)] = chain[1:]
+}
+
+// 从当前版本开始沿版本链往回找，返回第一个写入者可见的版本，nil表示键对快照不存在，
+// 同时返回跳过的较新版本的写入者。当前版本的写入者在记录头中，可见时不用查版本链；
+// 链尾的版本是垃圾回收时已经对所有快照可见的版本
+func (vs *versionStore) visible(key []byte, current *Record.Record, isVisible func(writer int32) bool) (*Record.Record, []int32) {
+	if current != nil && isVisible(int32(current.Header.GetTransactionID())) {
+		return current, nil
+	}
+	vs.mutex.RLock()
+	defer vs.mutex.RUnlock()
+	state := current
+	var skipped []int32
+	for _, version := range vs.chains[string(key)] {
+		if isVisible(version.overwriter) {
+			return state, skipped
+		}
+		skipped = append(skipped, version.overwriter)
+		state = version.record
+	}
+	return state, skipped
+}
+
+// 当前版本的写入者，已经对所有快照可见时返回0
+func (vs *versionStore) lastWriter(key []byte) int32 {
+	vs.mutex.RLock()
+	defer vs.mutex.RUnlock()
+	chain := vs.chains[string(key)]
+	if len(chain) == 0 {
+		return 0
+	}
+	return chain[0].overwriter
+}
+
+// 版本的覆盖者对所有快照可见时，这个版本和更旧的版本都不会再被读到
+func (vs *versionStore) collect(key string, visibleToAll func(writer int32) bool) {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	vs.collectChain(key, visibleToAll)
+}
+
+// 最早的快照比上一次全部回收时前进了
+func (vs *versionStore) advance(oldest uint32) bool {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	if oldest <= vs.collected {
+		return false
+	}
+	vs.collected = oldest
+	return true
+}
+
+// 回收所有版本链
+func (vs *versionStore) collectAll(visibleToAll func(writer int32) bool) {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	// collectChain会从keys中删除键，先复制一份
+	for _, key := range append([]string(nil), vs.keys...) {
+		vs.collectChain(key, visibleToAll)
+	}
+}
+
+func (vs *versionStore) collectChain(key string, visibleToAll func(writer int32) bool) {
+	chain := vs.chains[key]
+	for i, version := range chain {
+		if visibleToAll(version.overwriter) {
+			if i == 0 {
+				vs.remove(key)
+			} else {
+				vs.chains[key] = chain[:i:i]
+			}
+			return
+		}
+	}
+}
+
+// 版本链中键在范围内的键，按键排序
+func (vs *versionStore) keysInRange(keyRange KeyRange) [][]byte {
+	vs.mutex.RLock()
+	defer vs.mutex.RUnlock()
+	i := 0
+	if !keyRange.Start.Unbounded {
+		i = sort.SearchStrings(vs.keys, string(keyRange.Start.Key))
+	}
+	var keys [][]byte
+	for ; i < len(vs.keys); i++ {
+		key := []byte(vs.keys[i])
+		if !keyRange.beforeEnd(key) {
+			break
+		}
+		if keyRange.afterStart(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// 版本链的数量和旧版本的总数
+func (vs *versionStore) size() (int, int) {
+	vs.mutex.RLock()
+	defer vs.mutex.RUnlock()
+	versions := 0
+	for _, chain := range vs.chains {
+		versions += len(chain)
+	}
+	return len(vs.chains), versions
+}
+
+// 回收所有活动快照都看不到的旧版本，返回剩下的旧版本数量
+func (rm *RecordManager) CollectGarbage() int {
+	rm.collectGarbage(rm.transactionManager.OldestSnapshot())
+	_, versions := rm.versions.size()
+	return versions
+}
+
+func (rm *RecordManager) collectGarbage(oldest uint32) {
+	rm.versions.collectAll(rm.visibleToAll(oldest))
+	// 提交时间戳不晚于最早快照的事务对所有快照可见，不再需要记住它们的提交时间戳和读写依赖
+	rm.transactionManager.PruneCommitTimestamps(oldest)
+	rm.serializable.collect(oldest)
+}
+
+// 事务结束后回滚的事务不再参与读写依赖；最早的快照因此前进时回收所有快照都看不到的旧版本
+func (rm *RecordManager) finishTransaction(tx *Transaction.Transaction) {
+	if tx.Status == Transaction.Aborted {
+		rm.serializable.abort(tx.TransactionID)
+	}
+	if oldest := rm.transactionManager.OldestSnapshot(); rm.versions.advance(oldest) {
+		rm.collectGarbage(oldest)
+	}
+}
+
+// 多版本模式下写记录前在记录头中记下写入它的事务，读操作由它判断树中的最新版本对快照是否可见。
+// 提交时间戳在写入时还不知道，由事务管理器按事务号查
+func (rm *RecordManager) stampRecord(record *Record.Record, tx *Transaction.Transaction) {
+	if !rm.mvcc {
+		return
+	}
+	record.Header.SetTransactionID(uint32(tx.TransactionID))
+}
+
+// 写操作修改树之前把键的当前版本放进版本链，顺便回收这个键上不再需要的旧版本。
+// 读操作不持有写操作的闩，先保存再修改，读到树中的新版本时版本链中一定已经有它覆盖的版本。
+// 修改失败时用discardVersion丢弃
+func (rm *RecordManager) saveVersion(key []byte, tx *Transaction.Transaction) error {
+	if !rm.mvcc {
+		return nil
+	}
+	current, err := rm.findRecord(key)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	rm.versions.push(key, current, tx.TransactionID)
+	rm.versions.collect(string(key), rm.visibleToAll(rm.transactionManager.OldestSnapshot()))
+	return nil
+}
+
+// 写操作失败，丢弃修改前保存的版本
+func (rm *RecordManager) discardVersion(key []byte, tx *Transaction.Transaction) {
+	if rm.mvcc {
+		rm.versions.pop(key, tx.TransactionID)
+	}
+}
+
+// 已经持有排他锁时检查写冲突：可重复读和可串行化的事务不能覆盖快照看不到的版本。
+// 持有排他锁时当前版本的写入者已经提交
+func (rm *RecordManager) checkWriteConflict(tx *Transaction.Transaction, key []byte) error {
+	if !rm.mvcc || tx.IsolationLevel < Transaction.RepeatableRead {
+		return nil
+	}
+	snapshot := rm.transactionManager.Snapshot(tx)
+	writer := rm.versions.lastWriter(key)
+	if writer == 0 || writer == tx.TransactionID || rm.transactionManager.IsCommittedBefore(writer, snapshot) {
+		return nil
+	}
+	return rm.abortOnConflict(tx, ErrWriteConflict)
+}
+
+// 在事务的快照中查找记录。先读树中的最新版本再读版本链，
+// 写操作先保存旧版本再修改树，两次读之间的修改不会丢失版本
+func (rm *RecordManager) findVisibleRecord(key []byte, tx *Transaction.Transaction) (*Record.Record, error) {
+	snapshot := rm.transactionManager.Snapshot(tx)
+	rm.recordRead(tx, ClosedRange(key, key))
+	current, err := rm.findRecord(key)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	record, skipped := rm.versions.visible(key, current, rm.visibleTo(tx, snapshot))
+	rm.recordSkipped(tx, skipped)
+	if record == nil {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+// 在事务的快照中按选项做范围查询。先按Offset+Limit从树中读最新版本，
+// 再合并版本链中读过的那部分范围内的键；可见的记录不够时加倍读的数量重新读，直到读完整个范围
+func (rm *RecordManager) scanVisible(keyRange KeyRange, options ScanOptions, tx *Transaction.Transaction) ([]*Record.Record, error) {
+	snapshot := rm.transactionManager.Snapshot(tx)
+	want := 0
+	if options.Limit > 0 {
+		want = options.Offset + options.Limit
+	}
+	for limit := want; ; limit *= 2 {
+		records, err := rm.scanRange(keyRange, ScanOptions{Descending: options.Descending, Limit: limit})
+		if err != nil {
+			return nil, err
+		}
+		covered := keyRange
+		exhausted := limit == 0 || len(records) < limit
+		if !exhausted {
+			last := Included(records[len(records)-1].GetKey())
+			if options.Descending {
+				covered.Start = last
+			} else {
+				covered.End = last
+			}
+		}
+		visible := rm.visibleRecords(tx, snapshot, records, covered, options.Descending)
+		if exhausted || len(visible) >= want {
+			visible = skipRecords(visible, options.Offset)
+			if options.Limit > 0 && len(visible) > options.Limit {
+				visible = visible[:options.Limit]
+			}
+			return visible, nil
+		}
+	}
+}
+
+// 把从树中读到的covered范围内的最新版本和版本链中这个范围内的键（被删除的键）合并成快照中的记录，
+// 按扫描方向排列。快照要在读树之前取得；读树之后、读版本链之前记录读集合，
+// 在这之前完成的写入会在版本链中被跳过，之后的写入能找到这个读者
+func (rm *RecordManager) visibleRecords(tx *Transaction.Transaction, snapshot uint32, records []*Record.Record, covered KeyRange, descending bool) []*Record.Record {
+	rm.recordRead(tx, covered)
+	current := make(map[string]*Record.Record, len(records))
+	keys := make([][]byte, 0, len(records))
+	for _, record := range records {
+		current[string(record.GetKey())] = record
+		keys = append(keys, record.GetKey())
+	}
+	for _, key := range rm.versions.keysInRange(covered) {
+		if _, ok := current[string(key)]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return (bytes.Compare(keys[i], keys[j]) < 0) != descending })
+
+	isVisible := rm.visibleTo(tx, snapshot)
+	var results []*Record.Record
+	var skipped []int32
+	for _, key := range keys {
+		record, writers := rm.versions.visible(key, current[string(key)], isVisible)
+		skipped = append(skipped, writers...)
+		if record != nil {
+			results = append(results, record)
+		}
+	}
+	rm.recordSkipped(tx, skipped)
+	return results
+}
+
+// 事务自己写的版本和快照之前提交的版本可见
+func (rm *RecordManager) visibleTo(tx *Transaction.Transaction, snapshot uint32) func(int32) bool {
+	return func(writer int32) bool {
+		return writer == tx.TransactionID || rm.transactionManager.IsCommittedBefore(writer, snapshot)
+	}
+}
+
+// 在最早的快照之前提交的版本对所有快照可见
+func (rm *RecordManager) visibleToAll(oldest uint32) func(int32) bool {
+	return func(writer int32) bool {
+		return rm.transactionManager.IsCommittedBefore(writer, oldest)
+	}
+}
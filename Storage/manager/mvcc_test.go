@@ -0,0 +1,281 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"wudb/Transaction"
+)
+
+// 打开多版本模式的记录管理器并提交一条初始记录
+func setupMVCCTest(t *testing.T) (*RecordManager, func()) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	rm.mvcc = true
+	tx := Transaction.NewTransaction(1, 2, Transaction.ReadCommitted)
+	if err := rm.InsertRecord(createTestRecord(1, "v1"), tx); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	if err := rm.transactionManager.Commit(tx.TransactionID); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	return rm, cleanup
+}
+
+func expectValue(t *testing.T, rm *RecordManager, tx *Transaction.Transaction, value string) {
+	t.Helper()
+	record, err := rm.FindRecord(createTestKey(1), tx)
+	if value == "" {
+		if err != ErrNotFound {
+			t.Errorf("事务 %d 不应该看到记录: %v", tx.TransactionID, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("事务 %d 查找记录失败: %v", tx.TransactionID, err)
+	}
+	if string(record.Value) != value {
+		t.Errorf("事务 %d 读到的值不正确: 期望 %q, 实际 %q", tx.TransactionID, value, record.Value)
+	}
+}
+
+// 测试读已提交每次读看到最新提交的版本，可重复读一直看到事务开始时的快照
+func TestMVCC_IsolationLevels(t *testing.T) {
+	rm, cleanup := setupMVCCTest(t)
+	defer cleanup()
+
+	rc := Transaction.NewTransaction(2, 3, Transaction.ReadCommitted)
+	rr := Transaction.NewTransaction(3, 4, Transaction.RepeatableRead)
+	expectValue(t, rm, rc, "v1")
+	expectValue(t, rm, rr, "v1")
+
+	// 未提交的修改对其他事务不可见，读操作也不会等待
+	writer := Transaction.NewTransaction(4, 5, Transaction.ReadCommitted)
+	if err := rm.UpdateRecord(createTestRecord(1, "v2"), writer); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+	expectValue(t, rm, writer, "v2")
+	expectValue(t, rm, rc, "v1")
+	expectValue(t, rm, rr, "v1")
+	rm.transactionManager.Commit(writer.TransactionID)
+	expectValue(t, rm, rc, "v2")
+	expectValue(t, rm, rr, "v1")
+
+	// 删除之后可重复读仍然能看到快照中的记录，范围查询也一样
+	deleter := Transaction.NewTransaction(5, 6, Transaction.ReadCommitted)
+	if err := rm.DeleteRecord(createTestKey(1), deleter); err != nil {
+		t.Fatalf("删除记录失败: %v", err)
+	}
+	rm.transactionManager.Commit(deleter.TransactionID)
+	expectValue(t, rm, rc, "")
+	expectValue(t, rm, rr, "v1")
+	records, err := rm.RangeQuery(createTestKey(0), createTestKey(10), rr)
+	if err != nil {
+		t.Fatalf("范围查询失败: %v", err)
+	}
+	if len(records) != 1 || string(records[0].Value) != "v1" {
+		t.Errorf("可重复读的范围查询应该看到快照中的记录: %v", records)
+	}
+	records, err = rm.RangeQuery(createTestKey(0), createTestKey(10), rc)
+	if err != nil {
+		t.Fatalf("范围查询失败: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("读已提交的范围查询不应该看到已删除的记录: %d 条", len(records))
+	}
+
+	// 新的事务看不到已删除的记录
+	expectValue(t, rm, Transaction.NewTransaction(6, 7, Transaction.RepeatableRead), "")
+}
+
+// 测试分页查询和游标只返回快照中的记录，包括树中已经删除的记录
+func TestMVCC_ScanAndCursor(t *testing.T) {
+	rm, cleanup := setupMVCCTest(t)
+	defer cleanup()
+
+	rr := Transaction.NewTransaction(2, 3, Transaction.RepeatableRead)
+	expectValue(t, rm, rr, "v1")
+	writer := Transaction.NewTransaction(3, 4, Transaction.ReadCommitted)
+	for k := uint32(2); k < 40; k++ {
+		if err := rm.InsertRecord(createTestRecord(k, "new"), writer); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+	if err := rm.DeleteRecord(createTestKey(1), writer); err != nil {
+		t.Fatalf("删除记录失败: %v", err)
+	}
+	rm.transactionManager.Commit(writer.TransactionID)
+
+	// 树中最新的版本都不可见，降序查询要读完整个范围才能找到删除的记录
+	records, err := rm.Scan(KeyRange{Unbounded(), Unbounded()}, ScanOptions{Descending: true, Limit: 1}, rr)
+	if err != nil || len(records) != 1 || string(records[0].Value) != "v1" {
+		t.Fatalf("可重复读的降序查询应该只看到快照中的记录: %d 条, %v", len(records), err)
+	}
+	cursor := rm.NewCursor(rr)
+	defer cursor.Close()
+	for _, ok := range []bool{cursor.First(), cursor.Last()} {
+		if !ok || keyOf(cursor.Key()) != 1 || string(cursor.Value()) != "v1" {
+			t.Errorf("游标应该指向快照中的记录: %v", cursor.Err())
+		}
+	}
+	if cursor.Next() || cursor.Err() != nil {
+		t.Errorf("快照中只有一条记录: %v", cursor.Err())
+	}
+
+	// 新的事务看到插入的记录
+	cursor = rm.NewCursor(Transaction.NewTransaction(4, 5, Transaction.RepeatableRead))
+	count := 0
+	for ok := cursor.Last(); ok; ok = cursor.Prev() {
+		count++
+	}
+	if cursor.Err() != nil || count != 38 {
+		t.Errorf("新的事务应该看到 38 条记录, 实际 %d, %v", count, cursor.Err())
+	}
+}
+
+// 测试写入的记录头中带有事务号，回滚后旧版本被丢弃
+func TestMVCC_Rollback(t *testing.T) {
+	rm, cleanup := setupMVCCTest(t)
+	defer cleanup()
+
+	writer := Transaction.NewTransaction(2, 3, Transaction.ReadCommitted)
+	record := createTestRecord(1, "v2")
+	if err := rm.UpdateRecord(record, writer); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+	if err := rm.InsertRecord(createTestRecord(2, "new"), writer); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	stored, err := rm.findRecord(createTestKey(1))
+	if err != nil {
+		t.Fatalf("查找记录失败: %v", err)
+	}
+	if stored.Header.GetTransactionID() != uint32(writer.TransactionID) {
+		t.Errorf("记录头中的事务号不正确: %d", stored.Header.GetTransactionID())
+	}
+	if chains, _ := rm.versions.size(); chains != 2 {
+		t.Errorf("应该有 2 条版本链, 实际 %d", chains)
+	}
+
+	if err := rm.Rollback(writer); err != nil {
+		t.Fatalf("回滚失败: %v", err)
+	}
+	if chains, _ := rm.versions.size(); chains != 0 {
+		t.Errorf("回滚后版本链应该被丢弃, 实际 %d", chains)
+	}
+	reader := Transaction.NewTransaction(3, 4, Transaction.RepeatableRead)
+	expectValue(t, rm, reader, "v1")
+	if _, err := rm.FindRecord(createTestKey(2), reader); err != ErrNotFound {
+		t.Errorf("回滚的插入不应该可见: %v", err)
+	}
+}
+
+// 测试旧版本在没有快照能看到之后被回收
+func TestMVCC_GarbageCollection(t *testing.T) {
+	rm, cleanup := setupMVCCTest(t)
+	defer cleanup()
+
+	reader := Transaction.NewTransaction(2, 3, Transaction.RepeatableRead)
+	expectValue(t, rm, reader, "v1")
+	for i := 0; i < 10; i++ {
+		writer := Transaction.NewTransaction(int32(10+i), int32(11+i), Transaction.ReadCommitted)
+		if err := rm.UpdateRecord(createTestRecord(1, "v"+string(rune('a'+i))), writer); err != nil {
+			t.Fatalf("更新记录失败: %v", err)
+		}
+		rm.transactionManager.Commit(writer.TransactionID)
+	}
+
+	// 读事务的快照还需要最早的版本
+	if versions := rm.CollectGarbage(); versions != 10 {
+		t.Errorf("活动快照需要的版本不能回收: 期望 10, 实际 %d", versions)
+	}
+	expectValue(t, rm, reader, "v1")
+
+	// 读事务结束后最早的快照前进，不用等检查点就回收
+	rm.transactionManager.Commit(reader.TransactionID)
+	if _, versions := rm.versions.size(); versions != 0 {
+		t.Errorf("没有活动快照后旧版本应该全部回收, 实际 %d", versions)
+	}
+	expectValue(t, rm, Transaction.NewTransaction(30, 31, Transaction.RepeatableRead), "vj")
+}
+
+// 测试没有活动快照时，旧版本在写入的事务提交后就被回收，版本链不会随写入次数增长
+func TestMVCC_VersionBound(t *testing.T) {
+	rm, cleanup := setupMVCCTest(t)
+	defer cleanup()
+
+	for i := 0; i < 100; i++ {
+		writer := Transaction.NewTransaction(int32(10+i), int32(11+i), Transaction.ReadCommitted)
+		if err := rm.UpdateRecord(createTestRecord(1, fmt.Sprintf("v%d", i)), writer); err != nil {
+			t.Fatalf("更新记录失败: %v", err)
+		}
+		rm.transactionManager.Commit(writer.TransactionID)
+		if chains, versions := rm.versions.size(); chains != 0 || versions != 0 {
+			t.Fatalf("提交后旧版本应该全部回收: %d 条版本链, %d 个版本", chains, versions)
+		}
+	}
+}
+
+// 测试版本链的键按顺序索引，范围查询只返回范围内的键，回收后从索引中删除
+func TestVersionStore_KeysInRange(t *testing.T) {
+	vs := newVersionStore()
+	for _, key := range []string{"d", "a", "c", "", "b", "e"} {
+		vs.push([]byte(key), nil, 1)
+	}
+	vs.push([]byte("c"), nil, 2)
+
+	tests := []struct {
+		keyRange KeyRange
+		keys     string
+	}{
+		{ClosedRange([]byte("b"), []byte("d")), "[b c d]"},
+		{KeyRange{Excluded([]byte("b")), Excluded([]byte("d"))}, "[c]"},
+		{KeyRange{Unbounded(), Excluded([]byte("b"))}, "[ a]"},
+		{KeyRange{Included([]byte("d")), Unbounded()}, "[d e]"},
+		{ClosedRange([]byte("x"), []byte("z")), "[]"},
+	}
+	for _, tt := range tests {
+		var keys []string
+		for _, key := range vs.keysInRange(tt.keyRange) {
+			keys = append(keys, string(key))
+		}
+		if got := fmt.Sprint(keys); got != tt.keys {
+			t.Errorf("范围 %+v: 期望 %s, 实际 %s", tt.keyRange, tt.keys, got)
+		}
+	}
+
+	vs.pop([]byte("a"), 1)
+	vs.collectAll(func(writer int32) bool { return writer == 1 })
+	if got := fmt.Sprint(vs.keys); got != "[c]" || len(vs.chains) != 1 {
+		t.Errorf("回收后只剩键 c 的版本链, 实际 %s", got)
+	}
+}
+
+// 测试可重复读的事务不能覆盖快照之后提交的版本，读已提交可以
+func TestMVCC_WriteConflict(t *testing.T) {
+	rm, cleanup := setupMVCCTest(t)
+	defer cleanup()
+
+	rr := Transaction.NewTransaction(2, 3, Transaction.RepeatableRead)
+	rc := Transaction.NewTransaction(3, 4, Transaction.ReadCommitted)
+	expectValue(t, rm, rr, "v1")
+	expectValue(t, rm, rc, "v1")
+
+	writer := Transaction.NewTransaction(4, 5, Transaction.ReadCommitted)
+	if err := rm.UpdateRecord(createTestRecord(1, "v2"), writer); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+	rm.transactionManager.Commit(writer.TransactionID)
+
+	err := rm.UpdateRecord(createTestRecord(1, "rr"), rr)
+	if !errors.Is(err, ErrWriteConflict) {
+		t.Fatalf("可重复读的事务应该得到写冲突: %v", err)
+	}
+	if rr.Status != Transaction.Aborted {
+		t.Errorf("写冲突的事务应该被回滚")
+	}
+	if err := rm.UpdateRecord(createTestRecord(1, "rc"), rc); err != nil {
+		t.Fatalf("读已提交的事务应该可以更新: %v", err)
+	}
+	rm.transactionManager.Commit(rc.TransactionID)
+	expectValue(t, rm, Transaction.NewTransaction(5, 6, Transaction.RepeatableRead), "rc")
+}
@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"fmt"
+	"wudb/Entity/Page"
+	"wudb/Entity/Record"
+)
+
+// 值超过阈值的记录，值写入一串溢出页，叶子节点中只保存指向链表的指针
+
+const (
+	DefaultOverflowThreshold = 512 // 默认溢出阈值
+	// 最大溢出阈值，保证叶子节点中的记录不超过页面能容纳的长度
+	MaxOverflowThreshold = Page.MaxRecordSize - Record.RecordHeaderSize - Page.KeyMaxSize
+)
+
+// 值太大时写入溢出页，返回实际保存在叶子节点中的记录。
+// 写溢出页的操作持有结构闩直到结束，必须在加页面的闩之前调用
+func (rm *RecordManager) spillRecord(record *Record.Record, op *operation) (*Record.Record, error) {
+	if len(record.Value) <= rm.overflowThreshold {
+		return record, nil
+	}
+	firstPageID, err := rm.writeOverflowChain(record.Value, op)
+	if err != nil {
+		return nil, fmt.Errorf("写入溢出页失败: %v", err)
+	}
+	stored := Record.NewRecord(record.Header, record.Key, nil)
+	stored.SetOverflow(firstPageID, uint32(len(record.Value)))
+	return stored, nil
+}
+
+// 读出溢出页中的值，返回完整的记录
+func (rm *RecordManager) loadRecord(stored *Record.Record) (*Record.Record, error) {
+	if stored == nil || !stored.IsOverflow() {
+		return stored, nil
+	}
+	firstPageID, valueLength := stored.GetOverflow()
+	value, err := rm.readOverflowChain(firstPageID, valueLength)
+	if err != nil {
+		return nil, err
+	}
+	record := Record.NewRecord(stored.Header, stored.Key, value)
+	record.Header.SetFlags(record.Header.GetFlags() &^ Record.FlagOverflow)
+	return record, nil
+}
+
+// 记录从树中移除后调用：读出完整的记录，再释放它的溢出页
+func (rm *RecordManager) releaseRecord(stored *Record.Record, op *operation) (*Record.Record, error) {
+	record, err := rm.loadRecord(stored)
+	if err != nil {
+		return nil, err
+	}
+	if err := rm.freeOverflow(stored, op); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// 释放记录的溢出页。溢出的记录只由持有结构闩的操作写入和删除
+func (rm *RecordManager) freeOverflow(stored *Record.Record, op *operation) error {
+	if stored == nil || !stored.IsOverflow() {
+		return nil
+	}
+	if !op.structural {
+		return fmt.Errorf("释放溢出页的操作没有持有结构闩")
+	}
+	firstPageID, _ := stored.GetOverflow()
+	return rm.freeOverflowChain(firstPageID)
+}
+
+// 把值按页切分写入溢出页链表，返回第一个溢出页ID
+func (rm *RecordManager) writeOverflowChain(value []byte, op *operation) (uint32, error) {
+	op.lockStructure()
+	// 从最后一块开始写，每个页面创建时就能记下后继页
+	nextPageID := uint32(0)
+	chunks := (len(value) + Page.OverflowDataSize - 1) / Page.OverflowDataSize
+	for i := chunks - 1; i >= 0; i-- {
+		page, err := op.newPage(Page.OverflowPageID)
+		if err != nil {
+			rm.freeOverflowChain(nextPageID)
+			return 0, err
+		}
+		end := (i + 1) * Page.OverflowDataSize
+		if end > len(value) {
+			end = len(value)
+		}
+		page.SetOverflowData(value[i*Page.OverflowDataSize : end])
+		page.Header.NextPageID = nextPageID
+		nextPageID = page.Header.PageID
+		op.unpinPage(nextPageID, true)
+		// 每写一页就记录日志，写好的溢出页可以被淘汰，长链表不会占满缓冲池
+		if _, err := op.log(nil); err != nil {
+			rm.freeOverflowChain(nextPageID)
+			return 0, err
+		}
+	}
+	return nextPageID, nil
+}
+
+// 沿溢出页链表读出完整的值
+func (rm *RecordManager) readOverflowChain(firstPageID uint32, valueLength uint32) ([]byte, error) {
+	value := make([]byte, 0, valueLength)
+	for pageID := firstPageID; pageID != 0; {
+		page, err := rm.bufferPool.FetchPage(pageID)
+		if err != nil {
+			return nil, err
+		}
+		if page.Header.PageType != Page.OverflowPageID {
+			rm.bufferPool.UnpinPage(pageID, false)
+			return nil, fmt.Errorf("页面 %d 不是溢出页", pageID)
+		}
+		value = append(value, page.GetOverflowData()...)
+		nextPageID := page.Header.NextPageID
+		rm.bufferPool.UnpinPage(pageID, false)
+		pageID = nextPageID
+	}
+	if uint32(len(value)) != valueLength {
+		return nil, fmt.Errorf("溢出页数据长度不一致: 期望 %d, 实际 %d", valueLength, len(value))
+	}
+	return value, nil
+}
+
+// 释放整条溢出页链表
+func (rm *RecordManager) freeOverflowChain(firstPageID uint32) error {
+	for pageID := firstPageID; pageID != 0; {
+		page, err := rm.bufferPool.FetchPage(pageID)
+		if err != nil {
+			return err
+		}
+		nextPageID := page.Header.NextPageID
+		if err := rm.bufferPool.DeletePage(pageID); err != nil {
+			rm.bufferPool.UnpinPage(pageID, false)
+			return err
+		}
+		pageID = nextPageID
+	}
+	return nil
+}
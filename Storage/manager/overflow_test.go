@@ -0,0 +1,169 @@
+package manager
+
+import (
+	"bytes"
+	"testing"
+	"wudb/Entity/Page"
+)
+
+// 生成不重复的大值，便于发现拼接顺序错误
+func createLargeValue(size int) []byte {
+	value := make([]byte, size)
+	for i := range value {
+		value[i] = byte(i % 251)
+	}
+	return value
+}
+
+// 测试大值写入溢出页后可以完整读出
+func TestOverflow_InsertAndFind(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	sizes := []int{DefaultOverflowThreshold + 1, 20 * 1024, 50 * 1024}
+	for i, size := range sizes {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), string(createLargeValue(size))), tx); err != nil {
+			t.Fatalf("插入 %d 字节的记录失败: %v", size, err)
+		}
+	}
+	for i, size := range sizes {
+		record, err := rm.findRecord(createTestKey(uint32(i)))
+		if err != nil {
+			t.Fatalf("查找记录失败: %v", err)
+		}
+		if !bytes.Equal(record.Value, createLargeValue(size)) {
+			t.Errorf("%d 字节的值读出后不一致", size)
+		}
+		if record.IsOverflow() {
+			t.Error("读出的记录不应带有溢出标记")
+		}
+	}
+
+	// 范围查询同样返回完整的值
+	results, err := rm.rangeQuery(createTestKey(0), createTestKey(uint32(len(sizes)-1)))
+	if err != nil {
+		t.Fatalf("范围查询失败: %v", err)
+	}
+	if len(results) != len(sizes) {
+		t.Fatalf("范围查询结果数量不正确: 期望 %d, 实际 %d", len(sizes), len(results))
+	}
+	for i, record := range results {
+		if len(record.Value) != sizes[i] {
+			t.Errorf("第 %d 条结果的值长度不正确: 期望 %d, 实际 %d", i, sizes[i], len(record.Value))
+		}
+	}
+
+	// 叶子节点中只保存指针
+	leaf, err := rm.findLeaf(createTestKey(0), nil)
+	if err != nil || leaf == nil {
+		t.Fatalf("查找叶子节点失败: %v", err)
+	}
+	defer rm.bufferPool.UnpinPageRead(leaf.Header.PageID)
+	stored, err := leaf.FindRecord(createTestKey(2))
+	if err != nil {
+		t.Fatalf("查找叶子记录失败: %v", err)
+	}
+	if !stored.IsOverflow() {
+		t.Error("大值记录应该带有溢出标记")
+	}
+	if _, length := stored.GetOverflow(); length != 50*1024 {
+		t.Errorf("溢出长度不正确: %d", length)
+	}
+}
+
+// 测试删除和更新记录时释放溢出页
+func TestOverflow_FreeChain(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	size := 50 * 1024
+	chainLength := (size + Page.OverflowDataSize - 1) / Page.OverflowDataSize
+	if err := rm.InsertRecord(createTestRecord(1, string(createLargeValue(size))), tx); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+
+	// 大值改成小值，溢出页全部进入空闲链表
+	if err := rm.UpdateRecord(createTestRecord(1, "small"), tx); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+	freePages, err := rm.pageManager.GetFreePageIDs()
+	if err != nil {
+		t.Fatalf("读取空闲链表失败: %v", err)
+	}
+	if len(freePages) != chainLength {
+		t.Errorf("空闲页数量不正确: 期望 %d, 实际 %d", chainLength, len(freePages))
+	}
+	record, err := rm.findRecord(createTestKey(1))
+	if err != nil || string(record.Value) != "small" {
+		t.Fatalf("更新后的记录不正确: %v", err)
+	}
+
+	// 小值改回大值，重新使用空闲页
+	if err := rm.UpdateRecord(createTestRecord(1, string(createLargeValue(size))), tx); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+	if freePages, _ := rm.pageManager.GetFreePageIDs(); len(freePages) != 0 {
+		t.Errorf("空闲页应该被重新使用, 剩余 %d", len(freePages))
+	}
+	record, err = rm.findRecord(createTestKey(1))
+	if err != nil || !bytes.Equal(record.Value, createLargeValue(size)) {
+		t.Fatalf("更新后的大值不正确: %v", err)
+	}
+
+	// 删除记录后溢出页全部释放
+	if err := rm.DeleteRecord(createTestKey(1), tx); err != nil {
+		t.Fatalf("删除记录失败: %v", err)
+	}
+	if freePages, _ := rm.pageManager.GetFreePageIDs(); len(freePages) != chainLength {
+		t.Errorf("空闲页数量不正确: 期望 %d, 实际 %d", chainLength, len(freePages))
+	}
+	if n := pinnedFrameCount(rm.bufferPool); n != 0 {
+		t.Errorf("仍有 %d 个页面被固定", n)
+	}
+}
+
+// 测试回滚时溢出页随记录一起恢复或释放
+func TestOverflow_Rollback(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	size := 20 * 1024
+	setup := createTestTransaction(t, rm)
+	if err := rm.InsertRecord(createTestRecord(1, string(createLargeValue(size))), setup); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	rm.transactionManager.Commit(setup.TransactionID)
+	meta, _ := rm.pageManager.GetMetaPage()
+	lastPageID := meta.LastPageID
+
+	tx := createTestTransaction(t, rm)
+	tx.TransactionID = 2
+	if err := rm.DeleteRecord(createTestKey(1), tx); err != nil {
+		t.Fatalf("删除记录失败: %v", err)
+	}
+	if err := rm.InsertRecord(createTestRecord(2, string(createLargeValue(size))), tx); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	if err := rm.Rollback(tx); err != nil {
+		t.Fatalf("回滚事务失败: %v", err)
+	}
+
+	// 被删除的大值恢复，新插入的记录和它的溢出页被释放
+	record, err := rm.findRecord(createTestKey(1))
+	if err != nil || !bytes.Equal(record.Value, createLargeValue(size)) {
+		t.Fatalf("回滚后记录不正确: %v", err)
+	}
+	if _, err := rm.findRecord(createTestKey(2)); err != ErrNotFound {
+		t.Errorf("期望 ErrNotFound, 实际 %v", err)
+	}
+	// 释放的溢出页被恢复的记录重新使用，文件没有增长
+	if freePages, _ := rm.pageManager.GetFreePageIDs(); len(freePages) != 0 {
+		t.Errorf("空闲页应该被重新使用, 剩余 %d", len(freePages))
+	}
+	meta, _ = rm.pageManager.GetMetaPage()
+	if meta.LastPageID != lastPageID {
+		t.Errorf("回滚后文件不应增长: 期望 %d, 实际 %d", lastPageID, meta.LastPageID)
+	}
+}
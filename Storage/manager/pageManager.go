@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"log"
 	"time"
+	"wudb/Entity/File"
 	"wudb/Entity/Page"
-	"wudb/Entity/Record"
+	"wudb/Transaction"
 	"wudb/Util"
 )
 
@@ -13,26 +14,98 @@ type PageManager struct {
 	fileHandle *Util.FileHandle
 	pageID     uint32
 	metaPage   *Page.PageBPlusTree
+	fileHeader *File.FileHeader // 文件头，FirstFreePage是空闲页链表的头
+
+	// 开启预写日志后，元数据页、文件头和释放的页面不立即写回：
+	// 先由操作日志记录它们的镜像，Flush时再写入文件
+	deferWrites    bool
+	metaDirty      bool
+	headerDirty    bool
+	freedPages     map[uint32]*Page.Page // 已释放还没写回的页面
+	unloggedMeta   bool
+	unloggedHeader bool
+	unloggedFreed  []uint32
+	recLSN         uint64 // 延迟写回的内容中第一条还没写回的修改的日志
+}
+
+// 页面或文件头的校验和不一致，页面在磁盘上已经损坏
+type CorruptionError struct {
+	PageID   uint32 // 文件头为Transaction.FileHeaderPageID
+	Stored   uint32 // 页面中保存的校验和
+	Computed uint32 // 按页面内容计算的校验和
+}
+
+func (e *CorruptionError) Error() string {
+	if e.PageID == Transaction.FileHeaderPageID {
+		return fmt.Sprintf("文件头已损坏: 保存的校验和 %08x, 计算的校验和 %08x", e.Stored, e.Computed)
+	}
+	return fmt.Sprintf("页面 %d 已损坏: 保存的校验和 %08x, 计算的校验和 %08x", e.PageID, e.Stored, e.Computed)
 }
 
 func NewPageManager(fileHandle *Util.FileHandle) *PageManager {
+	pm, err := OpenPageManager(fileHandle)
+	if err != nil {
+		log.Printf("打开页面管理器失败: %v", err)
+		return nil
+	}
+	return pm
+}
+
+// 读取文件头和元数据页，新文件先初始化；已有的文件头或元数据页损坏时返回错误
+func OpenPageManager(fileHandle *Util.FileHandle) (*PageManager, error) {
 	pm := &PageManager{
 		fileHandle: fileHandle,
+		freedPages: make(map[uint32]*Page.Page),
 	}
+	fileSize := fileHandle.GetFileSize()
 
-	// 尝试读取已存在的MetaPage
-	meta, err := pm.GetMetaPage()
-	if err != nil {
-		// 如果读取失败，说明MetaPage不存在，需要初始化
+	// 读取文件头，空闲页链表从文件头开始
+	if fileSize < FileHeaderSize {
+		pm.fileHeader = File.NewFileHeader()
+		if err := pm.fileHeader.WriteToFile(fileHandle); err != nil {
+			return nil, fmt.Errorf("初始化文件头失败: %v", err)
+		}
+	} else {
+		header, err := readFileHeader(fileHandle)
+		if err != nil {
+			return nil, err
+		}
+		pm.fileHeader = header
+	}
+
+	// 文件中只有文件头时初始化MetaPage
+	if fileSize <= FileHeaderSize {
 		if err := pm.InitMetaPage(); err != nil {
-			log.Printf("初始化MetaPage失败: %v", err)
-			return nil
+			return nil, fmt.Errorf("初始化MetaPage失败: %v", err)
 		}
-		meta, _ = pm.GetMetaPage()
+	} else if _, err := pm.GetMetaPage(); err != nil {
+		return nil, err
 	}
+	return pm, nil
+}
 
-	pm.metaPage = meta
-	return pm
+// 读取文件头并检查校验和，所有读取文件头的地方都经过这里
+func readFileHeader(fileHandle *Util.FileHandle) (*File.FileHeader, error) {
+	data, err := fileHandle.ReadAt(0, FileHeaderSize)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件头失败: %v", err)
+	}
+	header := &File.FileHeader{}
+	if err := header.DeserializeFrom(data); err != nil {
+		return nil, err
+	}
+	if computed := File.Checksum(data); computed != header.Checksum {
+		return nil, &CorruptionError{PageID: Transaction.FileHeaderPageID, Stored: header.Checksum, Computed: computed}
+	}
+	return header, nil
+}
+
+// 检查序列化后页面的校验和
+func verifyPage(pageID uint32, data []byte) error {
+	if stored, computed := Page.StoredChecksum(data), Page.Checksum(data); stored != computed {
+		return &CorruptionError{PageID: pageID, Stored: stored, Computed: computed}
+	}
+	return nil
 }
 
 // 普通页面相关
@@ -43,14 +116,14 @@ func (pm *PageManager) GetPage(pageID uint32) (*Page.Page, error) {
 	// 计算页面在文件中的偏移量
 	offset := int64(64) + int64(pageID)*int64(PageSize) // 64byte 是文件头大小
 
-	// 设置文件指针到正确的位置
-	pm.fileHandle.SetOffset(offset)
-
 	// 读取页面数据
-	data, err := pm.fileHandle.Read(int64(PageSize))
+	data, err := pm.fileHandle.ReadAt(offset, int64(PageSize))
 	if err != nil {
 		return nil, fmt.Errorf("读取页面失败: %v", err)
 	}
+	if err := verifyPage(pageID, data); err != nil {
+		return nil, err
+	}
 
 	// 解析页面数据
 	if err := page.DeserializeFrom(data); err != nil {
@@ -68,22 +141,31 @@ func (pm *PageManager) CreatePage(pageType uint32) (*Page.Page, error) {
 		return nil, err
 	}
 
-	page.Header.PageID = meta.LastPageID + 1
-	meta.LastPageID++
+	// 优先复用空闲页链表中的页面，链表为空时才扩展文件
+	if pm.fileHeader.FirstFreePage != 0 {
+		freePage, ok := pm.freedPages[pm.fileHeader.FirstFreePage]
+		if ok {
+			delete(pm.freedPages, freePage.Header.PageID)
+		} else if freePage, err = pm.GetPage(pm.fileHeader.FirstFreePage); err != nil {
+			return nil, fmt.Errorf("读取空闲页失败: %v", err)
+		}
+		if freePage.Header.IsDeleted != 1 {
+			return nil, fmt.Errorf("空闲页链表损坏: 页面 %d 未被释放", freePage.Header.PageID)
+		}
+		page.Header.PageID = freePage.Header.PageID
+		pm.fileHeader.FirstFreePage = freePage.Header.NextPageID
+	} else {
+		page.Header.PageID = meta.LastPageID + 1
+		meta.LastPageID++
+	}
 	page.Header.CreateTime = uint32(time.Now().Unix())
 	page.Header.ModifyTime = page.Header.CreateTime
 
-	// 序列化并写入页面
-	data, err := page.SerializeTo()
-	if err != nil {
-		return nil, fmt.Errorf("序列化页面失败: %v", err)
-	}
-
-	offset := int64(FileHeaderSize) + int64(page.Header.PageID)*int64(PageSize)
-	pm.fileHandle.SetOffset(offset)
-
-	if _, err := pm.fileHandle.Write(data); err != nil {
-		return nil, fmt.Errorf("写入页面失败: %v", err)
+	// 延迟写回时新页面由缓冲池在日志之后写入
+	if !pm.deferWrites {
+		if err := pm.UpdatePage(page); err != nil {
+			return nil, err
+		}
 	}
 
 	// 更新元数据
@@ -91,35 +173,13 @@ func (pm *PageManager) CreatePage(pageType uint32) (*Page.Page, error) {
 	if err := pm.WriteMetaPage(); err != nil {
 		return nil, err
 	}
+	if err := pm.writeFileHeader(); err != nil {
+		return nil, err
+	}
 
 	return page, nil
 }
 
-// 分裂叶子节点
-func (pm *PageManager) splitLeafPage(page *Page.Page) (*Page.Page, *Page.Page, *Record.InternalRecord) {
-	newPage, err := pm.CreatePage(Page.LeafPageID)
-	if err != nil {
-		return nil, nil, nil
-	}
-	key, value, recordKey := page.SplitKeyAndValue()
-	newPage.WriteKey(0, key)
-	newPage.WriteValue(0, value)
-	page.Header.NextPageID = newPage.Header.PageID
-	newPage.Header.PrevPageID = page.Header.PageID
-	pm.UpdatePage(page)
-	pm.UpdatePage(newPage)
-
-	internalRecord := Record.NewInternalRecord(Record.RecordHeader{
-		IsDeleted:     0,
-		RecordLength:  page.Header.RecordSize,
-		TransactionID: 0,
-		Timestamp:     uint32(time.Now().Unix()),
-		KeySize:       Record.KeySize,
-		ValueSize:     Record.ValueSize,
-	}, recordKey, page.Header.PageID, newPage.Header.PageID)
-	return page, newPage, internalRecord
-}
-
 /*
 func (pm *PageManager) WritePage(page *Page.Page,pageID uint32) error {
 	// 1. 先将文件指针设置到该修改的地方
@@ -147,11 +207,8 @@ func (pm *PageManager) UpdatePage(page *Page.Page) error {
 	// 计算偏移量
 	offset := int64(FileHeaderSize) + int64(page.Header.PageID)*int64(PageSize)
 
-	// 设置文件指针
-	pm.fileHandle.SetOffset(offset)
-
 	// 写入数据
-	n, err := pm.fileHandle.Write(data)
+	n, err := pm.fileHandle.WriteAt(offset, data)
 	if err != nil {
 		return fmt.Errorf("写入页面失败: %v", err)
 	}
@@ -189,8 +246,7 @@ func (pm *PageManager) InitRootPage() error {
 		return fmt.Errorf("序列化页面失败: %v", err)
 	}
 	offset := int64(FileHeaderSize)
-	pm.fileHandle.SetOffset(offset)
-	_, err = pm.fileHandle.Write(data)
+	_, err = pm.fileHandle.WriteAt(offset, data)
 	if err != nil {
 		return fmt.Errorf("写入页面失败: %v", err)
 	}
@@ -200,8 +256,7 @@ func (pm *PageManager) InitRootPage() error {
 func (pm *PageManager) GetROOTPage() (*Page.Page, error) {
 	metaPage := Page.NewPageBPlusTree()
 	offset := int64(FileHeaderSize)
-	pm.fileHandle.SetOffset(offset)
-	data, err := pm.fileHandle.Read(PageSize)
+	data, err := pm.fileHandle.ReadAt(offset, PageSize)
 	if err != nil {
 		return nil, err
 	}
@@ -218,25 +273,190 @@ func (pm *PageManager) GetROOTPage() (*Page.Page, error) {
 }
 
 func (pm *PageManager) WriteMetaPage() error {
+	if pm.deferWrites {
+		pm.metaDirty = true
+		pm.unloggedMeta = true
+		return nil
+	}
+	return pm.writeMetaPage()
+}
+
+func (pm *PageManager) writeMetaPage() error {
 	data, err := pm.metaPage.SerializeTo()
 	if err != nil {
 		return fmt.Errorf("序列化元数据页失败: %v", err)
 	}
 	offset := int64(FileHeaderSize)
-	pm.fileHandle.SetOffset(offset)
-	_, err = pm.fileHandle.Write(data)
+	_, err = pm.fileHandle.WriteAt(offset, data)
 	if err != nil {
 		return fmt.Errorf("写入元数据页失败: %v", err)
 	}
 	return nil
 }
 
-// 释放页面
+// 释放页面，把页面挂到空闲页链表的头部，空闲页通过NextPageID串联
 func (pm *PageManager) DisposePage(page *Page.Page) error {
-	// 这里可以实现页面回收的逻辑
-	// 简单实现：将页面标记为已删除
+	if page.Header.PageID == Page.MetaPageID {
+		return fmt.Errorf("不能释放元数据页")
+	}
+	if page.Header.IsDeleted == 1 {
+		return fmt.Errorf("页面 %d 已被释放", page.Header.PageID)
+	}
+	meta, err := pm.GetMetaPage()
+	if err != nil {
+		return err
+	}
+
+	page.ClearRecords()
 	page.Header.IsDeleted = 1
-	return pm.UpdatePage(page)
+	page.Header.PrevPageID = 0
+	page.Header.NextPageID = pm.fileHeader.FirstFreePage
+	page.Header.ModifyTime = uint32(time.Now().Unix())
+	if pm.deferWrites {
+		pm.freedPages[page.Header.PageID] = page
+		pm.unloggedFreed = append(pm.unloggedFreed, page.Header.PageID)
+	} else if err := pm.UpdatePage(page); err != nil {
+		return err
+	}
+
+	pm.fileHeader.FirstFreePage = page.Header.PageID
+	meta.PageCount--
+	if err := pm.WriteMetaPage(); err != nil {
+		return err
+	}
+	return pm.writeFileHeader()
+}
+
+// 获取空闲页链表中的所有页面ID
+func (pm *PageManager) GetFreePageIDs() ([]uint32, error) {
+	var pageIDs []uint32
+	for pageID := pm.fileHeader.FirstFreePage; pageID != 0; {
+		page, ok := pm.freedPages[pageID]
+		if !ok {
+			var err error
+			if page, err = pm.GetPage(pageID); err != nil {
+				return nil, err
+			}
+		}
+		pageIDs = append(pageIDs, pageID)
+		pageID = page.Header.NextPageID
+	}
+	return pageIDs, nil
+}
+
+// 获取文件头
+func (pm *PageManager) GetFileHeader() *File.FileHeader {
+	return pm.fileHeader
+}
+
+// 写回文件头，页数与元数据页保持一致
+func (pm *PageManager) writeFileHeader() error {
+	pm.fileHeader.PageCount = pm.metaPage.PageCount
+	pm.fileHeader.LastPageID = pm.metaPage.LastPageID
+	pm.fileHeader.UpdateTime = time.Now().Unix()
+	if pm.deferWrites {
+		pm.headerDirty = true
+		pm.unloggedHeader = true
+		return nil
+	}
+	if err := pm.fileHeader.WriteToFile(pm.fileHandle); err != nil {
+		return fmt.Errorf("写入文件头失败: %v", err)
+	}
+	return nil
+}
+
+// 开启或关闭延迟写回
+func (pm *PageManager) SetDeferWrites(deferWrites bool) {
+	pm.deferWrites = deferWrites
+}
+
+// 写回延迟的元数据页、文件头和释放的页面，调用前相关日志必须已经写入磁盘
+func (pm *PageManager) Flush() error {
+	for pageID, page := range pm.freedPages {
+		if err := pm.UpdatePage(page); err != nil {
+			return err
+		}
+		delete(pm.freedPages, pageID)
+	}
+	if pm.metaDirty {
+		if err := pm.writeMetaPage(); err != nil {
+			return err
+		}
+		pm.metaDirty = false
+	}
+	if pm.headerDirty {
+		if err := pm.fileHeader.WriteToFile(pm.fileHandle); err != nil {
+			return fmt.Errorf("写入文件头失败: %v", err)
+		}
+		pm.headerDirty = false
+	}
+	pm.recLSN = 0
+	return nil
+}
+
+// 把延迟写回的内容加入脏页表
+func (pm *PageManager) addDirtyPages(dirtyPages map[uint32]uint64) {
+	if pm.recLSN == 0 {
+		return
+	}
+	if pm.metaDirty {
+		dirtyPages[Page.MetaPageID] = pm.recLSN
+	}
+	if pm.headerDirty {
+		dirtyPages[Transaction.FileHeaderPageID] = pm.recLSN
+	}
+	for pageID := range pm.freedPages {
+		dirtyPages[pageID] = pm.recLSN
+	}
+}
+
+// 把还没写入日志的元数据页、文件头和释放的页面镜像加入日志记录
+func (pm *PageManager) addUnloggedImages(record *Transaction.LogRecord) error {
+	if pm.unloggedMeta {
+		data, err := pm.metaPage.SerializeTo()
+		if err != nil {
+			return err
+		}
+		record.AddPage(Page.MetaPageID, data)
+	}
+	if pm.unloggedHeader {
+		data, err := pm.fileHeader.SerializeTo()
+		if err != nil {
+			return err
+		}
+		record.AddPage(Transaction.FileHeaderPageID, data)
+	}
+	for _, pageID := range pm.unloggedFreed {
+		page, ok := pm.freedPages[pageID]
+		if !ok {
+			// 释放后又被重新使用，由缓冲池记录
+			continue
+		}
+		data, err := page.SerializeTo()
+		if err != nil {
+			return err
+		}
+		record.AddPage(pageID, data)
+	}
+	return nil
+}
+
+// 镜像已经写入日志，记下日志的LSN
+func (pm *PageManager) markLogged(lsn uint64) {
+	if pm.recLSN == 0 && (pm.unloggedMeta || pm.unloggedHeader || len(pm.unloggedFreed) > 0) {
+		pm.recLSN = lsn
+	}
+	if pm.unloggedMeta {
+		pm.metaPage.Header.LSN = lsn
+	}
+	for _, pageID := range pm.unloggedFreed {
+		if page, ok := pm.freedPages[pageID]; ok {
+			page.Header.LSN = lsn
+		}
+	}
+	pm.unloggedMeta = false
+	pm.unloggedHeader = false
+	pm.unloggedFreed = pm.unloggedFreed[:0]
 }
 
 // 初始化元数据页面
@@ -259,8 +479,7 @@ func (pm *PageManager) InitMetaPage() error {
 	}
 
 	offset := int64(FileHeaderSize)
-	pm.fileHandle.SetOffset(offset)
-	_, err = pm.fileHandle.Write(data)
+	_, err = pm.fileHandle.WriteAt(offset, data)
 	return err
 }
 
@@ -272,12 +491,13 @@ func (pm *PageManager) GetMetaPage() (*Page.PageBPlusTree, error) {
 
 	metaPage := Page.NewPageBPlusTree()
 	offset := int64(FileHeaderSize)
-	pm.fileHandle.SetOffset(offset)
-
-	data, err := pm.fileHandle.Read(PageSize)
+	data, err := pm.fileHandle.ReadAt(offset, PageSize)
 	if err != nil {
 		return nil, err
 	}
+	if err := verifyPage(Page.MetaPageID, data); err != nil {
+		return nil, err
+	}
 
 	if err := metaPage.DeserializeFrom(data); err != nil {
 		return nil, fmt.Errorf("解析MetaPage失败: %v", err)
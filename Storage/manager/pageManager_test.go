@@ -1,8 +1,12 @@
 package manager
 
 import (
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
 	"wudb/Entity/Page"
+	"wudb/Transaction"
 )
 
 // 测试环境设置
@@ -122,7 +126,7 @@ func TestPageManager_GetPage(t *testing.T) {
 
 	// 写入一些测试数据
 	testKey := []byte("testkey")
-	if err := originalPage.WriteKey(0, testKey); err != nil {
+	if err := originalPage.WriteData(0, testKey); err != nil {
 		t.Fatalf("写入Key失败: %v", err)
 	}
 
@@ -138,7 +142,7 @@ func TestPageManager_GetPage(t *testing.T) {
 	}
 
 	// 验证页面内容
-	readKey, err := fetchedPage.ReadKey(0, uint32(len(testKey)))
+	readKey, err := fetchedPage.ReadData(0, uint32(len(testKey)))
 	if err != nil {
 		t.Fatalf("读取Key失败: %v", err)
 	}
@@ -147,6 +151,49 @@ func TestPageManager_GetPage(t *testing.T) {
 	}
 }
 
+// 测试多个读操作并发读取不同的页面，按位置读写不使用共享的偏移量，互不干扰
+func TestPageManager_ConcurrentGetPage(t *testing.T) {
+	pm, _, cleanup := setupPageManagerTest(t)
+	defer cleanup()
+
+	var pageIDs []uint32
+	for i := 0; i < 16; i++ {
+		page, err := pm.CreatePage(Page.LeafPageID)
+		if err != nil {
+			t.Fatalf("创建页面失败: %v", err)
+		}
+		if err := page.WriteData(0, []byte(fmt.Sprintf("page-%02d", i))); err != nil {
+			t.Fatalf("写入数据失败: %v", err)
+		}
+		if err := pm.UpdatePage(page); err != nil {
+			t.Fatalf("更新页面失败: %v", err)
+		}
+		pageIDs = append(pageIDs, page.Header.PageID)
+	}
+
+	var wg sync.WaitGroup
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				i := (r + n) % len(pageIDs)
+				page, err := pm.GetPage(pageIDs[i])
+				if err != nil {
+					t.Errorf("读取页面失败: %v", err)
+					return
+				}
+				data, _ := page.ReadData(0, 7)
+				if page.Header.PageID != pageIDs[i] || string(data) != fmt.Sprintf("page-%02d", i) {
+					t.Errorf("读到的页面不正确: 期望页面 %d, 实际 %d", pageIDs[i], page.Header.PageID)
+					return
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+}
+
 // 测试创建根页面
 func TestPageManager_CreateRootPage(t *testing.T) {
 	pm, _, cleanup := setupPageManagerTest(t)
@@ -194,7 +241,7 @@ func TestPageManager_UpdatePage(t *testing.T) {
 
 	// 修改页面内容
 	testData := []byte("test data")
-	if err := page.WriteKey(0, testData); err != nil {
+	if err := page.WriteData(0, testData); err != nil {
 		t.Fatalf("写入数据失败: %v", err)
 	}
 
@@ -210,7 +257,7 @@ func TestPageManager_UpdatePage(t *testing.T) {
 	}
 
 	// 验证更新内容
-	readData, err := updatedPage.ReadKey(0, uint32(len(testData)))
+	readData, err := updatedPage.ReadData(0, uint32(len(testData)))
 	if err != nil {
 		t.Fatalf("读取数据失败: %v", err)
 	}
@@ -218,3 +265,164 @@ func TestPageManager_UpdatePage(t *testing.T) {
 		t.Error("页面更新内容不匹配")
 	}
 }
+
+// 测试释放的页面进入空闲页链表并被CreatePage复用
+func TestPageManager_DisposeAndReuse(t *testing.T) {
+	pm, _, cleanup := setupPageManagerTest(t)
+	defer cleanup()
+
+	pages := make([]*Page.Page, 3)
+	for i := range pages {
+		page, err := pm.CreatePage(Page.LeafPageID)
+		if err != nil {
+			t.Fatalf("创建页面失败: %v", err)
+		}
+		pages[i] = page
+	}
+	lastPageID := pm.metaPage.LastPageID
+
+	// 释放两个页面，后释放的在链表头部
+	for _, page := range pages[:2] {
+		if err := pm.DisposePage(page); err != nil {
+			t.Fatalf("释放页面失败: %v", err)
+		}
+	}
+	if err := pm.DisposePage(pages[0]); err == nil {
+		t.Error("重复释放页面应该返回错误")
+	}
+	freePages, err := pm.GetFreePageIDs()
+	if err != nil {
+		t.Fatalf("读取空闲页链表失败: %v", err)
+	}
+	if len(freePages) != 2 || freePages[0] != pages[1].Header.PageID || freePages[1] != pages[0].Header.PageID {
+		t.Errorf("空闲页链表不正确: %v", freePages)
+	}
+
+	for _, expected := range freePages {
+		page, err := pm.CreatePage(Page.InternalPageID)
+		if err != nil {
+			t.Fatalf("创建页面失败: %v", err)
+		}
+		if page.Header.PageID != expected {
+			t.Errorf("应该复用空闲页: 期望 %d, 实际 %d", expected, page.Header.PageID)
+		}
+		if page.Header.IsDeleted != 0 {
+			t.Error("复用的页面不应带有删除标记")
+		}
+	}
+	if pm.metaPage.LastPageID != lastPageID {
+		t.Errorf("复用空闲页时文件不应增长: 期望 %d, 实际 %d", lastPageID, pm.metaPage.LastPageID)
+	}
+
+	// 空闲页用完后才扩展文件
+	page, err := pm.CreatePage(Page.LeafPageID)
+	if err != nil {
+		t.Fatalf("创建页面失败: %v", err)
+	}
+	if page.Header.PageID != lastPageID+1 {
+		t.Errorf("页面ID不正确: 期望 %d, 实际 %d", lastPageID+1, page.Header.PageID)
+	}
+}
+
+// 测试空闲页链表在关闭并重新打开文件后保持一致
+func TestPageManager_FreeListReopen(t *testing.T) {
+	pm, fm, cleanup := setupPageManagerTest(t)
+	defer cleanup()
+
+	var pageIDs []uint32
+	for i := 0; i < 4; i++ {
+		page, err := pm.CreatePage(Page.LeafPageID)
+		if err != nil {
+			t.Fatalf("创建页面失败: %v", err)
+		}
+		pageIDs = append(pageIDs, page.Header.PageID)
+	}
+	for _, pageID := range []uint32{pageIDs[0], pageIDs[2]} {
+		page, err := pm.GetPage(pageID)
+		if err != nil {
+			t.Fatalf("读取页面失败: %v", err)
+		}
+		if err := pm.DisposePage(page); err != nil {
+			t.Fatalf("释放页面失败: %v", err)
+		}
+	}
+	before, err := pm.GetFreePageIDs()
+	if err != nil {
+		t.Fatalf("读取空闲页链表失败: %v", err)
+	}
+	pm.fileHandle.Close()
+
+	handle, err := fm.OpenFile("test_page_manager")
+	if err != nil {
+		t.Fatalf("重新打开文件失败: %v", err)
+	}
+	defer handle.Close()
+	reopened := NewPageManager(handle)
+	after, err := reopened.GetFreePageIDs()
+	if err != nil {
+		t.Fatalf("读取空闲页链表失败: %v", err)
+	}
+	if len(before) != 2 || len(after) != len(before) {
+		t.Fatalf("空闲页数量不一致: 期望 %d, 实际 %d", len(before), len(after))
+	}
+	for i := range before {
+		if before[i] != after[i] {
+			t.Errorf("空闲页链表不一致: 期望 %v, 实际 %v", before, after)
+			break
+		}
+	}
+	if reopened.GetFileHeader().FirstFreePage != pageIDs[2] {
+		t.Errorf("文件头中的空闲页链表头不正确: 期望 %d, 实际 %d", pageIDs[2], reopened.GetFileHeader().FirstFreePage)
+	}
+
+	page, err := reopened.CreatePage(Page.LeafPageID)
+	if err != nil {
+		t.Fatalf("创建页面失败: %v", err)
+	}
+	if page.Header.PageID != pageIDs[2] {
+		t.Errorf("重新打开后应该复用空闲页: 期望 %d, 实际 %d", pageIDs[2], page.Header.PageID)
+	}
+}
+
+// 测试读取页面时检查校验和，损坏的页面返回带页ID的错误
+func TestPageManager_Checksum(t *testing.T) {
+	pm, fm, cleanup := setupPageManagerTest(t)
+	defer cleanup()
+
+	page, err := pm.CreatePage(Page.LeafPageID)
+	if err != nil {
+		t.Fatalf("创建页面失败: %v", err)
+	}
+	if _, err := pm.GetPage(page.Header.PageID); err != nil {
+		t.Fatalf("读取页面失败: %v", err)
+	}
+
+	// 模拟页面写了一半
+	offset := int64(FileHeaderSize) + int64(page.Header.PageID)*int64(PageSize) + 1000
+	if _, err := pm.fileHandle.GetFile().WriteAt([]byte("torn"), offset); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	_, err = pm.GetPage(page.Header.PageID)
+	var corruption *CorruptionError
+	if !errors.As(err, &corruption) || corruption.PageID != page.Header.PageID {
+		t.Fatalf("应该返回页面 %d 的损坏错误: %v", page.Header.PageID, err)
+	}
+
+	// 文件头损坏时打开失败，而不是重新初始化
+	if _, err := pm.fileHandle.GetFile().WriteAt([]byte{0xFF}, 30); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	pm.fileHandle.Close()
+	handle, err := fm.OpenFile("test_page_manager")
+	if err != nil {
+		t.Fatalf("重新打开文件失败: %v", err)
+	}
+	defer handle.Close()
+	_, err = OpenPageManager(handle)
+	if !errors.As(err, &corruption) || corruption.PageID != Transaction.FileHeaderPageID {
+		t.Errorf("应该返回文件头的损坏错误: %v", err)
+	}
+	if _, err := fm.GetFileHeader(handle); !errors.As(err, &corruption) {
+		t.Errorf("读取文件头也应该检查校验和: %v", err)
+	}
+}
@@ -2,8 +2,12 @@ package manager
 
 import (
 	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
 	"testing"
 	"time"
+	"wudb/Entity/Page"
 	"wudb/Entity/Record"
 	"wudb/Transaction"
 )
@@ -26,7 +30,10 @@ func setupRecordManagerTest(t *testing.T) (*RecordManager, *FileManager, func())
 	}
 
 	// 创建记录管理器
-	rm := NewRecordManager(handle)
+	rm, err := NewRecordManager(handle)
+	if err != nil {
+		t.Fatalf("创建记录管理器失败: %v", err)
+	}
 
 	// 返回清理函数
 	cleanup := func() {
@@ -37,28 +44,21 @@ func setupRecordManagerTest(t *testing.T) (*RecordManager, *FileManager, func())
 	return rm, fm, cleanup
 }
 
+// 创建测试键，4字节大端序
+func createTestKey(key uint32) []byte {
+	return []byte{byte(key >> 24), byte(key >> 16), byte(key >> 8), byte(key)}
+}
+
 // 创建测试记录
 func createTestRecord(key uint32, value string) *Record.Record {
-	var keyBytes [32]byte
-	keyBytes[0] = byte(key >> 24)
-	keyBytes[1] = byte(key >> 16)
-	keyBytes[2] = byte(key >> 8)
-	keyBytes[3] = byte(key)
-
-	var valueBytes [128]byte
-	copy(valueBytes[:], value)
-
 	return Record.NewRecord(
 		Record.RecordHeader{
 			IsDeleted:     0,
-			RecordLength:  uint32(32 + len(value)),
-			KeySize:       32,
-			ValueSize:     uint32(len(value)),
 			TransactionID: 0,
 			Timestamp:     uint32(time.Now().Unix()),
 		},
-		keyBytes,
-		valueBytes,
+		createTestKey(key),
+		[]byte(value),
 	)
 }
 
@@ -91,7 +91,7 @@ func TestRecordManager_InsertSingleRecord(t *testing.T) {
 	}
 
 	// 验证记录是否存在
-	found, err := rm.FindRecord(record.GetKey())
+	found, err := rm.findRecord(record.GetKey())
 	if err != nil {
 		t.Fatalf("查找记录失败: %v", err)
 	}
@@ -129,13 +129,9 @@ func TestRecordManager_InsertMultipleRecords(t *testing.T) {
 
 	// 验证所有记录
 	for i := 0; i < recordCount; i++ {
-		var key [32]byte
-		key[0] = byte(i >> 24)
-		key[1] = byte(i >> 16)
-		key[2] = byte(i >> 8)
-		key[3] = byte(i)
+		key := createTestKey(uint32(i))
 
-		found, err := rm.FindRecord(key)
+		found, err := rm.findRecord(key)
 		if err != nil {
 			t.Errorf("查找第 %d 条记录失败: %v", i, err)
 			continue
@@ -177,19 +173,152 @@ func TestRecordManager_PageSplit(t *testing.T) {
 
 	// 验证所有记录是否都能找到
 	for i := 0; i < recordCount; i++ {
-		var key [32]byte
-		key[0] = byte(i >> 24)
-		key[1] = byte(i >> 16)
-		key[2] = byte(i >> 8)
-		key[3] = byte(i)
+		key := createTestKey(uint32(i))
 
-		if _, err := rm.FindRecord(key); err != nil {
+		if _, err := rm.findRecord(key); err != nil {
 			t.Errorf("查找第 %d 条记录失败: %v", i, err)
 		}
 	}
 	rm.TreeReverse()
 }
 
+// 测试页面按字节容纳记录，小记录不受固定条数限制
+func TestRecordManager_PageCapacityByBytes(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	recordCount := 1000
+	for i := 0; i < recordCount; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "v"), tx); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+
+	// 每条记录约41字节，分裂后的页面至少半满
+	recordSize := Record.RecordHeaderSize + 4 + 1 + Page.SlotEntrySize
+	maxPages := 2*recordCount*recordSize/Page.DataAreaSize + 2
+	if pageCount := int(rm.pageManager.metaPage.PageCount); pageCount > maxPages {
+		t.Errorf("页面数过多: 最多 %d, 实际 %d", maxPages, pageCount)
+	}
+	for i := 0; i < recordCount; i++ {
+		if _, err := rm.findRecord(createTestKey(uint32(i))); err != nil {
+			t.Errorf("查找第 %d 条记录失败: %v", i, err)
+		}
+	}
+}
+
+// 按层读出每个页面已用的字节数，第一层是根节点
+func pageUsageByLevel(t *testing.T, rm *RecordManager) [][]uint32 {
+	t.Helper()
+	var levels [][]uint32
+	pageIDs := []uint32{rm.pageManager.metaPage.RootPageID}
+	for len(pageIDs) > 0 {
+		var usage []uint32
+		var children []uint32
+		for _, pageID := range pageIDs {
+			page, err := rm.bufferPool.FetchPageRead(pageID)
+			if err != nil {
+				t.Fatalf("读取页面 %d 失败: %v", pageID, err)
+			}
+			usage = append(usage, page.UsedSpace())
+			if page.Header.PageType == Page.InternalPageID {
+				for i := 0; i <= int(page.Header.RecordCount); i++ {
+					children = append(children, page.GetChildPageID(i))
+				}
+			}
+			rm.bufferPool.UnpinPageRead(pageID)
+		}
+		levels = append(levels, usage)
+		pageIDs = children
+	}
+	return levels
+}
+
+// 测试顺序插入时在右边缘分裂，除了每层最后一个页面都按填充因子填满；随机插入仍然平分
+func TestRecordManager_SequentialInsertFillFactor(t *testing.T) {
+	for _, fillFactor := range []float64{DefaultFillFactor, 1} {
+		rm, _, cleanup := setupRecordManagerTest(t)
+		if err := rm.SetFillFactor(fillFactor); err != nil {
+			t.Fatalf("设置填充因子失败: %v", err)
+		}
+		tx := createTestTransaction(t, rm)
+		for i := 0; i < 12000; i++ {
+			if err := rm.InsertRecord(createTestRecord(uint32(i), "v"), tx); err != nil {
+				t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+			}
+		}
+
+		levels := pageUsageByLevel(t, rm)
+		if len(levels) < 3 {
+			t.Fatalf("树高度应该至少为3, 实际 %d", len(levels))
+		}
+		limit := uint32(fillFactor * Page.DataAreaSize)
+		for depth, usage := range levels[1:] {
+			for i, used := range usage[:len(usage)-1] {
+				// 每个页面比目标最多少放一条记录
+				if used > limit || used+100 < limit {
+					t.Fatalf("填充因子 %v: 第 %d 层第 %d 个页面使用了 %d 字节, 目标 %d", fillFactor, depth+2, i, used, limit)
+				}
+			}
+		}
+		checkRecords(t, rm, 0, 12000, "v", 12000)
+		cleanup()
+	}
+
+	// 随机顺序插入时按字节数平分，每个页面至少半满
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+	tx := createTestTransaction(t, rm)
+	for _, i := range rand.New(rand.NewSource(1)).Perm(5000) {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "v"), tx); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	levels := pageUsageByLevel(t, rm)
+	for _, used := range levels[len(levels)-1] {
+		if used < Page.DataAreaSize/2-100 {
+			t.Fatalf("随机插入后叶子太空: %d 字节", used)
+		}
+	}
+}
+
+// 测试填充因子保存在元数据页中，批量加载默认使用它
+func TestRecordManager_FillFactorPersisted(t *testing.T) {
+	rm, fm, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	if fillFactor, err := rm.GetFillFactor(); err != nil || fillFactor != DefaultFillFactor {
+		t.Errorf("默认填充因子不正确: %v, %v", fillFactor, err)
+	}
+	if err := rm.SetFillFactor(0.2); err == nil {
+		t.Error("填充因子太小应该报错")
+	}
+	fillFactor := 0.7
+	if err := rm.SetFillFactor(fillFactor); err != nil {
+		t.Fatalf("设置填充因子失败: %v", err)
+	}
+	if err := rm.BulkLoad(NewSliceSource(sortedTestRecords(3000)), 0); err != nil {
+		t.Fatalf("批量加载失败: %v", err)
+	}
+	levels := pageUsageByLevel(t, rm)
+	leaves := levels[len(levels)-1]
+	limit := uint32(fillFactor * Page.DataAreaSize)
+	for i, used := range leaves[:len(leaves)-2] {
+		if used > limit || used+100 < limit {
+			t.Fatalf("第 %d 个叶子使用了 %d 字节, 目标 %d", i, used, limit)
+		}
+	}
+
+	reopened := crashAndReopen(t, rm, fm, nil)
+	if got, err := reopened.GetFillFactor(); err != nil || got != fillFactor {
+		t.Errorf("重新打开后填充因子不正确: %v, %v", got, err)
+	}
+	if _, err := NewRecordManagerWithConfig(reopened.fileHandle, &Config{FillFactor: 1.5}); err == nil {
+		t.Error("配置中的填充因子无效时应该报错")
+	}
+}
+
 // 测试删除记录
 func TestRecordManager_DeleteRecord(t *testing.T) {
 	rm, _, cleanup := setupRecordManagerTest(t)
@@ -218,16 +347,16 @@ func TestRecordManager_DeleteRecord(t *testing.T) {
 	}
 	rm.TreeReverse()
 	// 验证删除的记录不存在
-	for i := 0; i < 1; i++ {
-		_, err := rm.FindRecord(records[i].GetKey())
+	for i := 0; i < 40; i++ {
+		_, err := rm.findRecord(records[i].GetKey())
 		if err == nil {
 			t.Errorf("记录 %d 应该已被删除", i)
 		}
 	}
 
 	// 验证未删除的记录仍然存在
-	for i := 10; i < 20; i++ {
-		found, err := rm.FindRecord(records[i].GetKey())
+	for i := 40; i < 200; i++ {
+		found, err := rm.findRecord(records[i].GetKey())
 		if err != nil {
 			t.Errorf("查找记录 %d 失败: %v", i, err)
 		}
@@ -237,6 +366,53 @@ func TestRecordManager_DeleteRecord(t *testing.T) {
 	}
 }
 
+// 测试删除后释放的页面被重新插入时复用，文件不再增长
+func TestRecordManager_DeleteReusePages(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	recordCount := 200
+	for i := 0; i < recordCount; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), tx); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	highWater := rm.pageManager.metaPage.LastPageID
+
+	// 删除全部记录，合并后的页面进入空闲页链表
+	for i := 0; i < recordCount; i++ {
+		if err := rm.DeleteRecord(createTestRecord(uint32(i), "").GetKey(), tx); err != nil {
+			t.Fatalf("删除第 %d 条记录失败: %v", i, err)
+		}
+	}
+	if rm.pageManager.metaPage.TreeHeight != 1 {
+		t.Errorf("删除全部记录后树高度应为1, 实际 %d", rm.pageManager.metaPage.TreeHeight)
+	}
+	freePages, err := rm.pageManager.GetFreePageIDs()
+	if err != nil {
+		t.Fatalf("读取空闲页链表失败: %v", err)
+	}
+	if len(freePages) == 0 {
+		t.Fatal("删除后应该有空闲页")
+	}
+
+	// 重新插入，页面全部来自空闲页链表
+	for i := 0; i < recordCount; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), tx); err != nil {
+			t.Fatalf("重新插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	if rm.pageManager.metaPage.LastPageID != highWater {
+		t.Errorf("文件不应增长: 期望最大页号 %d, 实际 %d", highWater, rm.pageManager.metaPage.LastPageID)
+	}
+	for i := 0; i < recordCount; i++ {
+		if _, err := rm.findRecord(createTestRecord(uint32(i), "").GetKey()); err != nil {
+			t.Errorf("查找第 %d 条记录失败: %v", i, err)
+		}
+	}
+}
+
 // 测试范围查询
 func TestRecordManager_RangeQuery(t *testing.T) {
 	rm, _, cleanup := setupRecordManagerTest(t)
@@ -257,12 +433,11 @@ func TestRecordManager_RangeQuery(t *testing.T) {
 	}
 
 	// 定义范围
-	var startKey, endKey [32]byte
-	startKey[3] = 20
-	endKey[3] = 50
+	startKey := createTestKey(20)
+	endKey := createTestKey(50)
 
 	// 执行范围查询
-	results, err := rm.RangeQuery(startKey, endKey)
+	results, err := rm.rangeQuery(startKey, endKey)
 	if err != nil {
 		t.Fatalf("范围查询失败: %v", err)
 	}
@@ -275,12 +450,108 @@ func TestRecordManager_RangeQuery(t *testing.T) {
 
 	// 验证结果有序性
 	for i := 1; i < len(results); i++ {
-		if bytes.Compare(results[i-1].Key[:], results[i].Key[:]) >= 0 {
+		if bytes.Compare(results[i-1].Key, results[i].Key) >= 0 {
 			t.Error("范围查询结果未正确排序")
 		}
 	}
 }
 
+// 测试变长的键和值
+func TestRecordManager_VariableLengthRecords(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+
+	// 键是长短不一的字符串，值从几个字节到几百字节
+	values := make(map[string][]byte)
+	var keys []string
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("user:%d", (i*7919)%300)
+		if i%3 == 0 {
+			key += ":profile"
+		}
+		value := bytes.Repeat([]byte{byte('a' + i%26)}, 1+(i*37)%700)
+		values[key] = value
+		keys = append(keys, key)
+		if err := rm.InsertRecord(Record.NewRecordByTransaction(uint32(tx.TransactionID), []byte(key), value), tx); err != nil {
+			t.Fatalf("插入记录 %q 失败: %v", key, err)
+		}
+	}
+	// 只相差末尾零字节的键是不同的键
+	for _, key := range []string{"k", "k\x00", "k\x00\x00"} {
+		values[key] = []byte(key)
+		keys = append(keys, key)
+		if err := rm.InsertRecord(Record.NewRecordByTransaction(uint32(tx.TransactionID), []byte(key), []byte(key)), tx); err != nil {
+			t.Fatalf("插入记录 %q 失败: %v", key, err)
+		}
+	}
+
+	for key, value := range values {
+		found, err := rm.findRecord([]byte(key))
+		if err != nil {
+			t.Fatalf("查找记录 %q 失败: %v", key, err)
+		}
+		if !bytes.Equal(found.Value, value) {
+			t.Errorf("记录 %q 的值不匹配: 期望长度 %d, 实际长度 %d", key, len(value), len(found.Value))
+		}
+	}
+
+	// 范围查询按实际键长比较
+	sort.Strings(keys)
+	results, err := rm.rangeQuery([]byte("k"), []byte("user:2"))
+	if err != nil {
+		t.Fatalf("范围查询失败: %v", err)
+	}
+	var expected []string
+	for _, key := range keys {
+		if key >= "k" && key <= "user:2" {
+			expected = append(expected, key)
+		}
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("范围查询结果数量不正确: 期望 %d, 实际 %d", len(expected), len(results))
+	}
+	for i, record := range results {
+		if string(record.Key) != expected[i] {
+			t.Errorf("第 %d 条结果不正确: 期望 %q, 实际 %q", i, expected[i], record.Key)
+		}
+	}
+
+	// 删除一半后剩余记录仍然可以找到
+	for i, key := range keys {
+		if i%2 == 0 {
+			if err := rm.DeleteRecord([]byte(key), tx); err != nil {
+				t.Fatalf("删除记录 %q 失败: %v", key, err)
+			}
+		}
+	}
+	for i, key := range keys {
+		_, err := rm.findRecord([]byte(key))
+		if i%2 == 0 && err == nil {
+			t.Errorf("记录 %q 应该已被删除", key)
+		}
+		if i%2 == 1 && err != nil {
+			t.Errorf("查找记录 %q 失败: %v", key, err)
+		}
+	}
+
+	// 超出长度限制的键
+	longKey := bytes.Repeat([]byte("k"), Page.KeyMaxSize+1)
+	if err := rm.InsertRecord(Record.NewRecordByTransaction(uint32(tx.TransactionID), longKey, nil), tx); err != ErrKeyTooLarge {
+		t.Errorf("期望 ErrKeyTooLarge, 实际 %v", err)
+	}
+	// 超过一个页面的值写入溢出页
+	largeValue := bytes.Repeat([]byte("v"), Page.MaxRecordSize)
+	if err := rm.InsertRecord(Record.NewRecordByTransaction(uint32(tx.TransactionID), []byte("large"), largeValue), tx); err != nil {
+		t.Fatalf("插入大记录失败: %v", err)
+	}
+	found, err := rm.findRecord([]byte("large"))
+	if err != nil || !bytes.Equal(found.Value, largeValue) {
+		t.Errorf("大记录的值不正确: %v", err)
+	}
+}
+
 // 测试事务回滚
 func TestRecordManager_TransactionRollback(t *testing.T) {
 	rm, _, cleanup := setupRecordManagerTest(t)
@@ -306,19 +577,136 @@ func TestRecordManager_TransactionRollback(t *testing.T) {
 	rm.TreeReverse()
 	// 验证记录是否被回滚
 	for i := 0; i < 5; i++ {
-		var key [32]byte
-		key[0] = byte(i >> 24)
-		key[1] = byte(i >> 16)
-		key[2] = byte(i >> 8)
-		key[3] = byte(i)
+		key := createTestKey(uint32(i))
 
-		_, err := rm.FindRecord(key)
+		_, err := rm.findRecord(key)
 		if err == nil {
 			t.Errorf("记录 %d 应该已被回滚", i)
 		}
 	}
 }
 
+// 测试长事务回滚：撤销用到的修改前镜像从日志中读取，包括已经写入磁盘的日志
+func TestRecordManager_RollbackFromLog(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	setup := createTestTransaction(t, rm)
+	for i := 0; i < 100; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "old"), setup); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+	largeValue := bytes.Repeat([]byte("v"), Page.MaxRecordSize)
+	if err := rm.InsertRecord(Record.NewRecordByTransaction(0, []byte("large"), largeValue), setup); err != nil {
+		t.Fatalf("插入大记录失败: %v", err)
+	}
+	if err := rm.Commit(setup); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+
+	tx, err := rm.Begin(Transaction.ReadCommitted)
+	if err != nil {
+		t.Fatalf("开始事务失败: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		if err := rm.UpdateRecord(createTestRecord(uint32(i), "new"), tx); err != nil {
+			t.Fatalf("更新记录失败: %v", err)
+		}
+	}
+	for i := 50; i < 100; i++ {
+		if err := rm.DeleteRecord(createTestKey(uint32(i)), tx); err != nil {
+			t.Fatalf("删除记录失败: %v", err)
+		}
+	}
+	if err := rm.DeleteRecord([]byte("large"), tx); err != nil {
+		t.Fatalf("删除大记录失败: %v", err)
+	}
+	// 叶子上的修改只记录键和记录，插入足够多的长记录让日志超过缓冲区
+	for i := 100; i < 1000; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), fmt.Sprintf("%0400d", i)), tx); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+	if flushed := rm.transactionManager.GetLogManager().GetFlushedLSN(); flushed <= tx.BeginLSN {
+		t.Fatalf("长事务的日志应该已经写入磁盘: 落盘到 %d, 事务开始于 %d", flushed, tx.BeginLSN)
+	}
+
+	if err := rm.Rollback(tx); err != nil {
+		t.Fatalf("回滚事务失败: %v", err)
+	}
+	checkRecords(t, rm, 0, 100, "old", 100)
+	found, err := rm.findRecord([]byte("large"))
+	if err != nil || !bytes.Equal(found.Value, largeValue) {
+		t.Errorf("删除的大记录应该恢复: %v", err)
+	}
+	// 已经回滚的事务再次回滚什么也不做
+	if err := rm.Rollback(tx); err != nil {
+		t.Errorf("重复回滚失败: %v", err)
+	}
+}
+
+// 测试回滚到保存点：撤销保存点之后的插入、更新和删除，事务继续活动
+func TestRecordManager_Savepoint(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	for i := 0; i < 10; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "before"), tx); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+	tx.Savepoint("a")
+	for i := 10; i < 200; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "after"), tx); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+	tx.Savepoint("b")
+	if err := rm.UpdateRecord(createTestRecord(3, "updated"), tx); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+	if err := rm.DeleteRecord(createTestKey(5), tx); err != nil {
+		t.Fatalf("删除记录失败: %v", err)
+	}
+
+	if err := rm.RollbackTo(tx, "a"); err != nil {
+		t.Fatalf("回滚到保存点失败: %v", err)
+	}
+	checkRecords(t, rm, 0, 10, "before", 10)
+	// 撤销跳过已经回滚的操作，撤销的是保存点之前的最后一次插入
+	if err := rm.Undo(tx); err != nil {
+		t.Fatalf("撤销操作失败: %v", err)
+	}
+	checkRecords(t, rm, 0, 9, "before", 9)
+	if err := rm.RollbackTo(tx, "b"); err != Transaction.ErrSavepointNotFound {
+		t.Errorf("之后建立的保存点应该被丢弃: %v", err)
+	}
+
+	// 保存点保留，事务可以继续写并再次回滚到它；事务上的RollbackTo同样撤销操作
+	if err := rm.InsertRecord(createTestRecord(20, "again"), tx); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	if err := tx.RollbackTo("a"); err != nil {
+		t.Fatalf("再次回滚到保存点失败: %v", err)
+	}
+	if _, err := rm.findRecord(createTestKey(20)); err != ErrNotFound {
+		t.Errorf("记录 20 应该已被回滚: %v", err)
+	}
+
+	if err := tx.Release("a"); err != nil {
+		t.Fatalf("释放保存点失败: %v", err)
+	}
+	if err := rm.RollbackTo(tx, "a"); err != Transaction.ErrSavepointNotFound {
+		t.Errorf("释放后的保存点不能再回滚: %v", err)
+	}
+	if err := rm.Commit(tx); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	checkRecords(t, rm, 0, 9, "before", 9)
+}
+
 // 测试事务撤销
 func TestRecordManager_TransactionUndo(t *testing.T) {
 	rm, _, cleanup := setupRecordManagerTest(t)
@@ -341,7 +729,7 @@ func TestRecordManager_TransactionUndo(t *testing.T) {
 	}
 
 	// 验证记录是否被撤销
-	_, err := rm.FindRecord(record.GetKey())
+	_, err := rm.findRecord(record.GetKey())
 	if err == nil {
 		t.Error("记录应该已被撤销")
 	}
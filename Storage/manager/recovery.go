@@ -0,0 +1,237 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"wudb/Entity/File"
+	"wudb/Entity/Page"
+	"wudb/Entity/Record"
+	"wudb/Transaction"
+)
+
+// 打开数据库时按ARIES的三个阶段恢复：
+// 分析阶段从最后一个检查点开始，找出没有完成的事务；
+// 重做阶段从检查点脏页表中最早的日志开始重放页面镜像和叶子上的记录修改，页面LSN不小于日志LSN的跳过；
+// 撤销阶段沿着PrevLSN回滚没有完成的事务，每撤销一步写一条补偿日志
+
+// 恢复时的事务表
+type recoveryTransaction struct {
+	lastLSN uint64
+	ended   bool // 已经提交或中止
+}
+
+func (rm *RecordManager) recover() error {
+	logManager := rm.transactionManager.GetLogManager()
+	analysisLSN := logManager.GetBaseLSN()
+	redoLSN := analysisLSN
+	transactions := make(map[int32]*recoveryTransaction)
+	if checkpointLSN := logManager.GetCheckpointLSN(); checkpointLSN != 0 {
+		record, err := logManager.ReadRecord(checkpointLSN)
+		if err != nil {
+			return fmt.Errorf("读取检查点失败: %v", err)
+		}
+		checkpoint, err := record.ParseCheckpoint()
+		if err != nil {
+			return err
+		}
+		for _, transaction := range checkpoint.Transactions {
+			transactions[transaction.TransactionID] = &recoveryTransaction{lastLSN: transaction.LastLSN}
+		}
+		analysisLSN = checkpointLSN
+		redoLSN = checkpoint.RedoLSN(checkpointLSN)
+	}
+
+	if err := rm.analysisPass(analysisLSN, transactions); err != nil {
+		return fmt.Errorf("分析日志失败: %v", err)
+	}
+	if err := rm.redoPass(redoLSN); err != nil {
+		return fmt.Errorf("重做日志失败: %v", err)
+	}
+	if err := rm.restoreNextTransactionID(transactions); err != nil {
+		return err
+	}
+	if err := rm.undoPass(transactions); err != nil {
+		return fmt.Errorf("撤销事务失败: %v", err)
+	}
+	return rm.Flush()
+}
+
+// 分析阶段：在检查点的活动事务表上继续找出每个事务的最后一条日志和是否已经结束
+func (rm *RecordManager) analysisPass(startLSN uint64, transactions map[int32]*recoveryTransaction) error {
+	return rm.transactionManager.GetLogManager().Scan(startLSN, func(record *Transaction.LogRecord) error {
+		if record.Type == Transaction.LogPageImage || record.Type == Transaction.LogCheckpoint {
+			return nil
+		}
+		transaction, ok := transactions[record.TransactionID]
+		if !ok {
+			transaction = &recoveryTransaction{}
+			transactions[record.TransactionID] = transaction
+		}
+		transaction.lastLSN = record.LSN
+		if record.Type == Transaction.LogCommit || record.Type == Transaction.LogAbort {
+			transaction.ended = true
+		}
+		return nil
+	})
+}
+
+// 重做阶段：按日志顺序重放所有页面镜像和叶子上的记录修改，恢复到崩溃前的状态
+func (rm *RecordManager) redoPass(startLSN uint64) error {
+	pm := rm.pageManager
+	err := rm.transactionManager.GetLogManager().Scan(startLSN, func(record *Transaction.LogRecord) error {
+		for _, image := range record.Pages {
+			switch image.PageID {
+			case Transaction.FileHeaderPageID:
+				// 文件头没有LSN，按日志顺序覆盖
+				header := &File.FileHeader{}
+				if err := header.DeserializeFrom(image.Data); err != nil {
+					return err
+				}
+				pm.fileHeader = header
+				pm.headerDirty = true
+			case Page.MetaPageID:
+				if pm.metaPage.Header.LSN >= record.LSN {
+					continue
+				}
+				meta := Page.NewPageBPlusTree()
+				if err := meta.DeserializeFrom(image.Data); err != nil {
+					return err
+				}
+				meta.Header.LSN = record.LSN
+				meta.Header.SetDirty(false)
+				pm.metaPage = meta
+				pm.metaDirty = true
+			default:
+				// 页面可能还没写入文件，读取失败时直接重做
+				if page, err := pm.GetPage(image.PageID); err == nil && page.Header.LSN >= record.LSN {
+					continue
+				}
+				page := Page.NewPage()
+				if err := page.DeserializeFrom(image.Data); err != nil {
+					return err
+				}
+				page.Header.LSN = record.LSN
+				page.Header.SetDirty(false)
+				if err := pm.UpdatePage(page); err != nil {
+					return err
+				}
+			}
+		}
+		if record.PageID != 0 {
+			return rm.redoRecord(record)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return pm.Flush()
+}
+
+// 在日志记录的叶子上重新修改记录：After为空时删除键，否则插入或替换。
+// 页面中的状态和当时写日志之前一样，修改一定能成功
+func (rm *RecordManager) redoRecord(record *Transaction.LogRecord) error {
+	page, err := rm.pageManager.GetPage(record.PageID)
+	if err != nil {
+		return err
+	}
+	if page.Header.LSN >= record.LSN {
+		return nil
+	}
+	if len(record.After) == 0 {
+		err = page.DeleteRecord(record.Key)
+	} else {
+		var stored *Record.Record
+		if stored, err = parseRecordImage(record.After); err != nil {
+			return err
+		}
+		if _, findErr := page.FindRecord(record.Key); findErr == nil {
+			err, _ = page.UpdateRecord(stored)
+		} else {
+			err = page.InsertRecord(stored)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("重做日志 %d 失败: %v", record.LSN, err)
+	}
+	page.Header.LSN = record.LSN
+	page.Header.SetDirty(false)
+	return rm.pageManager.UpdatePage(page)
+}
+
+// 重做后的元数据页中是保存的事务ID计数器。只读事务和最后几个事务开始时保存的计数器
+// 可能还没有写入日志，日志中出现过的事务ID也跳过
+func (rm *RecordManager) restoreNextTransactionID(transactions map[int32]*recoveryTransaction) error {
+	meta, err := rm.pageManager.GetMetaPage()
+	if err != nil {
+		return err
+	}
+	next := int32(meta.GetNextTransactionID())
+	for transactionID := range transactions {
+		if transactionID >= next {
+			next = transactionID + 1
+		}
+	}
+	rm.transactionManager.SetNextTransactionID(next, rm.saveNextTransactionID)
+	return nil
+}
+
+// 撤销阶段：每次撤销LSN最大的一条日志，直到没有完成的事务都回滚到开始
+func (rm *RecordManager) undoPass(transactions map[int32]*recoveryTransaction) error {
+	logManager := rm.transactionManager.GetLogManager()
+	toUndo := make(map[int32]uint64)
+	for transactionID, transaction := range transactions {
+		if transaction.ended {
+			continue
+		}
+		tx := Transaction.NewTransaction(transactionID, 0, Transaction.ReadCommitted)
+		tx.LastLSN = transaction.lastLSN
+		rm.transactionManager.RestoreTransaction(tx)
+		toUndo[transactionID] = transaction.lastLSN
+	}
+
+	for len(toUndo) > 0 {
+		transactionIDs := make([]int32, 0, len(toUndo))
+		for transactionID := range toUndo {
+			transactionIDs = append(transactionIDs, transactionID)
+		}
+		sort.Slice(transactionIDs, func(i, j int) bool {
+			return toUndo[transactionIDs[i]] > toUndo[transactionIDs[j]]
+		})
+		transactionID := transactionIDs[0]
+
+		record, err := logManager.ReadRecord(toUndo[transactionID])
+		if err != nil {
+			return err
+		}
+		nextLSN := record.PrevLSN
+		switch {
+		case record.Type == Transaction.LogCLR:
+			// 补偿日志之前的操作已经撤销过了
+			nextLSN = record.UndoNextLSN
+		case record.IsUndoable():
+			if err := rm.undoOperation(record); err != nil {
+				return fmt.Errorf("撤销日志 %d 失败: %v", record.LSN, err)
+			}
+		}
+
+		if nextLSN == 0 {
+			if err := rm.transactionManager.Rollback(transactionID); err != nil {
+				return err
+			}
+			delete(toUndo, transactionID)
+		} else {
+			toUndo[transactionID] = nextLSN
+		}
+	}
+	return nil
+}
+
+// 解析日志中保存的记录
+func parseRecordImage(data []byte) (*Record.Record, error) {
+	record := &Record.Record{}
+	if err := record.DeserializeFrom(data); err != nil {
+		return nil, fmt.Errorf("解析日志中的记录失败: %v", err)
+	}
+	return record, nil
+}
@@ -0,0 +1,356 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+	"wudb/Transaction"
+)
+
+// 模拟崩溃：缓冲池中的页面和没写入磁盘的日志全部丢弃，然后重新打开数据库
+func crashAndReopen(t *testing.T, rm *RecordManager, fm *FileManager, config *Config) *RecordManager {
+	rm.fileHandle.Close()
+	handle, err := fm.OpenFile("test_record_manager")
+	if err != nil {
+		t.Fatalf("重新打开文件失败: %v", err)
+	}
+	t.Cleanup(func() { handle.Close() })
+	reopened, err := NewRecordManagerWithConfig(handle, config)
+	if err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	return reopened
+}
+
+// 检查键在[from, to)范围内的记录都存在并且值正确，并且树中一共有count条记录
+func checkRecords(t *testing.T, rm *RecordManager, from, to int, value string, count int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		record, err := rm.findRecord(createTestKey(uint32(i)))
+		if err != nil {
+			t.Errorf("查找第 %d 条记录失败: %v", i, err)
+			continue
+		}
+		if string(record.Value) != value {
+			t.Errorf("第 %d 条记录的值不正确: %q", i, record.Value)
+		}
+	}
+	results, err := rm.rangeQuery(createTestKey(0), createTestKey(1<<20))
+	if err != nil {
+		t.Fatalf("范围查询失败: %v", err)
+	}
+	if len(results) != count {
+		t.Errorf("记录总数不正确: 期望 %d, 实际 %d", count, len(results))
+	}
+}
+
+// 测试已提交的事务在崩溃后全部恢复
+func TestRecovery_CommittedTransaction(t *testing.T) {
+	rm, fm, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	for i := 0; i < 300; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), tx); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	if err := rm.transactionManager.Commit(tx.TransactionID); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+
+	// 页面一次都没有写回过
+	reopened := crashAndReopen(t, rm, fm, nil)
+	checkRecords(t, reopened, 0, 300, "value", 300)
+}
+
+// 测试叶子上的修改按记录重做：已经写回的页面跳过LSN不大于页面LSN的日志，之后的插入、更新和删除重新执行
+func TestRecovery_LeafRecordRedo(t *testing.T) {
+	rm, fm, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	for i := 0; i < 10; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), tx); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	if err := rm.Flush(); err != nil {
+		t.Fatalf("写回页面失败: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := rm.UpdateRecord(createTestRecord(uint32(i), "new"), tx); err != nil {
+			t.Fatalf("更新第 %d 条记录失败: %v", i, err)
+		}
+	}
+	for i := 5; i < 8; i++ {
+		if err := rm.DeleteRecord(createTestKey(uint32(i)), tx); err != nil {
+			t.Fatalf("删除第 %d 条记录失败: %v", i, err)
+		}
+	}
+	if err := rm.InsertRecord(createTestRecord(10, "value"), tx); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	if err := rm.transactionManager.Commit(tx.TransactionID); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+
+	reopened := crashAndReopen(t, rm, fm, nil)
+	checkRecords(t, reopened, 0, 5, "new", 8)
+	checkRecords(t, reopened, 8, 11, "value", 8)
+	for i := 5; i < 8; i++ {
+		if _, err := reopened.findRecord(createTestKey(uint32(i))); err != ErrNotFound {
+			t.Errorf("删除的第 %d 条记录不应该恢复: %v", i, err)
+		}
+	}
+}
+
+// 测试没有提交的事务在崩溃后被回滚，并写入补偿日志和中止日志
+func TestRecovery_UncommittedTransaction(t *testing.T) {
+	rm, fm, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx1 := createTestTransaction(t, rm)
+	for i := 0; i < 100; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), tx1); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	rm.transactionManager.Commit(tx1.TransactionID)
+
+	tx2 := Transaction.NewTransaction(2, 3, Transaction.ReadCommitted)
+	for i := 100; i < 200; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), strings.Repeat("n", 300)), tx2); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		if err := rm.DeleteRecord(createTestKey(uint32(i)), tx2); err != nil {
+			t.Fatalf("删除第 %d 条记录失败: %v", i, err)
+		}
+	}
+	if err := rm.UpdateRecord(createTestRecord(20, strings.Repeat("u", 2000)), tx2); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+	// 日志已经写入磁盘，但事务没有提交
+	rm.transactionManager.GetLogManager().FlushAll()
+
+	reopened := crashAndReopen(t, rm, fm, nil)
+	checkRecords(t, reopened, 0, 100, "value", 100)
+
+	var clrCount int
+	var last *Transaction.LogRecord
+	reopened.transactionManager.GetLogManager().Scan(Transaction.FirstLSN, func(record *Transaction.LogRecord) error {
+		if record.TransactionID == tx2.TransactionID {
+			if record.Type == Transaction.LogCLR {
+				clrCount++
+			}
+			last = record
+		}
+		return nil
+	})
+	if clrCount != 121 {
+		t.Errorf("补偿日志数量不正确: 期望 121, 实际 %d", clrCount)
+	}
+	if last == nil || last.Type != Transaction.LogAbort {
+		t.Errorf("回滚后应该写入中止日志: %v", last)
+	}
+}
+
+// 测试部分页面已经写回时崩溃，恢复后树结构完整，并且可以重复恢复
+func TestRecovery_PartialPageWrites(t *testing.T) {
+	rm, fm, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	config := &Config{PoolSize: 8}
+	small, err := NewRecordManagerWithConfig(rm.fileHandle, config)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	value := strings.Repeat("v", 500)
+	tx1 := createTestTransaction(t, small)
+	for i := 0; i < 200; i++ {
+		if err := small.InsertRecord(createTestRecord(uint32(i), value), tx1); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	small.transactionManager.Commit(tx1.TransactionID)
+
+	// 没有提交的事务导致页面分裂，部分页面被淘汰写回
+	tx2 := Transaction.NewTransaction(2, 3, Transaction.ReadCommitted)
+	for i := 200; i < 400; i++ {
+		if err := small.InsertRecord(createTestRecord(uint32(i), value), tx2); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+
+	reopened := crashAndReopen(t, small, fm, config)
+	checkRecords(t, reopened, 0, 200, value, 200)
+
+	// 恢复后马上再次崩溃，重复恢复的结果不变
+	reopened = crashAndReopen(t, reopened, fm, config)
+	checkRecords(t, reopened, 0, 200, value, 200)
+}
+
+// 测试回滚到一半时崩溃，已经撤销的操作不会被重复撤销
+func TestRecovery_CrashDuringRollback(t *testing.T) {
+	rm, fm, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	for i := 0; i < 10; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), tx); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	// 撤销最后三次插入
+	for i := 0; i < 3; i++ {
+		if err := rm.Undo(tx); err != nil {
+			t.Fatalf("撤销操作失败: %v", err)
+		}
+	}
+	rm.transactionManager.GetLogManager().FlushAll()
+
+	reopened := crashAndReopen(t, rm, fm, nil)
+	checkRecords(t, reopened, 0, 0, "", 0)
+
+	var clrCount int
+	reopened.transactionManager.GetLogManager().Scan(Transaction.FirstLSN, func(record *Transaction.LogRecord) error {
+		if record.Type == Transaction.LogCLR {
+			clrCount++
+		}
+		return nil
+	})
+	if clrCount != 10 {
+		t.Errorf("补偿日志数量不正确: 期望 10, 实际 %d", clrCount)
+	}
+}
+
+// 测试回滚到保存点后崩溃，恢复时沿补偿日志跳过已经撤销的操作，只回滚剩下的操作
+func TestRecovery_CrashAfterRollbackToSavepoint(t *testing.T) {
+	rm, fm, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	committed := createTestTransaction(t, rm)
+	for i := 0; i < 20; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), committed); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	committed.Savepoint("sp")
+	for i := 20; i < 40; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), committed); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	if err := rm.RollbackTo(committed, "sp"); err != nil {
+		t.Fatalf("回滚到保存点失败: %v", err)
+	}
+	if err := rm.InsertRecord(createTestRecord(100, "value"), committed); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	rm.transactionManager.Commit(committed.TransactionID)
+
+	active := Transaction.NewTransaction(2, 3, Transaction.ReadCommitted)
+	for i := 200; i < 210; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), active); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	active.Savepoint("sp")
+	for i := 210; i < 220; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), active); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	if err := rm.RollbackTo(active, "sp"); err != nil {
+		t.Fatalf("回滚到保存点失败: %v", err)
+	}
+	rm.transactionManager.GetLogManager().FlushAll()
+
+	reopened := crashAndReopen(t, rm, fm, nil)
+	checkRecords(t, reopened, 0, 20, "value", 21)
+	if _, err := reopened.findRecord(createTestKey(100)); err != nil {
+		t.Errorf("回滚到保存点之后提交的记录应该存在: %v", err)
+	}
+}
+
+// 测试事务ID计数器在正常关闭和崩溃后都继续递增
+func TestRecovery_TransactionIDs(t *testing.T) {
+	rm, fm, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx1, err := rm.Begin(Transaction.ReadCommitted)
+	if err != nil {
+		t.Fatalf("开始事务失败: %v", err)
+	}
+	if err := rm.InsertRecord(createTestRecord(1, "value"), tx1); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	if err := rm.Commit(tx1); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	// 只读事务分配的ID在关闭时随元数据页写回
+	tx2, err := rm.Begin(Transaction.RepeatableRead)
+	if err != nil {
+		t.Fatalf("开始事务失败: %v", err)
+	}
+	if tx2.TransactionID <= tx1.TransactionID {
+		t.Fatalf("事务ID应该递增: %d, %d", tx1.TransactionID, tx2.TransactionID)
+	}
+	if err := rm.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	reopened := crashAndReopen(t, rm, fm, nil)
+	tx3, err := reopened.Begin(Transaction.ReadCommitted)
+	if err != nil {
+		t.Fatalf("开始事务失败: %v", err)
+	}
+	if tx3.TransactionID <= tx2.TransactionID {
+		t.Errorf("重新打开后事务ID重复: %d, 之前 %d", tx3.TransactionID, tx2.TransactionID)
+	}
+	if err := reopened.InsertRecord(createTestRecord(2, "value"), tx3); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	reopened.transactionManager.GetLogManager().FlushAll()
+
+	// 崩溃时没有提交的事务被回滚，它的ID不会再分配
+	recovered := crashAndReopen(t, reopened, fm, nil)
+	tx4, err := recovered.Begin(Transaction.ReadCommitted)
+	if err != nil {
+		t.Fatalf("开始事务失败: %v", err)
+	}
+	if tx4.TransactionID <= tx3.TransactionID {
+		t.Errorf("崩溃恢复后事务ID重复: %d, 之前 %d", tx4.TransactionID, tx3.TransactionID)
+	}
+	checkRecords(t, recovered, 1, 2, "value", 1)
+}
+
+// 测试写回时损坏的页面在恢复时用日志中的镜像修复
+func TestRecovery_CorruptedPage(t *testing.T) {
+	rm, fm, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	for i := 0; i < 50; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), tx); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	rm.transactionManager.Commit(tx.TransactionID)
+	if err := rm.Flush(); err != nil {
+		t.Fatalf("写回失败: %v", err)
+	}
+
+	rootPageID := rm.pageManager.metaPage.RootPageID
+	offset := int64(FileHeaderSize) + int64(rootPageID)*int64(PageSize) + 2000
+	if _, err := rm.fileHandle.GetFile().WriteAt(make([]byte, 100), offset); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	if _, err := rm.pageManager.GetPage(rootPageID); err == nil {
+		t.Fatal("损坏的页面应该读取失败")
+	}
+
+	reopened := crashAndReopen(t, rm, fm, nil)
+	checkRecords(t, reopened, 0, 50, "value", 50)
+}
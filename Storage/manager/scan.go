@@ -0,0 +1,224 @@
+package manager
+
+import (
+	"bytes"
+	"wudb/Entity/Page"
+	"wudb/Entity/Record"
+	"wudb/Transaction"
+)
+
+// 范围的一端。Unbounded为true时这一端没有边界，否则空键也是一个有效的边界
+type Bound struct {
+	Key       []byte
+	Exclusive bool // 不包含Key本身
+	Unbounded bool // 没有边界，忽略Key和Exclusive
+}
+
+// 包含key的边界
+func Included(key []byte) Bound {
+	return Bound{Key: key}
+}
+
+// 不包含key的边界
+func Excluded(key []byte) Bound {
+	return Bound{Key: key, Exclusive: true}
+}
+
+// 没有边界
+func Unbounded() Bound {
+	return Bound{Unbounded: true}
+}
+
+// 查询的键范围，两端可以是开区间、闭区间或者没有边界
+type KeyRange struct {
+	Start Bound
+	End   Bound
+}
+
+// 闭区间[start, end]
+func ClosedRange(start, end []byte) KeyRange {
+	return KeyRange{Start: Included(start), End: Included(end)}
+}
+
+// 以prefix开头的所有键：[prefix, prefix的后继)，没有后继时没有上界
+func PrefixRange(prefix []byte) KeyRange {
+	successor := prefixSuccessor(prefix)
+	if successor == nil {
+		return KeyRange{Start: Included(prefix), End: Unbounded()}
+	}
+	return KeyRange{Start: Included(prefix), End: Excluded(successor)}
+}
+
+// 大于所有以prefix开头的键的最小键：去掉末尾的0xFF，再把最后一个字节加一。
+// prefix为空或者全是0xFF时没有后继，返回nil
+func prefixSuccessor(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xFF {
+			successor := append([]byte(nil), prefix[:i+1]...)
+			successor[i]++
+			return successor
+		}
+	}
+	return nil
+}
+
+// key没有超出下界
+func (r KeyRange) afterStart(key []byte) bool {
+	if r.Start.Unbounded {
+		return true
+	}
+	cmp := bytes.Compare(key, r.Start.Key)
+	return cmp > 0 || cmp == 0 && !r.Start.Exclusive
+}
+
+// key没有超出上界
+func (r KeyRange) beforeEnd(key []byte) bool {
+	if r.End.Unbounded {
+		return true
+	}
+	cmp := bytes.Compare(key, r.End.Key)
+	return cmp < 0 || cmp == 0 && !r.End.Exclusive
+}
+
+// 范围查询的选项，零值表示升序返回范围内的全部记录
+type ScanOptions struct {
+	Descending bool // 从上界开始沿PrevPageID向左扫描，结果从大到小排列
+	Offset     int  // 按扫描顺序跳过前面的记录
+	Limit      int  // 最多返回的记录数，0表示不限制
+}
+
+// 在事务中按选项查询范围内的记录，例如降序加Limit查询最新的N条记录。
+// 多版本模式下读事务的快照，否则按事务的隔离级别对读到的键加锁
+func (rm *RecordManager) Scan(keyRange KeyRange, options ScanOptions, tx *Transaction.Transaction) ([]*Record.Record, error) {
+	switch {
+	case rm.mvcc:
+		return rm.scanVisible(keyRange, options, tx)
+	case tx.IsolationLevel == Transaction.ReadUncommitted:
+		return rm.scanRange(keyRange, options)
+	default:
+		return rm.scanLocked(keyRange, options, tx)
+	}
+}
+
+// 在事务中按选项查询start和end之间的记录，两端的开闭由边界决定
+func (rm *RecordManager) RangeQueryWithOptions(start, end Bound, options ScanOptions, tx *Transaction.Transaction) ([]*Record.Record, error) {
+	return rm.Scan(KeyRange{Start: start, End: end}, options, tx)
+}
+
+// 在事务中做前缀查询：升序返回以prefix开头的所有记录
+func (rm *RecordManager) PrefixScan(prefix []byte, tx *Transaction.Transaction) ([]*Record.Record, error) {
+	return rm.Scan(PrefixRange(prefix), ScanOptions{}, tx)
+}
+
+// 跳过前面的offset条记录
+func skipRecords(records []*Record.Record, offset int) []*Record.Record {
+	if offset >= len(records) {
+		return nil
+	}
+	return records[offset:]
+}
+
+// 沿叶子链表按选项的方向扫描范围内的记录，够Limit条时停止
+func (rm *RecordManager) scanRange(keyRange KeyRange, options ScanOptions) ([]*Record.Record, error) {
+	if rm.pageManager.metaPage == nil {
+		return nil, ErrNotFound
+	}
+
+	var results []*Record.Record
+	skip := options.Offset
+	// 持有叶子的读闩时读溢出页，返回是否还要继续扫描
+	collect := func(stored *Record.Record) (bool, error) {
+		if skip > 0 {
+			skip--
+			return true, nil
+		}
+		record, err := rm.loadRecord(stored)
+		if err != nil {
+			return false, err
+		}
+		results = append(results, record)
+		return options.Limit <= 0 || len(results) < options.Limit, nil
+	}
+
+	var err error
+	if options.Descending {
+		err = rm.scanDescending(keyRange, collect)
+	} else {
+		err = rm.scanAscending(keyRange, collect)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// 从下界开始向右扫描，遇到超出上界的键时停止
+func (rm *RecordManager) scanAscending(keyRange KeyRange, collect func(*Record.Record) (bool, error)) error {
+	start := keyRange.Start
+	var from []byte
+	if !start.Unbounded {
+		from = start.Key
+	}
+	return rm.scanLeaves(from, func(page *Page.Page, after []byte) (bool, error) {
+		pos := 0
+		if !start.Unbounded {
+			pos = page.LowerBound(start.Key)
+			if start.Exclusive {
+				pos = page.UpperBound(start.Key)
+			}
+		}
+		if after != nil {
+			if next := page.UpperBound(after); next > pos {
+				pos = next
+			}
+		}
+		for ; pos < int(page.Header.RecordCount); pos++ {
+			if !keyRange.beforeEnd(page.KeyAt(pos)) {
+				return false, nil
+			}
+			stored, err := page.GetRecordAt(uint32(pos))
+			if err != nil {
+				return false, err
+			}
+			if more, err := collect(stored); err != nil || !more {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+}
+
+// 从上界开始向左扫描，遇到超出下界的键时停止
+func (rm *RecordManager) scanDescending(keyRange KeyRange, collect func(*Record.Record) (bool, error)) error {
+	end := keyRange.End
+	// from为nil时从最右边的叶子开始，空键的上界也要从它所在的叶子开始
+	var from []byte
+	if !end.Unbounded {
+		from = append([]byte{}, end.Key...)
+	}
+	first := true
+	return rm.scanLeavesBackward(from, func(page *Page.Page, before []byte) (bool, error) {
+		// 第一个叶子按上界的开闭确定从哪里开始，之后只看比扫描过的键更小的键
+		pos := int(page.Header.RecordCount)
+		if before != nil {
+			pos = page.LowerBound(before)
+		}
+		if first && from != nil && !end.Exclusive {
+			pos = page.UpperBound(from)
+		}
+		first = false
+		for pos--; pos >= 0; pos-- {
+			if !keyRange.afterStart(page.KeyAt(pos)) {
+				return false, nil
+			}
+			stored, err := page.GetRecordAt(uint32(pos))
+			if err != nil {
+				return false, err
+			}
+			if more, err := collect(stored); err != nil || !more {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+}
@@ -0,0 +1,207 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"wudb/Entity/Record"
+)
+
+// 测试升序和降序范围查询的开闭区间、无边界、Offset和Limit
+func TestRecordManager_Scan(t *testing.T) {
+	// 键为0, 2, ..., 598，分布在很多叶子中
+	rm, cleanup := setupCursorTest(t, 300)
+	defer cleanup()
+
+	key := createTestKey
+	tx := createTestTransaction(t, rm)
+	tests := []struct {
+		name     string
+		keyRange KeyRange
+		options  ScanOptions
+		first    uint32
+		count    int
+	}{
+		{"升序闭区间", ClosedRange(key(100), key(200)), ScanOptions{}, 100, 51},
+		{"升序开区间", KeyRange{Excluded(key(100)), Excluded(key(200))}, ScanOptions{}, 102, 49},
+		{"升序分页", ClosedRange(key(100), key(200)), ScanOptions{Offset: 10, Limit: 5}, 120, 5},
+		{"升序没有下界", KeyRange{Unbounded(), Excluded(key(10))}, ScanOptions{}, 0, 5},
+		{"升序没有上界", KeyRange{Excluded(key(590)), Unbounded()}, ScanOptions{}, 592, 4},
+		{"降序闭区间", ClosedRange(key(100), key(200)), ScanOptions{Descending: true}, 200, 51},
+		{"降序开区间", KeyRange{Excluded(key(100)), Excluded(key(200))}, ScanOptions{Descending: true}, 198, 49},
+		{"降序最新N条", KeyRange{Unbounded(), Unbounded()}, ScanOptions{Descending: true, Limit: 10}, 598, 10},
+		{"降序分页", ClosedRange(key(0), key(598)), ScanOptions{Descending: true, Offset: 20, Limit: 30}, 558, 30},
+		{"降序边界不存在", ClosedRange(key(101), key(199)), ScanOptions{Descending: true}, 198, 49},
+		{"降序没有下界", KeyRange{Unbounded(), Included(key(8))}, ScanOptions{Descending: true}, 8, 5},
+		{"降序跳过全部", ClosedRange(key(100), key(200)), ScanOptions{Descending: true, Offset: 100}, 0, 0},
+		{"单个键排除", KeyRange{Included(key(100)), Excluded(key(100))}, ScanOptions{Descending: true}, 0, 0},
+	}
+	for _, tt := range tests {
+		records, err := rm.Scan(tt.keyRange, tt.options, tx)
+		if err != nil {
+			t.Fatalf("%s: 范围查询失败: %v", tt.name, err)
+		}
+		if len(records) != tt.count {
+			t.Errorf("%s: 期望 %d 条记录, 实际 %d", tt.name, tt.count, len(records))
+			continue
+		}
+		step := 2
+		if tt.options.Descending {
+			step = -2
+		}
+		for i, record := range records {
+			if k := keyOf(record.GetKey()); k != uint32(int(tt.first)+i*step) {
+				t.Errorf("%s: 第 %d 条记录的键不正确: %d", tt.name, i, k)
+				break
+			}
+		}
+	}
+}
+
+// 测试RangeQueryWithOptions按边界决定开闭
+func TestRecordManager_RangeQueryWithOptions(t *testing.T) {
+	rm, cleanup := setupCursorTest(t, 300)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	tests := []struct {
+		name       string
+		start, end Bound
+		options    ScanOptions
+		first      uint32
+		count      int
+	}{
+		{"升序闭区间", Included(createTestKey(100)), Included(createTestKey(200)), ScanOptions{}, 100, 51},
+		{"升序开区间", Excluded(createTestKey(100)), Excluded(createTestKey(200)), ScanOptions{}, 102, 49},
+		{"降序开区间", Excluded(createTestKey(100)), Excluded(createTestKey(200)), ScanOptions{Descending: true}, 198, 49},
+		{"降序最新N条", Included(createTestKey(0)), Included(createTestKey(1000)), ScanOptions{Descending: true, Limit: 10}, 598, 10},
+		{"单个键排除", Included(createTestKey(100)), Excluded(createTestKey(100)), ScanOptions{Descending: true}, 0, 0},
+	}
+	for _, tt := range tests {
+		records, err := rm.RangeQueryWithOptions(tt.start, tt.end, tt.options, tx)
+		if err != nil {
+			t.Fatalf("%s: 范围查询失败: %v", tt.name, err)
+		}
+		if len(records) != tt.count {
+			t.Errorf("%s: 期望 %d 条记录, 实际 %d", tt.name, tt.count, len(records))
+			continue
+		}
+		step := 2
+		if tt.options.Descending {
+			step = -2
+		}
+		for i, record := range records {
+			if k := keyOf(record.GetKey()); k != uint32(int(tt.first)+i*step) {
+				t.Errorf("%s: 第 %d 条记录的键不正确: %d", tt.name, i, k)
+				break
+			}
+		}
+	}
+}
+
+// 测试空键是有效的边界，和没有边界不同
+func TestRecordManager_ScanEmptyKeyBound(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	for _, key := range []string{"", "a", "b"} {
+		if err := rm.InsertRecord(Record.NewRecordByTransaction(0, []byte(key), []byte("v"+key)), tx); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+
+	empty := []byte{}
+	tests := []struct {
+		name     string
+		keyRange KeyRange
+		options  ScanOptions
+		keys     []string
+	}{
+		{"只有空键", ClosedRange(empty, empty), ScanOptions{}, []string{""}},
+		{"降序只有空键", ClosedRange(nil, nil), ScanOptions{Descending: true}, []string{""}},
+		{"小于空键", KeyRange{Unbounded(), Excluded(empty)}, ScanOptions{}, nil},
+		{"降序小于空键", KeyRange{Unbounded(), Excluded(empty)}, ScanOptions{Descending: true}, nil},
+		{"大于空键", KeyRange{Excluded(empty), Unbounded()}, ScanOptions{}, []string{"a", "b"}},
+		{"全部", KeyRange{Unbounded(), Unbounded()}, ScanOptions{Descending: true}, []string{"b", "a", ""}},
+	}
+	for _, tt := range tests {
+		records, err := rm.Scan(tt.keyRange, tt.options, tx)
+		if err != nil {
+			t.Fatalf("%s: 范围查询失败: %v", tt.name, err)
+		}
+		var keys []string
+		for _, record := range records {
+			keys = append(keys, string(record.GetKey()))
+		}
+		if fmt.Sprint(keys) != fmt.Sprint(tt.keys) {
+			t.Errorf("%s: 期望 %q, 实际 %q", tt.name, tt.keys, keys)
+		}
+	}
+}
+
+// 测试前缀的后继键
+func TestPrefixSuccessor(t *testing.T) {
+	tests := []struct {
+		prefix    []byte
+		successor []byte
+	}{
+		{[]byte("user"), []byte("uses")},
+		{[]byte("a\xff\xff"), []byte("b")},
+		{[]byte{0x01, 0xFE}, []byte{0x01, 0xFF}},
+		{[]byte{0xFF, 0xFF}, nil},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		if got := prefixSuccessor(tt.prefix); !bytes.Equal(got, tt.successor) || (got == nil) != (tt.successor == nil) {
+			t.Errorf("%q 的后继应该是 %q, 实际 %q", tt.prefix, tt.successor, got)
+		}
+	}
+}
+
+// 测试前缀查询只返回以前缀开头的键，包括后面是0xFF的键
+func TestRecordManager_PrefixScan(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	keys := []string{"app", "user", "user\xff", "user\xff\xff", "uses", "\xff", "\xff\xff"}
+	for i := 0; i < 100; i++ {
+		keys = append(keys, fmt.Sprintf("user:%03d", i))
+	}
+	tx := createTestTransaction(t, rm)
+	for _, key := range keys {
+		if err := rm.InsertRecord(Record.NewRecordByTransaction(0, []byte(key), []byte(key)), tx); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		count  int
+	}{
+		{"user", 103},
+		{"user:", 100},
+		{"user:05", 10},
+		{"user\xff", 2},
+		{"\xff", 2},
+		{"x", 0},
+		{"", len(keys)},
+	}
+	for _, tt := range tests {
+		records, err := rm.PrefixScan([]byte(tt.prefix), tx)
+		if err != nil {
+			t.Fatalf("前缀查询失败: %v", err)
+		}
+		if len(records) != tt.count {
+			t.Errorf("前缀 %q: 期望 %d 条记录, 实际 %d", tt.prefix, tt.count, len(records))
+		}
+		for i, record := range records {
+			if !bytes.HasPrefix(record.GetKey(), []byte(tt.prefix)) {
+				t.Errorf("前缀 %q: 键 %q 不匹配", tt.prefix, record.GetKey())
+			}
+			if i > 0 && bytes.Compare(records[i-1].GetKey(), record.GetKey()) >= 0 {
+				t.Errorf("前缀 %q: 键没有按顺序排列", tt.prefix)
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package manager
+
+import (
+	"sync"
+	"wudb/Transaction"
+)
+
+// 可串行化快照隔离（SSI）：在多版本的快照读之上记录可串行化事务之间的读写依赖。
+// 事务R读到的版本被并发的事务W覆盖时有一条R->W的边，包括R读时跳过了W写的较新版本，
+// 以及R读过的键或范围之后被W写入。一个事务同时有入边和出边时构成危险结构，
+// 提交时回滚它；事务的出边指向已经提交、并且还有出边的事务时也回滚，
+// 这时中间的事务已经提交，只能回滚还没有提交的一端。
+// 只跟踪可串行化级别的事务，事务管理器的每次提交都先经过检查，事务结束后回收不再需要的依赖
+
+// 可串行化的事务与并发事务之间存在可能违反可串行化的读写依赖，事务已经回滚，可以重试
+const ErrSerializationFailure = Error("可串行化冲突，事务被回滚")
+
+// 事务读过的键范围，点查询是只有一个键的闭区间
+type readPredicate struct {
+	keyRange KeyRange
+}
+
+func (p readPredicate) covers(key []byte) bool {
+	return p.keyRange.afterStart(key) && p.keyRange.beforeEnd(key)
+}
+
+// 一个可串行化事务的读集合和读写依赖
+type ssiTransaction struct {
+	transactionID   int32
+	readTimestamp   uint32
+	commitTimestamp uint32
+	committed       bool
+	aborted         bool
+	reads           []readPredicate
+	inConflicts     map[int32]*ssiTransaction // 读过这个事务覆盖的版本的事务
+	outConflicts    map[int32]*ssiTransaction // 这个事务读过的版本被这些事务覆盖
+}
+
+type ssiTracker struct {
+	mutex        sync.Mutex
+	transactions map[int32]*ssiTransaction
+}
+
+func newSSITracker() *ssiTracker {
+	return &ssiTracker{transactions: make(map[int32]*ssiTransaction)}
+}
+
+// 已经取得快照的事务第一次读写时开始跟踪
+func (st *ssiTracker) track(tx *Transaction.Transaction) *ssiTransaction {
+	t, ok := st.transactions[tx.TransactionID]
+	if !ok {
+		t = &ssiTransaction{
+			transactionID: tx.TransactionID,
+			readTimestamp: tx.ReadTimestamp,
+			inConflicts:   make(map[int32]*ssiTransaction),
+			outConflicts:  make(map[int32]*ssiTransaction),
+		}
+		st.transactions[tx.TransactionID] = t
+	}
+	return t
+}
+
+// 读版本链之前记录读的范围，之后写入这个范围的事务能找到读者
+func (st *ssiTracker) recordRead(tx *Transaction.Transaction, keyRange KeyRange) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	reader := st.track(tx)
+	keyRange.Start.Key = append([]byte(nil), keyRange.Start.Key...)
+	keyRange.End.Key = append([]byte(nil), keyRange.End.Key...)
+	reader.reads = append(reader.reads, readPredicate{keyRange: keyRange})
+}
+
+// 读之后记录读时跳过的较新版本的写入者
+func (st *ssiTracker) recordSkipped(tx *Transaction.Transaction, skipped []int32) {
+	if len(skipped) == 0 {
+		return
+	}
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	reader := st.track(tx)
+	for _, writerID := range skipped {
+		if writer, ok := st.transactions[writerID]; ok && !writer.aborted {
+			addConflict(reader, writer)
+		}
+	}
+}
+
+// 写入键时找出读过这个键的并发事务
+func (st *ssiTracker) recordWrite(tx *Transaction.Transaction, key []byte) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	writer := st.track(tx)
+	for _, reader := range st.transactions {
+		if reader == writer || reader.aborted {
+			continue
+		}
+		// 在写入者开始之前提交的事务不是并发事务
+		if reader.committed && reader.commitTimestamp <= writer.readTimestamp {
+			continue
+		}
+		for _, predicate := range reader.reads {
+			if predicate.covers(key) {
+				addConflict(reader, writer)
+				break
+			}
+		}
+	}
+}
+
+// 检查危险结构，没有时调用commit提交事务。检查和提交在同一个临界区中，提交前不会出现新的依赖
+func (st *ssiTracker) commit(tx *Transaction.Transaction, commit func() error) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	t, ok := st.transactions[tx.TransactionID]
+	if !ok {
+		return commit()
+	}
+	if t.dangerous() {
+		return ErrSerializationFailure
+	}
+	if err := commit(); err != nil {
+		return err
+	}
+	t.committed = true
+	t.commitTimestamp = tx.CommitTimestamp
+	return nil
+}
+
+// 事务回滚后不再参与依赖
+func (st *ssiTracker) abort(transactionID int32) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if t, ok := st.transactions[transactionID]; ok {
+		t.aborted = true
+		delete(st.transactions, transactionID)
+	}
+}
+
+// 删除在最早的快照之前提交的事务，它们与所有活动事务都不是并发的
+func (st *ssiTracker) collect(oldest uint32) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	for transactionID, t := range st.transactions {
+		if t.committed && t.commitTimestamp <= oldest {
+			delete(st.transactions, transactionID)
+		}
+	}
+}
+
+// 正在跟踪的事务数量
+func (st *ssiTracker) size() int {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	return len(st.transactions)
+}
+
+// 事务是危险结构的中间，或者它的出边指向已经提交的中间事务
+func (t *ssiTransaction) dangerous() bool {
+	hasIn := false
+	for _, in := range t.inConflicts {
+		if !in.aborted {
+			hasIn = true
+			break
+		}
+	}
+	for _, out := range t.outConflicts {
+		if out.aborted {
+			continue
+		}
+		if hasIn {
+			return true
+		}
+		if out.committed {
+			for _, next := range out.outConflicts {
+				if !next.aborted {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func addConflict(reader, writer *ssiTransaction) {
+	if reader == writer {
+		return
+	}
+	reader.outConflicts[writer.transactionID] = writer
+	writer.inConflicts[reader.transactionID] = reader
+}
+
+// 多版本模式下可串行化事务的读操作记录读集合
+func (rm *RecordManager) recordRead(tx *Transaction.Transaction, keyRange KeyRange) {
+	if rm.mvcc && tx.IsolationLevel == Transaction.Serializable {
+		rm.serializable.recordRead(tx, keyRange)
+	}
+}
+
+func (rm *RecordManager) recordSkipped(tx *Transaction.Transaction, skipped []int32) {
+	if rm.mvcc && tx.IsolationLevel == Transaction.Serializable {
+		rm.serializable.recordSkipped(tx, skipped)
+	}
+}
+
+// 多版本模式下可串行化事务的写操作检查读过这个键的并发事务，
+// 在修改树之后检查，检查之前开始读的事务会在版本链中跳过这次写入
+func (rm *RecordManager) recordWrite(tx *Transaction.Transaction, key []byte) {
+	if rm.mvcc && tx.IsolationLevel == Transaction.Serializable {
+		rm.serializable.recordWrite(tx, key)
+	}
+}
+
+// 提交事务。可串行化的事务先检查读写依赖，可能违反可串行化时回滚并返回ErrSerializationFailure
+func (rm *RecordManager) Commit(tx *Transaction.Transaction) error {
+	rm.transactionManager.RegisterTransaction(tx)
+	return rm.transactionManager.Commit(tx.TransactionID)
+}
+
+// 事务管理器提交前的检查，直接通过事务管理器提交的事务也要检查读写依赖
+func (rm *RecordManager) checkCommit(tx *Transaction.Transaction, commit func() error) error {
+	return rm.abortOnConflict(tx, rm.serializable.commit(tx, commit))
+}
@@ -0,0 +1,132 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+	"wudb/Transaction"
+)
+
+// 两个事务都读了键1和键2，再各自修改其中一个（写偏斜），用commit提交
+func writeSkew(t *testing.T, rm *RecordManager, isolationLevel int32, commit func(tx *Transaction.Transaction) error) (error, error) {
+	setup := Transaction.NewTransaction(10, 11, Transaction.ReadCommitted)
+	if err := rm.InsertRecord(createTestRecord(2, "v1"), setup); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	rm.Commit(setup)
+
+	tx1 := Transaction.NewTransaction(11, 12, isolationLevel)
+	tx2 := Transaction.NewTransaction(12, 13, isolationLevel)
+	for _, tx := range []*Transaction.Transaction{tx1, tx2} {
+		for _, key := range []uint32{1, 2} {
+			if _, err := rm.FindRecord(createTestKey(key), tx); err != nil {
+				t.Fatalf("查找记录失败: %v", err)
+			}
+		}
+	}
+	if err := rm.UpdateRecord(createTestRecord(1, "off"), tx1); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+	if err := rm.UpdateRecord(createTestRecord(2, "off"), tx2); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+	return commit(tx1), commit(tx2)
+}
+
+// 测试可串行化级别检测到写偏斜并回滚其中一个事务，可重复读允许写偏斜
+func TestSSI_WriteSkew(t *testing.T) {
+	rm, cleanup := setupMVCCTest(t)
+	err1, err2 := writeSkew(t, rm, Transaction.RepeatableRead, rm.Commit)
+	cleanup()
+	if err1 != nil || err2 != nil {
+		t.Fatalf("可重复读应该允许写偏斜: %v, %v", err1, err2)
+	}
+
+	rm, cleanup = setupMVCCTest(t)
+	defer cleanup()
+	err1, err2 = writeSkew(t, rm, Transaction.Serializable, rm.Commit)
+	if !errors.Is(err1, ErrSerializationFailure) {
+		t.Fatalf("先提交的事务是危险结构的中间，应该被回滚: %v", err1)
+	}
+	if err2 != nil {
+		t.Fatalf("另一个事务应该可以提交: %v", err2)
+	}
+	// 被回滚的修改不可见
+	reader := Transaction.NewTransaction(20, 21, Transaction.Serializable)
+	expectValue(t, rm, reader, "v1")
+}
+
+// 测试直接通过事务管理器提交也要检查读写依赖
+func TestSSI_TransactionManagerCommit(t *testing.T) {
+	rm, cleanup := setupMVCCTest(t)
+	defer cleanup()
+
+	err1, err2 := writeSkew(t, rm, Transaction.Serializable, func(tx *Transaction.Transaction) error {
+		return rm.transactionManager.Commit(tx.TransactionID)
+	})
+	if !errors.Is(err1, ErrSerializationFailure) {
+		t.Fatalf("绕过RecordManager.Commit提交也应该检测到写偏斜: %v", err1)
+	}
+	if err2 != nil {
+		t.Fatalf("另一个事务应该可以提交: %v", err2)
+	}
+	reader := Transaction.NewTransaction(20, 21, Transaction.Serializable)
+	expectValue(t, rm, reader, "v1")
+}
+
+// 测试范围查询读过的范围被并发事务插入时也能检测到冲突
+func TestSSI_RangeQuery(t *testing.T) {
+	rm, cleanup := setupMVCCTest(t)
+	defer cleanup()
+
+	tx1 := Transaction.NewTransaction(2, 3, Transaction.Serializable)
+	tx2 := Transaction.NewTransaction(3, 4, Transaction.Serializable)
+	for _, tx := range []*Transaction.Transaction{tx1, tx2} {
+		records, err := rm.RangeQuery(createTestKey(0), createTestKey(10), tx)
+		if err != nil {
+			t.Fatalf("范围查询失败: %v", err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("范围查询应该返回 1 条记录, 实际 %d", len(records))
+		}
+	}
+	// 两个事务都根据范围查询的结果向范围中插入
+	if err := rm.InsertRecord(createTestRecord(5, "tx1"), tx1); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	if err := rm.InsertRecord(createTestRecord(6, "tx2"), tx2); err != nil {
+		t.Fatalf("插入记录失败: %v", err)
+	}
+	if err := rm.Commit(tx1); !errors.Is(err, ErrSerializationFailure) {
+		t.Fatalf("范围查询的读写依赖应该被检测到: %v", err)
+	}
+	if err := rm.Commit(tx2); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	if _, err := rm.findRecord(createTestKey(5)); err != ErrNotFound {
+		t.Errorf("被回滚的插入不应该存在: %v", err)
+	}
+}
+
+// 测试只有一条依赖时可以提交，没有活动事务后已提交的事务在提交时就被回收
+func TestSSI_SingleDependency(t *testing.T) {
+	rm, cleanup := setupMVCCTest(t)
+	defer cleanup()
+
+	reader := Transaction.NewTransaction(2, 3, Transaction.Serializable)
+	writer := Transaction.NewTransaction(3, 4, Transaction.Serializable)
+	expectValue(t, rm, reader, "v1")
+	if err := rm.UpdateRecord(createTestRecord(1, "v2"), writer); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+	if err := rm.Commit(writer); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	expectValue(t, rm, reader, "v1")
+	if err := rm.Commit(reader); err != nil {
+		t.Fatalf("读事务只有出边，应该可以提交: %v", err)
+	}
+
+	if size := rm.serializable.size(); size != 0 {
+		t.Errorf("没有活动事务后不应该再跟踪已提交的事务, 实际 %d", size)
+	}
+}
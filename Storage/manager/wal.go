@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"wudb/Entity/Page"
+	"wudb/Entity/Record"
+	"wudb/Transaction"
+)
+
+// 每个操作结束时写一条日志。只修改了一个叶子的操作只记录键和修改后的记录，重做时在叶子上重新修改；
+// 分裂、合并、分配页面等改变结构的操作持有结构闩，日志中带有它修改过的页面镜像，
+// 还有元数据页、文件头和释放的页面镜像。修改过的页面在写日志之前一直由操作持有写闩，
+// 写入日志之前页面不会被写回，写回页面前日志先写到页面的LSN。
+// 操作日志中还有记录修改前后的镜像，回滚时沿事务的日志链读取，崩溃后也能撤销。
+
+// 一次写操作，持有它加的写闩和修改过的页面
+type operation struct {
+	latchOwner
+	rm         *RecordManager
+	structural bool // 持有结构闩
+}
+
+func (rm *RecordManager) newOperation() *operation {
+	return &operation{rm: rm}
+}
+
+// 分配或释放页面、修改元数据页之前获取结构闩，必须在加任何页面的闩之前
+func (op *operation) lockStructure() {
+	if !op.structural {
+		op.rm.structureLatch.Lock()
+		op.structural = true
+	}
+}
+
+func (op *operation) fetchPage(pageID uint32) (*Page.Page, error) {
+	return op.rm.bufferPool.FetchPageWrite(pageID, &op.latchOwner)
+}
+
+func (op *operation) newPage(pageType uint32) (*Page.Page, error) {
+	return op.rm.bufferPool.NewPageWrite(pageType, &op.latchOwner)
+}
+
+func (op *operation) unpinPage(pageID uint32, isDirty bool) error {
+	return op.rm.bufferPool.UnpinPageWrite(pageID, &op.latchOwner, isDirty)
+}
+
+// 写入操作的日志，放开修改过的页面，结构闩继续持有。logRecord为nil时只记录页面镜像：
+// 溢出页在记录插入前写入，失败的操作也可能已经改了页面。返回日志的LSN，没有写日志时返回0
+func (op *operation) log(logRecord *Transaction.LogRecord) (uint64, error) {
+	defer op.rm.bufferPool.releaseWrites(&op.latchOwner)
+	if logRecord == nil {
+		logRecord = Transaction.NewLogRecord(0, Transaction.LogPageImage)
+	}
+	var pageIDs []uint32
+	var err error
+	if pageID, ok := op.leafDelta(logRecord); ok {
+		logRecord.PageID = pageID
+		pageIDs = []uint32{pageID}
+	} else if pageIDs, err = op.rm.bufferPool.addImages(logRecord, &op.latchOwner, op.structural); err != nil {
+		return 0, err
+	}
+
+	var lsn uint64
+	if logRecord.Type == Transaction.LogPageImage {
+		if len(logRecord.Pages) == 0 {
+			return 0, nil
+		}
+		// 只有页面镜像的日志不属于任何事务
+		lsn, err = op.rm.transactionManager.GetLogManager().Append(logRecord)
+	} else {
+		lsn, err = op.rm.transactionManager.WriteLog(logRecord)
+	}
+	if err != nil {
+		return 0, err
+	}
+	op.rm.bufferPool.markLogged(pageIDs, lsn, op.structural)
+	return lsn, nil
+}
+
+// 没有持有结构闩的操作只修改了一个叶子时按记录重做，返回叶子的页面ID。
+// 溢出的记录都由持有结构闩的操作写入和删除，叶子中保存的就是日志中修改后的记录
+func (op *operation) leafDelta(logRecord *Transaction.LogRecord) (uint32, bool) {
+	if op.structural || len(op.modified) != 1 {
+		return 0, false
+	}
+	if !logRecord.IsUndoable() && logRecord.Type != Transaction.LogCLR {
+		return 0, false
+	}
+	return op.modified[0], true
+}
+
+// 写入操作的日志后结束操作，放开所有闩
+func (op *operation) commit(logRecord *Transaction.LogRecord) (uint64, error) {
+	defer op.finish()
+	return op.log(logRecord)
+}
+
+// 放开操作持有的闩，不写日志。只用于没有修改页面的操作
+func (op *operation) finish() {
+	op.rm.bufferPool.releaseWrites(&op.latchOwner)
+	if op.structural {
+		op.rm.structureLatch.Unlock()
+		op.structural = false
+	}
+}
+
+// 日志中保存的记录
+func recordImage(record *Record.Record) []byte {
+	if record == nil {
+		return nil
+	}
+	data, err := record.SerializeTo()
+	if err != nil {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,158 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+	"wudb/Transaction"
+)
+
+// 按顺序读出日志中的所有记录
+func readAllLogs(t *testing.T, rm *RecordManager) []*Transaction.LogRecord {
+	var records []*Transaction.LogRecord
+	err := rm.transactionManager.GetLogManager().Scan(Transaction.FirstLSN, func(record *Transaction.LogRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("读取日志失败: %v", err)
+	}
+	return records
+}
+
+// 测试每种操作都写入对应的日志，提交时日志落盘
+func TestWAL_OperationLogs(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	for i := 0; i < 3; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), tx); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+	if err := rm.UpdateRecord(createTestRecord(1, "new value"), tx); err != nil {
+		t.Fatalf("更新记录失败: %v", err)
+	}
+	if err := rm.DeleteRecord(createTestKey(2), tx); err != nil {
+		t.Fatalf("删除记录失败: %v", err)
+	}
+	if err := rm.transactionManager.Commit(tx.TransactionID); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+
+	logManager := rm.transactionManager.GetLogManager()
+	if logManager.GetFlushedLSN() != logManager.GetNextLSN() {
+		t.Error("提交后日志应该全部写入磁盘")
+	}
+
+	records := readAllLogs(t, rm)
+	types := []uint8{Transaction.LogBegin, Transaction.LogInsert, Transaction.LogInsert, Transaction.LogInsert,
+		Transaction.LogUpdate, Transaction.LogDelete, Transaction.LogCommit}
+	if len(records) != len(types) {
+		t.Fatalf("日志数量不正确: 期望 %d, 实际 %d", len(types), len(records))
+	}
+	prevLSN := uint64(0)
+	for i, record := range records {
+		if record.Type != types[i] {
+			t.Errorf("第 %d 条日志类型不正确: %v", i, record)
+		}
+		if record.PrevLSN != prevLSN {
+			t.Errorf("第 %d 条日志的PrevLSN不正确: 期望 %d, 实际 %d", i, prevLSN, record.PrevLSN)
+		}
+		prevLSN = record.LSN
+	}
+	// 第一次插入创建根节点，记录页面镜像；之后只修改叶子，只记录键和记录
+	if len(records[1].Pages) == 0 || records[1].PageID != 0 {
+		t.Errorf("创建根节点的日志应该带有页面镜像: %v", records[1])
+	}
+	for i := 2; i <= 5; i++ {
+		if len(records[i].Pages) != 0 || records[i].PageID != records[1].Pages[0].PageID {
+			t.Errorf("第 %d 条日志应该只记录叶子 %d 上的修改: %v", i, records[1].Pages[0].PageID, records[i])
+		}
+	}
+	if len(records[4].Before) == 0 || len(records[4].After) == 0 {
+		t.Error("更新日志应该包含修改前后的记录")
+	}
+	if len(records[5].Before) == 0 {
+		t.Error("删除日志应该包含被删除的记录")
+	}
+
+	// 页面的LSN是最后一次修改它的日志
+	leaf, err := rm.findLeaf(createTestKey(0), nil)
+	if err != nil || leaf == nil {
+		t.Fatalf("查找叶子节点失败: %v", err)
+	}
+	defer rm.bufferPool.UnpinPageRead(leaf.Header.PageID)
+	if leaf.Header.LSN != records[5].LSN {
+		t.Errorf("页面LSN不正确: 期望 %d, 实际 %d", records[5].LSN, leaf.Header.LSN)
+	}
+}
+
+// 测试回滚写入补偿日志和中止日志
+func TestWAL_RollbackLogs(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	tx := createTestTransaction(t, rm)
+	for i := 0; i < 2; i++ {
+		if err := rm.InsertRecord(createTestRecord(uint32(i), "value"), tx); err != nil {
+			t.Fatalf("插入记录失败: %v", err)
+		}
+	}
+	if err := rm.Rollback(tx); err != nil {
+		t.Fatalf("回滚事务失败: %v", err)
+	}
+
+	records := readAllLogs(t, rm)
+	if len(records) != 6 {
+		t.Fatalf("日志数量不正确: 期望 6, 实际 %d", len(records))
+	}
+	// 第二次插入的补偿日志指向第一次插入，第一次插入的补偿日志指向开始日志
+	if records[3].Type != Transaction.LogCLR || records[3].UndoNextLSN != records[1].LSN {
+		t.Errorf("补偿日志不正确: %v", records[3])
+	}
+	if records[4].Type != Transaction.LogCLR || records[4].UndoNextLSN != records[0].LSN {
+		t.Errorf("补偿日志不正确: %v", records[4])
+	}
+	if records[5].Type != Transaction.LogAbort {
+		t.Errorf("最后一条日志应该是中止日志: %v", records[5])
+	}
+}
+
+// 测试页面写回磁盘前日志先写到页面的LSN
+func TestWAL_LogBeforeData(t *testing.T) {
+	rm, _, cleanup := setupRecordManagerTest(t)
+	defer cleanup()
+
+	small, err := NewRecordManagerWithConfig(rm.fileHandle, &Config{PoolSize: 8})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	tx := createTestTransaction(t, small)
+	value := strings.Repeat("v", 500)
+	for i := 0; i < 200; i++ {
+		if err := small.InsertRecord(createTestRecord(uint32(i), value), tx); err != nil {
+			t.Fatalf("插入第 %d 条记录失败: %v", i, err)
+		}
+	}
+	// 没有提交，但淘汰页面时日志已经写入磁盘
+	if small.GetBufferPoolStats().Evictions == 0 {
+		t.Fatal("页面应该被淘汰")
+	}
+	flushedLSN := small.transactionManager.GetLogManager().GetFlushedLSN()
+	meta, _ := small.pageManager.GetMetaPage()
+	for pageID := uint32(1); pageID <= meta.LastPageID; pageID++ {
+		page, err := small.pageManager.GetPage(pageID)
+		if err != nil {
+			// 还没写回的新页面
+			continue
+		}
+		if page.Header.LSN >= flushedLSN {
+			t.Errorf("页面 %d 的日志还没写入磁盘: 页面LSN %d, 已写入 %d", pageID, page.Header.LSN, flushedLSN)
+		}
+	}
+
+	if err := small.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+}
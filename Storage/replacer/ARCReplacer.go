@@ -0,0 +1,181 @@
+package replacer
+
+import "container/list"
+
+const (
+	arcT1 = iota // 只访问过一次的驻留页面
+	arcT2        // 访问过多次的驻留页面
+	arcB1        // 从T1淘汰的幽灵页面
+	arcB2        // 从T2淘汰的幽灵页面
+)
+
+type arcEntry struct {
+	pageID    uint32
+	where     int
+	elem      *list.Element
+	evictable bool
+}
+
+// 自适应置换缓存(ARC)
+// T1/T2保存驻留页面，B1/B2只保存最近被淘汰页面的ID，
+// 幽灵命中时调整T1的目标大小p，在近期性和频率之间自适应
+type ARCReplacer struct {
+	capacity  int
+	p         int // T1的目标大小
+	lists     [4]*list.List
+	entries   map[uint32]*arcEntry
+	evictable int
+}
+
+func NewARCReplacer(capacity int) *ARCReplacer {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	r := &ARCReplacer{
+		capacity: capacity,
+		entries:  make(map[uint32]*arcEntry),
+	}
+	for i := range r.lists {
+		r.lists[i] = list.New()
+	}
+	return r
+}
+
+func (r *ARCReplacer) RecordAccess(pageID uint32) {
+	entry, ok := r.entries[pageID]
+	if !ok {
+		// 新页面：先限制幽灵列表的长度，再放入T1
+		if r.lists[arcT1].Len()+r.lists[arcB1].Len() >= r.capacity && r.lists[arcB1].Len() > 0 {
+			r.dropGhost(arcB1)
+		} else if r.totalLen() >= 2*r.capacity && r.lists[arcB2].Len() > 0 {
+			r.dropGhost(arcB2)
+		}
+		entry = &arcEntry{pageID: pageID, where: arcT1}
+		entry.elem = r.lists[arcT1].PushBack(entry)
+		r.entries[pageID] = entry
+		return
+	}
+
+	switch entry.where {
+	case arcT1, arcT2:
+		r.moveTo(entry, arcT2)
+	case arcB1:
+		// 最近淘汰的只访问一次的页面又被访问，增大T1
+		delta := 1
+		if b1 := r.lists[arcB1].Len(); r.lists[arcB2].Len() > b1 {
+			delta = r.lists[arcB2].Len() / b1
+		}
+		r.p = min(r.capacity, r.p+delta)
+		r.moveTo(entry, arcT2)
+	case arcB2:
+		// 最近淘汰的频繁页面又被访问，缩小T1
+		delta := 1
+		if b2 := r.lists[arcB2].Len(); r.lists[arcB1].Len() > b2 {
+			delta = r.lists[arcB1].Len() / b2
+		}
+		r.p = max(0, r.p-delta)
+		r.moveTo(entry, arcT2)
+	}
+}
+
+func (r *ARCReplacer) SetEvictable(pageID uint32, evictable bool) {
+	entry, ok := r.entries[pageID]
+	if !ok || entry.where > arcT2 || entry.evictable == evictable {
+		return
+	}
+	entry.evictable = evictable
+	if evictable {
+		r.evictable++
+	} else {
+		r.evictable--
+	}
+}
+
+func (r *ARCReplacer) Evict() (uint32, bool) {
+	first, second := arcT2, arcT1
+	if r.lists[arcT1].Len() > 0 && r.lists[arcT1].Len() >= max(r.p, 1) {
+		first, second = arcT1, arcT2
+	}
+	for _, where := range []int{first, second} {
+		for elem := r.lists[where].Front(); elem != nil; elem = elem.Next() {
+			entry := elem.Value.(*arcEntry)
+			if !entry.evictable {
+				continue
+			}
+			entry.evictable = false
+			r.evictable--
+			// 淘汰的页面进入对应的幽灵列表
+			r.moveTo(entry, where+2)
+			if r.lists[arcB1].Len()+r.lists[arcB2].Len() > r.capacity {
+				if r.lists[arcB1].Len() > r.lists[arcB2].Len() {
+					r.dropGhost(arcB1)
+				} else {
+					r.dropGhost(arcB2)
+				}
+			}
+			return entry.pageID, true
+		}
+	}
+	return 0, false
+}
+
+// 淘汰后还在幽灵列表中的页面回到原来的驻留列表头部，不调整目标大小
+func (r *ARCReplacer) Restore(pageID uint32) {
+	entry, ok := r.entries[pageID]
+	if !ok {
+		entry = &arcEntry{pageID: pageID, where: arcT1}
+		entry.elem = r.lists[arcT1].PushFront(entry)
+		r.entries[pageID] = entry
+	} else if entry.where > arcT2 {
+		r.lists[entry.where].Remove(entry.elem)
+		entry.where -= 2
+		entry.elem = r.lists[entry.where].PushFront(entry)
+	}
+	r.SetEvictable(pageID, true)
+}
+
+func (r *ARCReplacer) Remove(pageID uint32) {
+	entry, ok := r.entries[pageID]
+	if !ok {
+		return
+	}
+	if entry.evictable {
+		r.evictable--
+	}
+	r.lists[entry.where].Remove(entry.elem)
+	delete(r.entries, pageID)
+}
+
+func (r *ARCReplacer) Size() int {
+	return r.evictable
+}
+
+func (r *ARCReplacer) Policy() Policy {
+	return PolicyARC
+}
+
+// 获取T1的目标大小
+func (r *ARCReplacer) GetTarget() int {
+	return r.p
+}
+
+func (r *ARCReplacer) moveTo(entry *arcEntry, where int) {
+	r.lists[entry.where].Remove(entry.elem)
+	entry.where = where
+	entry.elem = r.lists[where].PushBack(entry)
+}
+
+func (r *ARCReplacer) dropGhost(where int) {
+	elem := r.lists[where].Front()
+	entry := elem.Value.(*arcEntry)
+	r.lists[where].Remove(elem)
+	delete(r.entries, entry.pageID)
+}
+
+func (r *ARCReplacer) totalLen() int {
+	n := 0
+	for _, l := range r.lists {
+		n += l.Len()
+	}
+	return n
+}
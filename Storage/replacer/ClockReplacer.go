@@ -0,0 +1,121 @@
+package replacer
+
+type clockSlot struct {
+	pageID     uint32
+	used       bool // 槽位是否被占用
+	referenced bool // 引用位
+	evictable  bool
+}
+
+// 时钟置换器，页面访问时设置引用位，指针扫过时清除引用位，淘汰引用位为0的页面
+type ClockReplacer struct {
+	slots     []clockSlot
+	slotOf    map[uint32]int
+	freeSlots []int
+	hand      int
+	evictable int
+}
+
+func NewClockReplacer(capacity int) *ClockReplacer {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	r := &ClockReplacer{
+		slots:     make([]clockSlot, capacity),
+		slotOf:    make(map[uint32]int, capacity),
+		freeSlots: make([]int, 0, capacity),
+	}
+	for i := capacity - 1; i >= 0; i-- {
+		r.freeSlots = append(r.freeSlots, i)
+	}
+	return r
+}
+
+func (r *ClockReplacer) RecordAccess(pageID uint32) {
+	if idx, ok := r.slotOf[pageID]; ok {
+		r.slots[idx].referenced = true
+		return
+	}
+	r.slots[r.addSlot(pageID)].referenced = true
+}
+
+func (r *ClockReplacer) SetEvictable(pageID uint32, evictable bool) {
+	idx, ok := r.slotOf[pageID]
+	if !ok || r.slots[idx].evictable == evictable {
+		return
+	}
+	r.slots[idx].evictable = evictable
+	if evictable {
+		r.evictable++
+	} else {
+		r.evictable--
+	}
+}
+
+func (r *ClockReplacer) Evict() (uint32, bool) {
+	if r.evictable == 0 {
+		return 0, false
+	}
+	// 最多转两圈：第一圈清除引用位，第二圈一定能找到
+	for i := 0; i < 2*len(r.slots); i++ {
+		slot := &r.slots[r.hand]
+		idx := r.hand
+		r.hand = (r.hand + 1) % len(r.slots)
+		if !slot.used || !slot.evictable {
+			continue
+		}
+		if slot.referenced {
+			slot.referenced = false
+			continue
+		}
+		pageID := slot.pageID
+		r.removeSlot(idx)
+		return pageID, true
+	}
+	return 0, false
+}
+
+// 放回时不设置引用位，指针退回到它的槽位，下一次仍然淘汰它
+func (r *ClockReplacer) Restore(pageID uint32) {
+	if _, ok := r.slotOf[pageID]; !ok {
+		r.hand = r.addSlot(pageID)
+	}
+	r.SetEvictable(pageID, true)
+}
+
+func (r *ClockReplacer) Remove(pageID uint32) {
+	if idx, ok := r.slotOf[pageID]; ok {
+		r.removeSlot(idx)
+	}
+}
+
+func (r *ClockReplacer) Size() int {
+	return r.evictable
+}
+
+func (r *ClockReplacer) Policy() Policy {
+	return PolicyClock
+}
+
+func (r *ClockReplacer) addSlot(pageID uint32) int {
+	if len(r.freeSlots) == 0 {
+		// 跟踪的页面数超过容量时扩容，正常情况下不会发生
+		r.slots = append(r.slots, clockSlot{})
+		r.freeSlots = append(r.freeSlots, len(r.slots)-1)
+	}
+	idx := r.freeSlots[len(r.freeSlots)-1]
+	r.freeSlots = r.freeSlots[:len(r.freeSlots)-1]
+	r.slots[idx] = clockSlot{pageID: pageID, used: true}
+	r.slotOf[pageID] = idx
+	return idx
+}
+
+func (r *ClockReplacer) removeSlot(idx int) {
+	slot := &r.slots[idx]
+	if slot.evictable {
+		r.evictable--
+	}
+	delete(r.slotOf, slot.pageID)
+	*slot = clockSlot{}
+	r.freeSlots = append(r.freeSlots, idx)
+}
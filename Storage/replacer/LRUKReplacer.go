@@ -0,0 +1,118 @@
+package replacer
+
+import "math"
+
+type lruKEntry struct {
+	history   []uint64 // 最近K次访问的逻辑时间，最早的在前
+	evictable bool
+}
+
+// LRU-K置换器，淘汰后向K距离最大的页面
+// 访问次数不足K次的页面K距离视为无穷大，它们之间按最早访问时间淘汰
+type LRUKReplacer struct {
+	k         int
+	clock     uint64
+	entries   map[uint32]*lruKEntry
+	evictable int
+
+	// 最后淘汰的页面和它的访问历史，淘汰失败放回时恢复
+	lastEvicted      uint32
+	lastEvictedEntry *lruKEntry
+}
+
+func NewLRUKReplacer(k int) *LRUKReplacer {
+	if k <= 0 {
+		k = DefaultK
+	}
+	return &LRUKReplacer{
+		k:       k,
+		entries: make(map[uint32]*lruKEntry),
+	}
+}
+
+func (r *LRUKReplacer) RecordAccess(pageID uint32) {
+	r.clock++
+	entry, ok := r.entries[pageID]
+	if !ok {
+		entry = &lruKEntry{history: make([]uint64, 0, r.k)}
+		r.entries[pageID] = entry
+	}
+	if len(entry.history) == r.k {
+		entry.history = entry.history[1:]
+	}
+	entry.history = append(entry.history, r.clock)
+}
+
+func (r *LRUKReplacer) SetEvictable(pageID uint32, evictable bool) {
+	entry, ok := r.entries[pageID]
+	if !ok || entry.evictable == evictable {
+		return
+	}
+	entry.evictable = evictable
+	if evictable {
+		r.evictable++
+	} else {
+		r.evictable--
+	}
+}
+
+func (r *LRUKReplacer) Evict() (uint32, bool) {
+	var (
+		victim       uint32
+		found        bool
+		bestDistance uint64
+		bestEarliest uint64
+	)
+	for pageID, entry := range r.entries {
+		if !entry.evictable {
+			continue
+		}
+		distance := uint64(math.MaxUint64)
+		if len(entry.history) == r.k {
+			distance = r.clock - entry.history[0]
+		}
+		earliest := entry.history[0]
+		if !found || distance > bestDistance || (distance == bestDistance && earliest < bestEarliest) {
+			victim, found = pageID, true
+			bestDistance, bestEarliest = distance, earliest
+		}
+	}
+	if found {
+		r.lastEvicted, r.lastEvictedEntry = victim, r.entries[victim]
+		r.Remove(victim)
+	}
+	return victim, found
+}
+
+// 放回最后淘汰的页面时恢复它的访问历史，其他页面当作最早访问过一次
+func (r *LRUKReplacer) Restore(pageID uint32) {
+	if _, ok := r.entries[pageID]; !ok {
+		entry := &lruKEntry{history: []uint64{0}}
+		if r.lastEvictedEntry != nil && r.lastEvicted == pageID {
+			entry = r.lastEvictedEntry
+		}
+		entry.evictable = false
+		r.entries[pageID] = entry
+	}
+	r.lastEvictedEntry = nil
+	r.SetEvictable(pageID, true)
+}
+
+func (r *LRUKReplacer) Remove(pageID uint32) {
+	entry, ok := r.entries[pageID]
+	if !ok {
+		return
+	}
+	if entry.evictable {
+		r.evictable--
+	}
+	delete(r.entries, pageID)
+}
+
+func (r *LRUKReplacer) Size() int {
+	return r.evictable
+}
+
+func (r *LRUKReplacer) Policy() Policy {
+	return PolicyLRUK
+}
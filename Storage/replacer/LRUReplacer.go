@@ -0,0 +1,91 @@
+package replacer
+
+import "container/list"
+
+type lruEntry struct {
+	pageID    uint32
+	evictable bool
+}
+
+// 最近最少使用置换器
+type LRUReplacer struct {
+	list      *list.List // 队头最久未访问
+	entries   map[uint32]*list.Element
+	evictable int
+}
+
+func NewLRUReplacer() *LRUReplacer {
+	return &LRUReplacer{
+		list:    list.New(),
+		entries: make(map[uint32]*list.Element),
+	}
+}
+
+func (r *LRUReplacer) RecordAccess(pageID uint32) {
+	if elem, ok := r.entries[pageID]; ok {
+		r.list.MoveToBack(elem)
+		return
+	}
+	r.entries[pageID] = r.list.PushBack(&lruEntry{pageID: pageID})
+}
+
+func (r *LRUReplacer) SetEvictable(pageID uint32, evictable bool) {
+	elem, ok := r.entries[pageID]
+	if !ok {
+		return
+	}
+	entry := elem.Value.(*lruEntry)
+	if entry.evictable == evictable {
+		return
+	}
+	entry.evictable = evictable
+	if evictable {
+		r.evictable++
+	} else {
+		r.evictable--
+	}
+}
+
+func (r *LRUReplacer) Evict() (uint32, bool) {
+	for elem := r.list.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*lruEntry)
+		if entry.evictable {
+			r.remove(elem)
+			return entry.pageID, true
+		}
+	}
+	return 0, false
+}
+
+// 放回队头，保持它最久未访问的位置
+func (r *LRUReplacer) Restore(pageID uint32) {
+	if _, ok := r.entries[pageID]; ok {
+		r.SetEvictable(pageID, true)
+		return
+	}
+	r.entries[pageID] = r.list.PushFront(&lruEntry{pageID: pageID, evictable: true})
+	r.evictable++
+}
+
+func (r *LRUReplacer) Remove(pageID uint32) {
+	if elem, ok := r.entries[pageID]; ok {
+		r.remove(elem)
+	}
+}
+
+func (r *LRUReplacer) Size() int {
+	return r.evictable
+}
+
+func (r *LRUReplacer) Policy() Policy {
+	return PolicyLRU
+}
+
+func (r *LRUReplacer) remove(elem *list.Element) {
+	entry := elem.Value.(*lruEntry)
+	if entry.evictable {
+		r.evictable--
+	}
+	r.list.Remove(elem)
+	delete(r.entries, entry.pageID)
+}
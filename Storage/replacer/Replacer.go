@@ -0,0 +1,43 @@
+package replacer
+
+import "fmt"
+
+// 页面置换策略
+type Policy string
+
+const (
+	PolicyLRU   Policy = "LRU"
+	PolicyClock Policy = "CLOCK"
+	PolicyLRUK  Policy = "LRU-K"
+	PolicyARC   Policy = "ARC"
+
+	DefaultK = 2 // LRU-K 默认的K值
+)
+
+// 页面置换器，按页ID跟踪缓冲池中的页面
+// 被固定的页面不可淘汰，只有SetEvictable(true)之后才会被Evict选中
+type Replacer interface {
+	RecordAccess(pageID uint32)                 // 记录一次访问（命中或从磁盘载入）
+	SetEvictable(pageID uint32, evictable bool) // 设置页面是否可被淘汰
+	Evict() (uint32, bool)                      // 选出一个页面淘汰
+	Restore(pageID uint32)                      // 淘汰失败时放回页面，仍可淘汰，不算作一次访问
+	Remove(pageID uint32)                       // 页面被删除，不再跟踪
+	Size() int                                  // 可淘汰的页面数
+	Policy() Policy
+}
+
+// 根据策略创建置换器，capacity为缓冲池帧数
+func NewReplacer(policy Policy, capacity int) (Replacer, error) {
+	switch policy {
+	case PolicyLRU, "":
+		return NewLRUReplacer(), nil
+	case PolicyClock:
+		return NewClockReplacer(capacity), nil
+	case PolicyLRUK:
+		return NewLRUKReplacer(DefaultK), nil
+	case PolicyARC:
+		return NewARCReplacer(capacity), nil
+	default:
+		return nil, fmt.Errorf("未知的页面置换策略: %s", policy)
+	}
+}
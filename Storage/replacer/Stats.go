@@ -0,0 +1,55 @@
+package replacer
+
+import "fmt"
+
+// 缓冲池的命中、未命中和淘汰计数
+type Stats struct {
+	Policy    Policy
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// 命中率
+func (s Stats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%s: hits=%d, misses=%d, evictions=%d, hitRate=%.4f",
+		s.Policy, s.Hits, s.Misses, s.Evictions, s.HitRate())
+}
+
+// 用页ID访问序列模拟一个容量为capacity的缓冲池，便于在自己的访问轨迹上比较各策略
+// 模拟中每次访问后页面立即释放，即所有驻留页面都可淘汰
+func Replay(policy Policy, capacity int, trace []uint32) (Stats, error) {
+	r, err := NewReplacer(policy, capacity)
+	if err != nil {
+		return Stats{}, err
+	}
+	stats := Stats{Policy: r.Policy()}
+	resident := make(map[uint32]bool, capacity)
+	for _, pageID := range trace {
+		if resident[pageID] {
+			stats.Hits++
+		} else {
+			stats.Misses++
+			if len(resident) >= capacity {
+				victim, ok := r.Evict()
+				if !ok {
+					return stats, fmt.Errorf("没有可淘汰的页面")
+				}
+				delete(resident, victim)
+				stats.Evictions++
+			}
+			resident[pageID] = true
+		}
+		r.RecordAccess(pageID)
+		r.SetEvictable(pageID, true)
+	}
+	return stats, nil
+}
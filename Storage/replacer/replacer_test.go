@@ -0,0 +1,151 @@
+package replacer
+
+import "testing"
+
+// 依次访问并释放页面
+func accessAll(r Replacer, pageIDs ...uint32) {
+	for _, pageID := range pageIDs {
+		r.RecordAccess(pageID)
+		r.SetEvictable(pageID, true)
+	}
+}
+
+func TestLRUReplacer_Evict(t *testing.T) {
+	r := NewLRUReplacer()
+	accessAll(r, 1, 2, 3)
+	r.RecordAccess(1) // 1变为最近访问
+
+	if victim, ok := r.Evict(); !ok || victim != 2 {
+		t.Errorf("期望淘汰 2, 实际 %d", victim)
+	}
+	r.SetEvictable(3, false)
+	if victim, ok := r.Evict(); !ok || victim != 1 {
+		t.Errorf("被固定的页面不应被淘汰, 期望 1, 实际 %d", victim)
+	}
+	if _, ok := r.Evict(); ok {
+		t.Error("没有可淘汰的页面时应返回false")
+	}
+	if r.Size() != 0 {
+		t.Errorf("可淘汰页面数不正确: %d", r.Size())
+	}
+}
+
+func TestClockReplacer_SecondChance(t *testing.T) {
+	r := NewClockReplacer(3)
+	accessAll(r, 1, 2, 3)
+
+	// 第一圈清除所有引用位，第二圈淘汰1
+	if victim, ok := r.Evict(); !ok || victim != 1 {
+		t.Errorf("期望淘汰 1, 实际 %d", victim)
+	}
+	// 2再次被访问，获得第二次机会
+	r.RecordAccess(2)
+	accessAll(r, 4)
+	if victim, ok := r.Evict(); !ok || victim != 3 {
+		t.Errorf("期望淘汰 3, 实际 %d", victim)
+	}
+}
+
+func TestLRUKReplacer_Evict(t *testing.T) {
+	r := NewLRUKReplacer(2)
+	accessAll(r, 1, 2, 3, 1, 2)
+
+	// 3只访问过一次，K距离为无穷大，优先淘汰
+	if victim, ok := r.Evict(); !ok || victim != 3 {
+		t.Errorf("期望淘汰 3, 实际 %d", victim)
+	}
+	// 1的倒数第二次访问早于2
+	if victim, ok := r.Evict(); !ok || victim != 1 {
+		t.Errorf("期望淘汰 1, 实际 %d", victim)
+	}
+}
+
+func TestARCReplacer_GhostHit(t *testing.T) {
+	r := NewARCReplacer(2)
+	accessAll(r, 1, 2)
+	if victim, ok := r.Evict(); !ok || victim != 1 {
+		t.Fatalf("期望淘汰 1, 实际 %d", victim)
+	}
+	// 1在B1中，再次访问时增大T1的目标大小
+	accessAll(r, 1)
+	if r.GetTarget() != 1 {
+		t.Errorf("幽灵命中后目标大小不正确: %d", r.GetTarget())
+	}
+	if r.Size() != 2 {
+		t.Errorf("可淘汰页面数不正确: %d", r.Size())
+	}
+}
+
+// 淘汰失败放回的页面仍然是下一个淘汰对象，放回不算访问
+func TestReplacer_Restore(t *testing.T) {
+	for _, policy := range []Policy{PolicyLRU, PolicyClock, PolicyLRUK, PolicyARC} {
+		r, _ := NewReplacer(policy, 4)
+		accessAll(r, 1, 2, 3, 2, 3)
+		victim, ok := r.Evict()
+		if !ok || victim != 1 {
+			t.Fatalf("%s 期望淘汰 1, 实际 %d", policy, victim)
+		}
+		r.Restore(victim)
+		if r.Size() != 3 {
+			t.Errorf("%s 放回后可淘汰页面数不正确: %d", policy, r.Size())
+		}
+		if victim, ok := r.Evict(); !ok || victim != 1 {
+			t.Errorf("%s 放回的页面应该再次被淘汰, 实际 %d", policy, victim)
+		}
+	}
+
+	// 放回不会把ARC的页面提升到T2，也不调整目标大小
+	r := NewARCReplacer(4)
+	accessAll(r, 1, 2, 2)
+	victim, _ := r.Evict()
+	r.Restore(victim)
+	if r.GetTarget() != 0 || r.lists[arcT1].Len() != 1 || r.lists[arcB1].Len() != 0 {
+		t.Errorf("放回后ARC的状态不正确: p=%d, T1=%d, B1=%d", r.GetTarget(), r.lists[arcT1].Len(), r.lists[arcB1].Len())
+	}
+
+	// LRU-K放回时保留原来的访问历史
+	k := NewLRUKReplacer(2)
+	accessAll(k, 1, 1, 2, 2)
+	victim, _ = k.Evict()
+	k.Restore(victim)
+	if len(k.entries[victim].history) != 2 || k.clock != 4 {
+		t.Errorf("放回后LRU-K的访问历史不正确: %v", k.entries[victim].history)
+	}
+}
+
+// 顺序扫描混合热点访问时，ARC和LRU-K的命中率不应低于LRU
+func TestReplay_ScanResistance(t *testing.T) {
+	var trace []uint32
+	for round := 0; round < 20; round++ {
+		for hot := uint32(0); hot < 4; hot++ {
+			trace = append(trace, hot, hot)
+		}
+		for scan := uint32(0); scan < 8; scan++ {
+			trace = append(trace, 100+uint32(round)*8+scan)
+		}
+	}
+
+	lru, err := Replay(PolicyLRU, 6, trace)
+	if err != nil {
+		t.Fatalf("模拟失败: %v", err)
+	}
+	for _, policy := range []Policy{PolicyClock, PolicyLRUK, PolicyARC} {
+		stats, err := Replay(policy, 6, trace)
+		if err != nil {
+			t.Fatalf("模拟失败: %v", err)
+		}
+		t.Log(stats)
+		if stats.Hits+stats.Misses != uint64(len(trace)) {
+			t.Errorf("%s 访问计数不正确", policy)
+		}
+		if policy != PolicyClock && stats.Hits < lru.Hits {
+			t.Errorf("%s 命中数低于LRU: %d < %d", policy, stats.Hits, lru.Hits)
+		}
+	}
+}
+
+func TestNewReplacer_UnknownPolicy(t *testing.T) {
+	if _, err := NewReplacer("MRU", 4); err == nil {
+		t.Error("未知策略应该返回错误")
+	}
+}
@@ -0,0 +1,296 @@
+package Transaction
+
+import (
+	"fmt"
+	"sync"
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// 死锁时被选为牺牲者的事务得到这个错误，事务已经回滚，可以重试
+const ErrDeadlock = Error("检测到死锁，事务被回滚")
+
+// 锁模式
+type LockMode uint8
+
+const (
+	LockShared    LockMode = 1 // 共享锁，读操作使用
+	LockExclusive LockMode = 2 // 排他锁，写操作使用
+)
+
+// 一个事务对一个资源的加锁请求
+type lockRequest struct {
+	transaction *Transaction
+	mode        LockMode
+	granted     bool
+}
+
+// 一个资源上的请求队列，按到达顺序授予
+type lockQueue struct {
+	requests  []*lockRequest
+	upgrading int32 // 正在从共享锁升级为排他锁的事务，0表示没有
+	cond      *sync.Cond
+}
+
+// 锁管理器：严格两阶段锁，锁一直持有到事务提交或中止时由UnlockAll释放。
+// 资源是记录的键或者由调用方约定的名字，同一个事务重复加锁不会阻塞。
+// 每次开始等待时在等待图中检测死锁，选出环中最年轻的事务作为牺牲者
+type LockManager struct {
+	mutex            sync.Mutex
+	lockTable        map[string]*lockQueue
+	transactionLocks map[int32]map[string]LockMode // 事务 -> 持有的锁
+	waiting          map[int32]*lockQueue          // 正在等待的事务 -> 等待的队列
+	victims          map[int32]bool                // 被选为死锁牺牲者还没有返回的事务
+}
+
+func NewLockManager() *LockManager {
+	return &LockManager{
+		lockTable:        make(map[string]*lockQueue),
+		transactionLocks: make(map[int32]map[string]LockMode),
+		waiting:          make(map[int32]*lockQueue),
+		victims:          make(map[int32]bool),
+	}
+}
+
+// 加锁，与其他事务持有的锁冲突时等待；已经持有共享锁时请求排他锁会升级
+func (lm *LockManager) Lock(transaction *Transaction, resource string, mode LockMode) error {
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+
+	if transaction.Status != Active {
+		return fmt.Errorf("事务 %d 已经结束，不能加锁", transaction.TransactionID)
+	}
+	held := lm.transactionLocks[transaction.TransactionID][resource]
+	if held >= mode {
+		return nil
+	}
+	queue := lm.getQueue(resource)
+	if held == LockShared {
+		return lm.upgrade(queue, transaction, resource)
+	}
+
+	request := &lockRequest{transaction: transaction, mode: mode}
+	queue.requests = append(queue.requests, request)
+	if err := lm.wait(queue, transaction, func() bool { return lm.grantable(queue, request) }); err != nil {
+		lm.removeRequest(queue, resource, request)
+		return err
+	}
+	request.granted = true
+	lm.addTransactionLock(transaction.TransactionID, resource, mode)
+	return nil
+}
+
+// 释放一个锁，只用于读已提交的短读锁；严格两阶段锁的锁由UnlockAll释放
+func (lm *LockManager) Unlock(transactionID int32, resource string) {
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+	lm.release(transactionID, resource)
+}
+
+// 事务结束时释放它持有的所有锁
+func (lm *LockManager) UnlockAll(transactionID int32) {
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+	for resource := range lm.transactionLocks[transactionID] {
+		lm.release(transactionID, resource)
+	}
+	delete(lm.transactionLocks, transactionID)
+}
+
+// 事务在资源上持有的锁，没有时返回0
+func (lm *LockManager) HeldMode(transactionID int32, resource string) LockMode {
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+	return lm.transactionLocks[transactionID][resource]
+}
+
+// 升级时保留共享锁，等其他持有者都释放后改为排他锁
+func (lm *LockManager) upgrade(queue *lockQueue, transaction *Transaction, resource string) error {
+	if queue.upgrading != 0 {
+		// 两个事务同时升级同一个资源一定会死锁
+		return ErrDeadlock
+	}
+	request := lm.findRequest(queue, transaction.TransactionID)
+	queue.upgrading = transaction.TransactionID
+	err := lm.wait(queue, transaction, func() bool { return lm.grantedCount(queue) == 1 })
+	queue.upgrading = 0
+	if err != nil {
+		// 升级失败时保留原来的共享锁
+		queue.cond.Broadcast()
+		return err
+	}
+	request.mode = LockExclusive
+	lm.addTransactionLock(transaction.TransactionID, resource, LockExclusive)
+	return nil
+}
+
+// 等待直到ready返回true，开始等待时检测死锁，被选为牺牲者时返回ErrDeadlock
+func (lm *LockManager) wait(queue *lockQueue, transaction *Transaction, ready func() bool) error {
+	if ready() {
+		return nil
+	}
+	transactionID := transaction.TransactionID
+	lm.waiting[transactionID] = queue
+	defer func() {
+		delete(lm.waiting, transactionID)
+		delete(lm.victims, transactionID)
+	}()
+
+	lm.detectDeadlock(transaction)
+	for !ready() {
+		if lm.victims[transactionID] {
+			return ErrDeadlock
+		}
+		queue.cond.Wait()
+	}
+	return nil
+}
+
+// 从开始等待的事务出发在等待图中找环，找到时把环中开始时间最晚的事务选为牺牲者并唤醒它
+func (lm *LockManager) detectDeadlock(transaction *Transaction) {
+	cycle := lm.findCycle(transaction, transaction, make(map[int32]bool))
+	if cycle == nil {
+		return
+	}
+	victim := cycle[0]
+	for _, member := range cycle[1:] {
+		if member.BeginTime.After(victim.BeginTime) ||
+			(member.BeginTime.Equal(victim.BeginTime) && member.TransactionID > victim.TransactionID) {
+			victim = member
+		}
+	}
+	lm.victims[victim.TransactionID] = true
+	lm.waiting[victim.TransactionID].cond.Broadcast()
+}
+
+// 深度优先搜索从current回到start的路径，返回路径上的事务
+func (lm *LockManager) findCycle(start, current *Transaction, visited map[int32]bool) []*Transaction {
+	visited[current.TransactionID] = true
+	for _, next := range lm.waitsFor(current.TransactionID) {
+		if next.TransactionID == start.TransactionID {
+			return []*Transaction{current}
+		}
+		if visited[next.TransactionID] || lm.victims[next.TransactionID] {
+			continue
+		}
+		if path := lm.findCycle(start, next, visited); path != nil {
+			return append(path, current)
+		}
+	}
+	return nil
+}
+
+// 等待图的边：事务在等待哪些事务，包括持有冲突锁的事务和排在它前面还没授予的请求
+func (lm *LockManager) waitsFor(transactionID int32) []*Transaction {
+	queue, ok := lm.waiting[transactionID]
+	if !ok {
+		return nil
+	}
+	var holders []*Transaction
+	if queue.upgrading == transactionID {
+		for _, other := range queue.requests {
+			if other.granted && other.transaction.TransactionID != transactionID {
+				holders = append(holders, other.transaction)
+			}
+		}
+		return holders
+	}
+	if queue.upgrading != 0 {
+		holders = append(holders, lm.findRequest(queue, queue.upgrading).transaction)
+	}
+	request := lm.findRequest(queue, transactionID)
+	for _, other := range queue.requests {
+		if other == request {
+			break
+		}
+		if !other.granted || other.mode == LockExclusive || request.mode == LockExclusive {
+			holders = append(holders, other.transaction)
+		}
+	}
+	return holders
+}
+
+// 前面的请求都已授予，并且与所有已授予的锁兼容时才能授予，避免排他锁饿死
+func (lm *LockManager) grantable(queue *lockQueue, request *lockRequest) bool {
+	if queue.upgrading != 0 {
+		return false
+	}
+	for _, other := range queue.requests {
+		if other == request {
+			return true
+		}
+		if !other.granted || other.mode == LockExclusive || request.mode == LockExclusive {
+			return false
+		}
+	}
+	return false
+}
+
+func (lm *LockManager) grantedCount(queue *lockQueue) int {
+	count := 0
+	for _, request := range queue.requests {
+		if request.granted {
+			count++
+		}
+	}
+	return count
+}
+
+func (lm *LockManager) findRequest(queue *lockQueue, transactionID int32) *lockRequest {
+	for _, request := range queue.requests {
+		if request.transaction.TransactionID == transactionID {
+			return request
+		}
+	}
+	return nil
+}
+
+func (lm *LockManager) getQueue(resource string) *lockQueue {
+	queue, ok := lm.lockTable[resource]
+	if !ok {
+		queue = &lockQueue{cond: sync.NewCond(&lm.mutex)}
+		lm.lockTable[resource] = queue
+	}
+	return queue
+}
+
+func (lm *LockManager) addTransactionLock(transactionID int32, resource string, mode LockMode) {
+	locks, ok := lm.transactionLocks[transactionID]
+	if !ok {
+		locks = make(map[string]LockMode)
+		lm.transactionLocks[transactionID] = locks
+	}
+	locks[resource] = mode
+}
+
+// 释放事务在资源上的锁
+func (lm *LockManager) release(transactionID int32, resource string) {
+	if locks, ok := lm.transactionLocks[transactionID]; ok {
+		delete(locks, resource)
+	}
+	queue, ok := lm.lockTable[resource]
+	if !ok {
+		return
+	}
+	if request := lm.findRequest(queue, transactionID); request != nil {
+		lm.removeRequest(queue, resource, request)
+	}
+}
+
+// 从队列中删除请求并唤醒等待者，队列为空时删除
+func (lm *LockManager) removeRequest(queue *lockQueue, resource string, request *lockRequest) {
+	for i, other := range queue.requests {
+		if other == request {
+			queue.requests = append(queue.requests[:i], queue.requests[i+1:]...)
+			break
+		}
+	}
+	if len(queue.requests) == 0 {
+		delete(lm.lockTable, resource)
+	}
+	queue.cond.Broadcast()
+}
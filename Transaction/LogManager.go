@@ -1,48 +1,347 @@
 package Transaction
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
 	"sync"
+	"unsafe"
 	"wudb/Util"
 )
 
+// 日志文件头 24Byte，BaseLSN是文件中第一条日志的LSN，CheckpointLSN是最后一个检查点
+type LogFileHeader struct {
+	Magic         uint32
+	Version       uint32
+	BaseLSN       uint64
+	CheckpointLSN uint64
+}
+
+const (
+	LogFileMagic      = 0x57414C31 // "WAL1"
+	LogFileVersion    = 2          // 版本2的LSN是64位的
+	LogFileHeaderSize = uint32(unsafe.Sizeof(LogFileHeader{}))
+	FirstLSN          = 1 // LSN为0表示没有日志
+	LogFileSuffix     = ".log"
+	LogBufferSize     = 1 << 20 // 缓冲区超过这个大小时写入磁盘，长事务的日志不会一直占用内存
+)
+
+// 预写日志：记录先追加到内存缓冲区，Flush时写入文件并同步到磁盘
+// LSN是日志在整个日志流中的字节位置，所以单调递增，并且可以直接定位到记录
+// LSN是64位的，截断日志不会重用LSN，32位的LSN在写入4GB日志后就会用完
 type LogManager struct {
-	transactionLogs map[int32]*TransactionLog
-	mutex           sync.Mutex
-	fileHandle      *Util.FileHandle
+	mutex         sync.Mutex
+	fileHandle    *Util.FileHandle
+	baseLSN       uint64 // 文件中第一条日志的LSN
+	nextLSN       uint64 // 下一条日志的LSN
+	flushedLSN    uint64 // 小于它的日志都已经写入磁盘
+	checkpointLSN uint64 // 最后一个检查点，0表示没有
+	buffer        []byte // 还没写入磁盘的日志
 }
 
 func NewLogManager(logFileName string) *LogManager {
-	fileHandle, err := Util.NewFileHandleWithCreate(logFileName)
+	lm, err := OpenLogManager(logFileName)
 	if err != nil {
 		panic(err)
 	}
-	return &LogManager{
-		transactionLogs: make(map[int32]*TransactionLog),
-		mutex:           sync.Mutex{},
-		fileHandle:      fileHandle,
+	return lm
+}
+
+// 打开日志文件，文件不存在时创建；末尾不完整或校验失败的记录会被截掉
+func OpenLogManager(logFileName string) (*LogManager, error) {
+	fileHandle, err := Util.NewFileHandleWithCreate(logFileName)
+	if err != nil {
+		return nil, err
+	}
+	lm := &LogManager{fileHandle: fileHandle}
+
+	header := LogFileHeader{}
+	if fileHandle.GetFileSize() == 0 {
+		header = LogFileHeader{Magic: LogFileMagic, Version: LogFileVersion, BaseLSN: FirstLSN}
+		if err := lm.writeFileHeader(&header); err != nil {
+			fileHandle.Close()
+			return nil, err
+		}
+	} else {
+		data, err := fileHandle.ReadAt(0, int64(LogFileHeaderSize))
+		if err != nil {
+			fileHandle.Close()
+			return nil, fmt.Errorf("读取日志文件头失败: %v", err)
+		}
+		if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &header); err != nil {
+			fileHandle.Close()
+			return nil, fmt.Errorf("解析日志文件头失败: %v", err)
+		}
+		if header.Magic != LogFileMagic {
+			fileHandle.Close()
+			return nil, fmt.Errorf("日志文件魔数错误: %x", header.Magic)
+		}
+		if header.Version != LogFileVersion {
+			fileHandle.Close()
+			return nil, fmt.Errorf("不支持的日志文件版本: %d", header.Version)
+		}
+	}
+	lm.baseLSN = header.BaseLSN
+	lm.nextLSN = header.BaseLSN
+	lm.checkpointLSN = header.CheckpointLSN
+
+	// 找到最后一条完整的日志
+	for {
+		record, err := lm.readRecord(lm.nextLSN)
+		if err != nil {
+			break
+		}
+		lm.nextLSN += uint64(record.Size())
+	}
+	if err := fileHandle.GetFile().Truncate(lm.fileOffset(lm.nextLSN)); err != nil {
+		fileHandle.Close()
+		return nil, fmt.Errorf("截断日志文件失败: %v", err)
+	}
+	lm.flushedLSN = lm.nextLSN
+	return lm, nil
+}
+
+// 追加一条日志，返回分配的LSN，此时日志还在内存中
+func (lm *LogManager) Append(record *LogRecord) (uint64, error) {
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+
+	if lm.nextLSN+uint64(record.Size()) < lm.nextLSN {
+		return 0, fmt.Errorf("日志空间已用完")
+	}
+	record.LSN = lm.nextLSN
+	data, err := record.SerializeTo()
+	if err != nil {
+		return 0, err
+	}
+	lm.buffer = append(lm.buffer, data...)
+	lm.nextLSN += uint64(len(data))
+	if len(lm.buffer) >= LogBufferSize {
+		if err := lm.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return record.LSN, nil
+}
+
+// 确保LSN及之前的日志都已写入磁盘
+func (lm *LogManager) Flush(lsn uint64) error {
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+
+	if lsn < lm.flushedLSN || len(lm.buffer) == 0 {
+		return nil
+	}
+	return lm.flush()
+}
+
+// 把缓冲区写入文件并同步到磁盘，调用方持有mutex
+func (lm *LogManager) flush() error {
+	if _, err := lm.fileHandle.WriteAt(lm.fileOffset(lm.flushedLSN), lm.buffer); err != nil {
+		return fmt.Errorf("写入日志失败: %v", err)
+	}
+	if err := lm.fileHandle.GetFile().Sync(); err != nil {
+		return fmt.Errorf("同步日志失败: %v", err)
 	}
+	lm.flushedLSN = lm.nextLSN
+	lm.buffer = lm.buffer[:0]
+	return nil
+}
 
+// 把缓冲区中的日志全部写入磁盘
+func (lm *LogManager) FlushAll() error {
+	return lm.Flush(lm.GetNextLSN())
 }
 
-func (lm *LogManager) AddLog(log *TransactionLog) {
+// 读取指定LSN的日志
+func (lm *LogManager) ReadRecord(lsn uint64) (*LogRecord, error) {
 	lm.mutex.Lock()
 	defer lm.mutex.Unlock()
-	lm.transactionLogs[log.TransactionID] = log
+	if lsn < lm.baseLSN || lsn >= lm.nextLSN {
+		return nil, fmt.Errorf("LSN %d 超出日志范围 [%d, %d)", lsn, lm.baseLSN, lm.nextLSN)
+	}
+	return lm.readRecord(lsn)
 }
 
-func (lm *LogManager) WriteTransactionLog(log *TransactionLog) {
-	lm.fileHandle.Write([]byte(log.Output()))
-	lm.fileHandle.Write([]byte("\n"))
-	for _, operation := range log.Operations {
-		lm.fileHandle.Write([]byte(operation.Output()))
-		lm.fileHandle.Write([]byte("\n"))
+// 从fromLSN开始按顺序遍历日志
+func (lm *LogManager) Scan(fromLSN uint64, fn func(record *LogRecord) error) error {
+	if fromLSN < lm.GetBaseLSN() {
+		fromLSN = lm.GetBaseLSN()
+	}
+	for lsn := fromLSN; lsn < lm.GetNextLSN(); {
+		record, err := lm.ReadRecord(lsn)
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+		lsn += uint64(record.Size())
 	}
+	return nil
 }
 
-func (lm *LogManager) Undo(log *TransactionLog) {
+func (lm *LogManager) GetBaseLSN() uint64 {
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+	return lm.baseLSN
+}
 
+func (lm *LogManager) GetNextLSN() uint64 {
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+	return lm.nextLSN
 }
 
-func (lm *LogManager) Rollback(log *TransactionLog) {
+func (lm *LogManager) GetFlushedLSN() uint64 {
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+	return lm.flushedLSN
+}
 
+func (lm *LogManager) GetCheckpointLSN() uint64 {
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+	return lm.checkpointLSN
+}
+
+// 记录最后一个检查点，检查点日志必须已经写入磁盘
+func (lm *LogManager) SetCheckpointLSN(lsn uint64) error {
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+	if lsn < lm.baseLSN || lsn >= lm.flushedLSN {
+		return fmt.Errorf("检查点LSN %d 不在已写入磁盘的日志中", lsn)
+	}
+	header := LogFileHeader{Magic: LogFileMagic, Version: LogFileVersion, BaseLSN: lm.baseLSN, CheckpointLSN: lsn}
+	if err := lm.writeFileHeader(&header); err != nil {
+		return err
+	}
+	lm.checkpointLSN = lsn
+	return nil
+}
+
+// 丢弃LSN之前的日志，archive为true时旧日志文件保留为归档文件，否则删除
+// 新文件写完后用rename替换旧文件，任何时候崩溃都有一个完整的日志文件
+func (lm *LogManager) Truncate(lsn uint64, archive bool) error {
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+
+	if lsn <= lm.baseLSN {
+		return nil
+	}
+	if lsn > lm.flushedLSN || (lm.checkpointLSN != 0 && lsn > lm.checkpointLSN) {
+		return fmt.Errorf("不能截断还需要的日志: LSN %d", lsn)
+	}
+	fileName := lm.fileHandle.GetFile().Name()
+	tempName := fileName + ".tmp"
+	temp, err := os.OpenFile(tempName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("创建日志文件失败: %v", err)
+	}
+	header := LogFileHeader{Magic: LogFileMagic, Version: LogFileVersion, BaseLSN: lsn, CheckpointLSN: lm.checkpointLSN}
+	err = binary.Write(temp, binary.LittleEndian, &header)
+	if err == nil {
+		// 复制仍然需要的日志
+		reader := io.NewSectionReader(lm.fileHandle.GetFile(), lm.fileOffset(lsn), int64(lm.flushedLSN-lsn))
+		_, err = io.Copy(temp, reader)
+	}
+	if err == nil {
+		err = temp.Sync()
+	}
+	temp.Close()
+	if err != nil {
+		os.Remove(tempName)
+		return fmt.Errorf("复制日志失败: %v", err)
+	}
+
+	if archive {
+		archiveName := ArchiveLogFileName(fileName, lm.baseLSN)
+		// 上一次截断可能在归档之后失败了，那个归档就是当前的文件
+		os.Remove(archiveName)
+		if err := os.Link(fileName, archiveName); err != nil {
+			os.Remove(tempName)
+			return fmt.Errorf("归档日志失败: %v", err)
+		}
+	}
+	if err := os.Rename(tempName, fileName); err != nil {
+		return fmt.Errorf("替换日志文件失败: %v", err)
+	}
+	lm.fileHandle.Close()
+	fileHandle, err := Util.NewFileHandleWithCreate(fileName)
+	if err != nil {
+		return err
+	}
+	lm.fileHandle = fileHandle
+	lm.baseLSN = lsn
+	return nil
+}
+
+// 归档日志文件名，后缀是文件中第一条日志的LSN
+func ArchiveLogFileName(logFileName string, baseLSN uint64) string {
+	return fmt.Sprintf("%s.%020d", logFileName, baseLSN)
+}
+
+// 写入剩余的日志并关闭文件
+func (lm *LogManager) Close() error {
+	if err := lm.FlushAll(); err != nil {
+		return err
+	}
+	return lm.fileHandle.Close()
+}
+
+func (lm *LogManager) readRecord(lsn uint64) (*LogRecord, error) {
+	var data []byte
+	if lsn >= lm.flushedLSN && lm.flushedLSN != 0 {
+		// 还在缓冲区中
+		start := lsn - lm.flushedLSN
+		if start+uint64(LogRecordHeaderSize) > uint64(len(lm.buffer)) {
+			return nil, fmt.Errorf("LSN %d 不是一条日志的开始", lsn)
+		}
+		length := uint64(binary.LittleEndian.Uint32(lm.buffer[start : start+4]))
+		if length < uint64(LogRecordHeaderSize) || length > uint64(len(lm.buffer))-start {
+			return nil, fmt.Errorf("LSN %d 不是一条日志的开始", lsn)
+		}
+		// 复制一份，缓冲区写入磁盘后会被重用
+		data = append([]byte(nil), lm.buffer[start:start+length]...)
+	} else {
+		offset := lm.fileOffset(lsn)
+		header, err := lm.fileHandle.ReadAt(offset, int64(LogRecordHeaderSize))
+		if err != nil {
+			return nil, err
+		}
+		length := binary.LittleEndian.Uint32(header[0:4])
+		if length < LogRecordHeaderSize || int64(length) > lm.fileHandle.GetFileSize()-offset {
+			return nil, fmt.Errorf("LSN %d 的日志长度错误: %d", lsn, length)
+		}
+		if data, err = lm.fileHandle.ReadAt(offset, int64(length)); err != nil {
+			return nil, err
+		}
+	}
+
+	record := &LogRecord{}
+	if err := record.DeserializeFrom(data); err != nil {
+		return nil, err
+	}
+	if record.LSN != lsn {
+		return nil, fmt.Errorf("日志LSN不一致: 期望 %d, 实际 %d", lsn, record.LSN)
+	}
+	return record, nil
+}
+
+// LSN对应的文件偏移量
+func (lm *LogManager) fileOffset(lsn uint64) int64 {
+	return int64(LogFileHeaderSize) + int64(lsn-lm.baseLSN)
+}
+
+func (lm *LogManager) writeFileHeader(header *LogFileHeader) error {
+	buffer := new(bytes.Buffer)
+	if err := binary.Write(buffer, binary.LittleEndian, header); err != nil {
+		return fmt.Errorf("序列化日志文件头失败: %v", err)
+	}
+	if _, err := lm.fileHandle.WriteAt(0, buffer.Bytes()); err != nil {
+		return fmt.Errorf("写入日志文件头失败: %v", err)
+	}
+	return lm.fileHandle.GetFile().Sync()
 }
@@ -1,9 +1,7 @@
 package Transaction
 
 import (
-	"fmt"
 	"time"
-	"wudb/Entity/Record"
 )
 
 type Transaction struct {
@@ -13,22 +11,21 @@ type Transaction struct {
 	BeginTime         time.Time
 	EndTime           time.Time
 	Status            uint8
-	Operations        []Operation
-	TransactionLog    *TransactionLog
+	BeginLSN          uint64 // 事务第一条日志的LSN
+	LastLSN           uint64 // 事务最后一条日志的LSN
+	ReadTimestamp     uint32 // 事务开始时的快照，能看到提交时间戳不大于它的版本
+	CommitTimestamp   uint32 // 提交时间戳
+	savepoints        []savepoint
+	rollbackTo        func(transaction *Transaction, name string) error // 撤销保存点之后的操作，登记到事务管理器时取得
 }
 
-type Operation struct {
-	TransactionID int32
-	OperationType int32
-	PageID        int32
-	Record        *Record.Record
-	OldRecord     *Record.Record
+// 保存点，记下建立时事务的最后一条日志
+type savepoint struct {
+	name string
+	lsn  uint64
 }
 
 const (
-	InsertOperation = 0
-	DeleteOperation = 1
-	UpdateOperation = 2
 	Active          = 0
 	Committed       = 1
 	Aborted         = 2
@@ -38,6 +35,11 @@ const (
 	Serializable    = 3
 )
 
+const (
+	ErrSavepointNotFound = Error("保存点不存在")
+	ErrNotRegistered     = Error("事务没有登记到事务管理器，不能撤销操作")
+)
+
 func NewTransaction(transactionID int32, nextTransactionID int32, isolationLevel int32) *Transaction {
 	return &Transaction{
 		TransactionID:     transactionID,
@@ -45,16 +47,9 @@ func NewTransaction(transactionID int32, nextTransactionID int32, isolationLevel
 		IsolationLevel:    isolationLevel,
 		BeginTime:         time.Now(),
 		Status:            Active,
-		Operations:        make([]Operation, 0),
-		TransactionLog:    NewTransactionLog(transactionID, isolationLevel, time.Now()),
 	}
 }
 
-func (t *Transaction) AddOperation(operation Operation) {
-	t.Operations = append(t.Operations, operation)
-	t.TransactionLog.AddOperation(operation)
-}
-
 func (t *Transaction) SetEndTime(endTime time.Time) {
 	t.EndTime = endTime
 }
@@ -63,6 +58,57 @@ func (t *Transaction) SetStatus(status uint8) {
 	t.Status = status
 }
 
-func (op *Operation) Output() string {
-	return fmt.Sprintf("[%d] TransactionID: %d, OperationType: %d, PageID: %d, Record: %v, OldRecord: %v", time.Now().Unix(), op.TransactionID, op.OperationType, op.PageID, op.Record, op.OldRecord)
+// 建立保存点，同名的保存点已经存在时移到当前位置
+func (t *Transaction) Savepoint(name string) {
+	if i := t.findSavepoint(name); i >= 0 {
+		t.savepoints = append(t.savepoints[:i], t.savepoints[i+1:]...)
+	}
+	t.savepoints = append(t.savepoints, savepoint{name: name, lsn: t.LastLSN})
+}
+
+// 释放保存点和它之后建立的保存点，已经执行的操作不受影响
+func (t *Transaction) Release(name string) error {
+	i := t.findSavepoint(name)
+	if i < 0 {
+		return ErrSavepointNotFound
+	}
+	t.savepoints = t.savepoints[:i]
+	return nil
+}
+
+// 回滚到保存点：撤销保存点之后的操作并丢弃之后建立的保存点，保存点本身保留，事务继续活动。
+// 撤销由记录管理器沿日志完成；事务还没有登记时没有写过数据，只要修改保存点
+func (t *Transaction) RollbackTo(name string) error {
+	if t.rollbackTo != nil {
+		return t.rollbackTo(t, name)
+	}
+	i := t.findSavepoint(name)
+	if i < 0 {
+		return ErrSavepointNotFound
+	}
+	if t.savepoints[i].lsn != t.LastLSN {
+		return ErrNotRegistered
+	}
+	t.savepoints = t.savepoints[:i+1]
+	return nil
+}
+
+// 丢弃保存点之后建立的保存点，返回建立保存点时的最后一条日志。
+// 只修改保存点，不撤销操作，供记录管理器回滚到保存点时使用
+func (t *Transaction) RewindSavepoint(name string) (uint64, error) {
+	i := t.findSavepoint(name)
+	if i < 0 {
+		return 0, ErrSavepointNotFound
+	}
+	t.savepoints = t.savepoints[:i+1]
+	return t.savepoints[i].lsn, nil
+}
+
+func (t *Transaction) findSavepoint(name string) int {
+	for i := len(t.savepoints) - 1; i >= 0; i-- {
+		if t.savepoints[i].name == name {
+			return i
+		}
+	}
+	return -1
 }
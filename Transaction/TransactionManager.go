@@ -3,90 +3,332 @@ package Transaction
 import (
 	"fmt"
 	"sync"
+	"time"
 	"wudb/Util"
 )
 
+// 第一个事务ID，0表示不属于任何事务
+const FirstTransactionID = 1
+
 type TransactionManager struct {
 	TransactionMap    map[int32]*Transaction
 	mutex             sync.Mutex
 	nextTransactionID int32
+	saveNextID        func(nextTransactionID int32) error                       // 分配事务ID后保存计数器，为nil时不保存
+	rollbackTo        func(transaction *Transaction, name string) error         // 回滚到保存点时撤销操作，交给登记的事务
+	commitCheck       func(transaction *Transaction, commit func() error) error // 提交前的检查，通过后在同一个临界区中调用commit
+	onFinish          func(transaction *Transaction)                            // 事务提交或回滚之后调用，不持有mutex
 	logManager        *LogManager
+	lockManager       *LockManager
+	timestamp         uint32           // 逻辑时钟，每次提交加一
+	commitTimestamps  map[int32]uint32 // 已提交事务的提交时间戳，对所有快照可见后删除
 }
 
 func NewTransactionManager(logManager *LogManager) *TransactionManager {
 	return &TransactionManager{
-		TransactionMap: make(map[int32]*Transaction),
-		mutex:          sync.Mutex{},
-		logManager:     logManager,
+		TransactionMap:    make(map[int32]*Transaction),
+		mutex:             sync.Mutex{},
+		nextTransactionID: FirstTransactionID,
+		logManager:        logManager,
+		lockManager:       NewLockManager(),
+		timestamp:         1,
+		commitTimestamps:  make(map[int32]uint32),
 	}
 }
+
+// 日志文件和数据文件放在一起，文件名加上.log后缀
 func NewTransactionManagerWithHandle(fileHandle *Util.FileHandle) *TransactionManager {
-	return &TransactionManager{
-		TransactionMap: make(map[int32]*Transaction),
-		mutex:          sync.Mutex{},
-		logManager:     NewLogManager(fileHandle.FileID + ".log"),
+	return NewTransactionManager(NewLogManager(fileHandle.GetFile().Name() + LogFileSuffix))
+}
+
+// 获取日志管理器
+func (tm *TransactionManager) GetLogManager() *LogManager {
+	return tm.logManager
+}
+
+// 获取锁管理器
+func (tm *TransactionManager) GetLockManager() *LockManager {
+	return tm.lockManager
+}
+
+// 从持久化的计数器继续分配事务ID，save在每次分配后保存下一个ID
+func (tm *TransactionManager) SetNextTransactionID(nextTransactionID int32, save func(nextTransactionID int32) error) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	if nextTransactionID < FirstTransactionID {
+		nextTransactionID = FirstTransactionID
+	}
+	tm.nextTransactionID = nextTransactionID
+	tm.saveNextID = save
+}
+
+// 设置回滚到保存点时撤销操作的方法，之后登记的事务调用RollbackTo时使用它
+func (tm *TransactionManager) SetRollbackTo(rollbackTo func(transaction *Transaction, name string) error) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	tm.rollbackTo = rollbackTo
+}
+
+// 设置提交前的检查，例如可串行化事务的读写依赖检查。检查不通过时返回错误，事务不提交
+func (tm *TransactionManager) SetCommitCheck(check func(transaction *Transaction, commit func() error) error) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	tm.commitCheck = check
+}
+
+// 设置事务结束之后调用的方法，用来回收只有活动事务才需要的状态
+func (tm *TransactionManager) SetOnFinish(onFinish func(transaction *Transaction)) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	tm.onFinish = onFinish
+}
+
+// 获取下一个要分配的事务ID
+func (tm *TransactionManager) GetNextTransactionID() int32 {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	return tm.nextTransactionID
+}
+
+// 开始一个事务：分配新的事务ID，登记事务并取得快照
+func (tm *TransactionManager) Begin(isolationLevel int32) (*Transaction, error) {
+	tm.mutex.Lock()
+	transactionID := tm.nextTransactionID
+	tm.nextTransactionID++
+	transaction := NewTransaction(transactionID, tm.nextTransactionID, isolationLevel)
+	tm.registerTransaction(transaction)
+	save := tm.saveNextID
+	tm.mutex.Unlock()
+
+	// 保存计数器时可能要等写操作完成，写操作会用到mutex，所以不能持有它
+	if save != nil {
+		if err := save(transactionID + 1); err != nil {
+			tm.mutex.Lock()
+			delete(tm.TransactionMap, transactionID)
+			tm.mutex.Unlock()
+			return nil, fmt.Errorf("保存事务ID失败: %v", err)
+		}
 	}
+	return transaction, nil
 }
 
-func (tm *TransactionManager) AddTransaction(transaction *Transaction) {
+// 登记要写数据的事务，第一次写之前写入开始日志
+func (tm *TransactionManager) AddTransaction(transaction *Transaction) error {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
-	if _, ok := tm.TransactionMap[transaction.TransactionID]; !ok {
-		tm.TransactionMap[transaction.TransactionID] = transaction
+	transaction = tm.registerTransaction(transaction)
+	if transaction.LastLSN != 0 {
+		return nil
 	}
+	_, err := tm.appendLog(transaction, NewLogRecord(transaction.TransactionID, LogBegin))
+	return err
 }
 
-func (tm *TransactionManager) AddOperation(operation Operation) {
+// 登记只读的事务并取得快照，不写日志
+func (tm *TransactionManager) RegisterTransaction(transaction *Transaction) {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
-	transaction, ok := tm.TransactionMap[operation.TransactionID]
+	tm.registerTransaction(transaction)
+}
+
+// 读操作使用的快照：读已提交每次读都看最新提交的数据，其他级别使用事务开始时的快照
+func (tm *TransactionManager) Snapshot(transaction *Transaction) uint32 {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	transaction = tm.registerTransaction(transaction)
+	if transaction.IsolationLevel <= ReadCommitted {
+		return tm.timestamp
+	}
+	return transaction.ReadTimestamp
+}
+
+// 事务写入的数据对时间戳为timestamp的快照是否可见：事务必须在快照之前提交。
+// 不认识的事务是很早以前提交的，对所有快照可见；中止的事务也不在事务表中，但它写入的数据都已经撤销
+func (tm *TransactionManager) IsCommittedBefore(transactionID int32, timestamp uint32) bool {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	if transaction, ok := tm.TransactionMap[transactionID]; ok && transaction.Status != Committed {
+		return false
+	}
+	commitTimestamp, ok := tm.commitTimestamps[transactionID]
+	return !ok || commitTimestamp <= timestamp
+}
+
+// 活动事务中最早的快照，没有活动事务时返回当前时间戳。读已提交的快照只在一次读中使用，不计算在内
+func (tm *TransactionManager) OldestSnapshot() uint32 {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	oldest := tm.timestamp
+	for _, transaction := range tm.TransactionMap {
+		if transaction.Status == Active && transaction.IsolationLevel > ReadCommitted && transaction.ReadTimestamp < oldest {
+			oldest = transaction.ReadTimestamp
+		}
+	}
+	return oldest
+}
+
+// 删除不晚于timestamp的提交时间戳，这些事务已经对所有快照可见
+func (tm *TransactionManager) PruneCommitTimestamps(timestamp uint32) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	for transactionID, commitTimestamp := range tm.commitTimestamps {
+		if commitTimestamp <= timestamp {
+			delete(tm.commitTimestamps, transactionID)
+		}
+	}
+}
+
+// 恢复时登记没有完成的事务，不写开始日志
+func (tm *TransactionManager) RestoreTransaction(transaction *Transaction) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	tm.TransactionMap[transaction.TransactionID] = transaction
+}
+
+// 写入一条事务日志，PrevLSN指向事务的上一条日志
+func (tm *TransactionManager) WriteLog(record *LogRecord) (uint64, error) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	transaction, ok := tm.TransactionMap[record.TransactionID]
 	if !ok {
-		transaction = NewTransaction(operation.TransactionID, tm.nextTransactionID, ReadCommitted) //默认是读未提交
-		tm.TransactionMap[operation.TransactionID] = transaction
+		return 0, fmt.Errorf("事务不存在")
 	}
-	transaction.AddOperation(operation)
+	return tm.appendLog(transaction, record)
 }
 
+// 写入提交日志，日志落盘后事务才算提交，结束的事务从事务表中删除。
+// 设置了提交前的检查时所有提交都先经过检查
 func (tm *TransactionManager) Commit(transactionID int32) error {
 	tm.mutex.Lock()
-	defer tm.mutex.Unlock()
 	transaction, ok := tm.TransactionMap[transactionID]
+	check, onFinish := tm.commitCheck, tm.onFinish
+	tm.mutex.Unlock()
 	if !ok {
 		return fmt.Errorf("事务不存在")
 	}
-	transaction.Status = Committed
-	tm.logManager.WriteTransactionLog(transaction.TransactionLog)
-	return nil
+	commit := func() error { return tm.commit(transactionID) }
+	var err error
+	if check != nil {
+		err = check(transaction, commit)
+	} else {
+		err = commit()
+	}
+	if err == nil && onFinish != nil {
+		onFinish(transaction)
+	}
+	return err
 }
 
-func (tm *TransactionManager) Rollback(transactionID int32) error {
+func (tm *TransactionManager) commit(transactionID int32) error {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
 	transaction, ok := tm.TransactionMap[transactionID]
 	if !ok {
 		return fmt.Errorf("事务不存在")
 	}
-	transaction.Status = Aborted
+	// 只读的事务没有日志
+	if transaction.LastLSN != 0 {
+		lsn, err := tm.appendLog(transaction, NewLogRecord(transactionID, LogCommit))
+		if err != nil {
+			return err
+		}
+		if err := tm.logManager.Flush(lsn); err != nil {
+			return err
+		}
+	}
+	tm.timestamp++
+	transaction.CommitTimestamp = tm.timestamp
+	tm.commitTimestamps[transactionID] = tm.timestamp
+	tm.finish(transaction, Committed)
 	return nil
 }
 
-func (tm *TransactionManager) Undo(transactionID int32) error {
+// 回滚完成后写入中止日志并落盘，结束的事务从事务表中删除
+func (tm *TransactionManager) Rollback(transactionID int32) error {
+	tm.mutex.Lock()
+	transaction, onFinish := tm.TransactionMap[transactionID], tm.onFinish
+	tm.mutex.Unlock()
+	if err := tm.rollback(transactionID); err != nil {
+		return err
+	}
+	if onFinish != nil {
+		onFinish(transaction)
+	}
+	return nil
+}
+
+func (tm *TransactionManager) rollback(transactionID int32) error {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
 	transaction, ok := tm.TransactionMap[transactionID]
 	if !ok {
 		return fmt.Errorf("事务不存在")
 	}
-	tm.logManager.Undo(transaction.TransactionLog)
+	if transaction.LastLSN != 0 {
+		lsn, err := tm.appendLog(transaction, NewLogRecord(transactionID, LogAbort))
+		if err != nil {
+			return err
+		}
+		if err := tm.logManager.Flush(lsn); err != nil {
+			return err
+		}
+	}
+	tm.finish(transaction, Aborted)
+	return nil
+}
 
-	// 如果操作列表为空，直接返回
-	if len(transaction.Operations) == 0 {
-		return nil
+// 结束事务：记下结束时间，释放锁并从事务表中删除。
+// 中止的事务的修改都已经撤销，提交的事务的可见性由提交时间戳判断，删除后都不需要再查事务表
+func (tm *TransactionManager) finish(transaction *Transaction, status uint8) {
+	transaction.SetStatus(status)
+	transaction.SetEndTime(time.Now())
+	delete(tm.TransactionMap, transaction.TransactionID)
+	tm.lockManager.UnlockAll(transaction.TransactionID)
+}
+
+// 活动事务表，用于检查点
+func (tm *TransactionManager) ActiveTransactions() []CheckpointTransaction {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	var transactions []CheckpointTransaction
+	for _, transaction := range tm.TransactionMap {
+		if transaction.Status != Active || transaction.LastLSN == 0 {
+			continue
+		}
+		transactions = append(transactions, CheckpointTransaction{
+			TransactionID: transaction.TransactionID,
+			BeginLSN:      transaction.BeginLSN,
+			LastLSN:       transaction.LastLSN,
+		})
 	}
-	// 删除最后一个操作
-	newOperations := make([]Operation, len(transaction.Operations)-1)
-	copy(newOperations, transaction.Operations[:len(transaction.Operations)-1])
-	transaction.Operations = newOperations
+	return transactions
+}
 
-	return nil
+// 关闭日志文件
+func (tm *TransactionManager) Close() error {
+	return tm.logManager.Close()
+}
+
+// 第一次登记时取得快照；已经登记过时返回登记的事务
+func (tm *TransactionManager) registerTransaction(transaction *Transaction) *Transaction {
+	if registered, ok := tm.TransactionMap[transaction.TransactionID]; ok {
+		return registered
+	}
+	tm.TransactionMap[transaction.TransactionID] = transaction
+	transaction.ReadTimestamp = tm.timestamp
+	transaction.rollbackTo = tm.rollbackTo
+	return transaction
+}
+
+func (tm *TransactionManager) appendLog(transaction *Transaction, record *LogRecord) (uint64, error) {
+	record.PrevLSN = transaction.LastLSN
+	lsn, err := tm.logManager.Append(record)
+	if err != nil {
+		return 0, err
+	}
+	if transaction.BeginLSN == 0 {
+		transaction.BeginLSN = lsn
+	}
+	transaction.LastLSN = lsn
+	return lsn, nil
 }
@@ -0,0 +1,95 @@
+package Transaction
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// 检查点记录活动事务表和脏页表，不需要等待事务结束
+type Checkpoint struct {
+	Transactions []CheckpointTransaction
+	DirtyPages   map[uint32]uint64 // 页ID -> 第一次弄脏它、还没写回的日志LSN
+}
+
+// 检查点中的活动事务
+type CheckpointTransaction struct {
+	TransactionID int32
+	BeginLSN      uint64 // 事务的第一条日志，回滚需要从这里之后的日志
+	LastLSN       uint64 // 事务的最后一条日志
+}
+
+func NewCheckpoint() *Checkpoint {
+	return &Checkpoint{DirtyPages: make(map[uint32]uint64)}
+}
+
+// 生成检查点日志，检查点内容保存在After中
+func NewCheckpointLogRecord(checkpoint *Checkpoint) *LogRecord {
+	buffer := new(bytes.Buffer)
+	binary.Write(buffer, binary.LittleEndian, uint32(len(checkpoint.Transactions)))
+	for _, transaction := range checkpoint.Transactions {
+		binary.Write(buffer, binary.LittleEndian, transaction)
+	}
+	binary.Write(buffer, binary.LittleEndian, uint32(len(checkpoint.DirtyPages)))
+	for pageID, recLSN := range checkpoint.DirtyPages {
+		binary.Write(buffer, binary.LittleEndian, pageID)
+		binary.Write(buffer, binary.LittleEndian, recLSN)
+	}
+	record := NewLogRecord(0, LogCheckpoint)
+	record.After = buffer.Bytes()
+	return record
+}
+
+// 解析检查点日志
+func (lr *LogRecord) ParseCheckpoint() (*Checkpoint, error) {
+	if lr.Type != LogCheckpoint {
+		return nil, fmt.Errorf("LSN %d 不是检查点日志", lr.LSN)
+	}
+	reader := bytes.NewReader(lr.After)
+	checkpoint := NewCheckpoint()
+	var count uint32
+	if err := binary.Read(reader, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("解析检查点失败: %v", err)
+	}
+	checkpoint.Transactions = make([]CheckpointTransaction, count)
+	if err := binary.Read(reader, binary.LittleEndian, checkpoint.Transactions); err != nil {
+		return nil, fmt.Errorf("解析检查点失败: %v", err)
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("解析检查点失败: %v", err)
+	}
+	for i := uint32(0); i < count; i++ {
+		var pageID uint32
+		var recLSN uint64
+		if err := binary.Read(reader, binary.LittleEndian, &pageID); err != nil {
+			return nil, fmt.Errorf("解析检查点失败: %v", err)
+		}
+		if err := binary.Read(reader, binary.LittleEndian, &recLSN); err != nil {
+			return nil, fmt.Errorf("解析检查点失败: %v", err)
+		}
+		checkpoint.DirtyPages[pageID] = recLSN
+	}
+	return checkpoint, nil
+}
+
+// 重做的起点：脏页表中最小的LSN，没有脏页时从检查点开始
+func (cp *Checkpoint) RedoLSN(checkpointLSN uint64) uint64 {
+	redoLSN := checkpointLSN
+	for _, recLSN := range cp.DirtyPages {
+		if recLSN < redoLSN {
+			redoLSN = recLSN
+		}
+	}
+	return redoLSN
+}
+
+// 恢复还需要的最早的日志：重做的起点和活动事务的第一条日志
+func (cp *Checkpoint) OldestLSN(checkpointLSN uint64) uint64 {
+	oldestLSN := cp.RedoLSN(checkpointLSN)
+	for _, transaction := range cp.Transactions {
+		if transaction.BeginLSN != 0 && transaction.BeginLSN < oldestLSN {
+			oldestLSN = transaction.BeginLSN
+		}
+	}
+	return oldestLSN
+}
@@ -0,0 +1,137 @@
+package Transaction
+
+import (
+	"testing"
+	"time"
+)
+
+// 在后台加锁，返回加锁完成时关闭的通道
+func lockAsync(t *testing.T, lm *LockManager, transaction *Transaction, resource string, mode LockMode) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		if err := lm.Lock(transaction, resource, mode); err != nil {
+			t.Errorf("加锁失败: %v", err)
+		}
+		close(done)
+	}()
+	return done
+}
+
+// 检查通道在短时间内没有关闭，即加锁还在等待
+func expectBlocked(t *testing.T, done chan struct{}, message string) {
+	t.Helper()
+	select {
+	case <-done:
+		t.Fatal(message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// 检查通道很快关闭，即加锁成功
+func expectGranted(t *testing.T, done chan struct{}, message string) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal(message)
+	}
+}
+
+// 测试共享锁兼容，排他锁等待到持有者释放
+func TestLockManager_SharedAndExclusive(t *testing.T) {
+	lm := NewLockManager()
+	tx1 := NewTransaction(1, 2, RepeatableRead)
+	tx2 := NewTransaction(2, 3, RepeatableRead)
+	tx3 := NewTransaction(3, 4, RepeatableRead)
+
+	if err := lm.Lock(tx1, "a", LockShared); err != nil {
+		t.Fatalf("加共享锁失败: %v", err)
+	}
+	expectGranted(t, lockAsync(t, lm, tx2, "a", LockShared), "共享锁之间不应该等待")
+
+	done := lockAsync(t, lm, tx3, "a", LockExclusive)
+	expectBlocked(t, done, "排他锁应该等待共享锁释放")
+	lm.UnlockAll(tx1.TransactionID)
+	expectBlocked(t, done, "还有事务持有共享锁")
+	lm.UnlockAll(tx2.TransactionID)
+	expectGranted(t, done, "共享锁都释放后应该授予排他锁")
+	if lm.HeldMode(tx3.TransactionID, "a") != LockExclusive {
+		t.Error("事务应该持有排他锁")
+	}
+
+	// 排他锁之后的共享锁请求也要等待
+	done = lockAsync(t, lm, tx1, "a", LockShared)
+	expectBlocked(t, done, "共享锁应该等待排他锁释放")
+	lm.UnlockAll(tx3.TransactionID)
+	expectGranted(t, done, "排他锁释放后应该授予共享锁")
+}
+
+// 测试共享锁升级为排他锁
+func TestLockManager_Upgrade(t *testing.T) {
+	lm := NewLockManager()
+	tx1 := NewTransaction(1, 2, RepeatableRead)
+	tx2 := NewTransaction(2, 3, RepeatableRead)
+	lm.Lock(tx1, "a", LockShared)
+	lm.Lock(tx2, "a", LockShared)
+
+	done := lockAsync(t, lm, tx1, "a", LockExclusive)
+	expectBlocked(t, done, "升级应该等待其他共享锁释放")
+	lm.UnlockAll(tx2.TransactionID)
+	expectGranted(t, done, "其他共享锁释放后应该升级成功")
+	if lm.HeldMode(tx1.TransactionID, "a") != LockExclusive {
+		t.Error("升级后应该持有排他锁")
+	}
+	// 已经持有排他锁时再加锁不会等待
+	if err := lm.Lock(tx1, "a", LockShared); err != nil {
+		t.Errorf("重复加锁失败: %v", err)
+	}
+}
+
+// 测试死锁时选开始时间最晚的事务作为牺牲者
+func TestLockManager_Deadlock(t *testing.T) {
+	lm := NewLockManager()
+	older := NewTransaction(1, 2, RepeatableRead)
+	younger := NewTransaction(2, 3, RepeatableRead)
+	younger.BeginTime = older.BeginTime.Add(time.Second)
+	lm.Lock(older, "a", LockExclusive)
+	lm.Lock(younger, "b", LockExclusive)
+
+	// 年轻的事务先开始等待，年老的事务形成环时牺牲者是正在等待的年轻事务
+	result := make(chan error, 1)
+	go func() { result <- lm.Lock(younger, "a", LockExclusive) }()
+	time.Sleep(50 * time.Millisecond)
+	granted := make(chan error, 1)
+	go func() { granted <- lm.Lock(older, "b", LockExclusive) }()
+
+	select {
+	case err := <-result:
+		if err != ErrDeadlock {
+			t.Fatalf("牺牲者应该得到死锁错误: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("死锁没有被检测到")
+	}
+	lm.UnlockAll(younger.TransactionID)
+	select {
+	case err := <-granted:
+		if err != nil {
+			t.Fatalf("牺牲者释放锁后应该授予: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("牺牲者释放锁后应该授予")
+	}
+
+	// 年轻的事务自己形成环时直接返回
+	lm.UnlockAll(older.TransactionID)
+	lm.Lock(older, "a", LockShared)
+	lm.Lock(younger, "a", LockShared)
+	go func() { granted <- lm.Lock(older, "a", LockExclusive) }()
+	time.Sleep(50 * time.Millisecond)
+	if err := lm.Lock(younger, "a", LockExclusive); err != ErrDeadlock {
+		t.Fatalf("同时升级应该返回死锁错误: %v", err)
+	}
+	lm.UnlockAll(younger.TransactionID)
+	if err := <-granted; err != nil {
+		t.Fatalf("升级失败: %v", err)
+	}
+}
@@ -1,40 +1,215 @@
 package Transaction
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
-	"time"
+	"hash/crc32"
+	"unsafe"
 )
 
-type TransactionLog struct {
-	TransactionID    int32
-	TransactionLevel int32
-	BeginTime        time.Time
-	EndTime          time.Time
-	Status           uint8
-	Operations       []Operation
+// 日志记录类型
+const (
+	LogBegin      = 1 // 事务开始
+	LogInsert     = 2 // 插入，After是插入的记录
+	LogUpdate     = 3 // 更新，Before和After是修改前后的记录
+	LogDelete     = 4 // 删除，Before是被删除的记录
+	LogCommit     = 5 // 事务提交
+	LogAbort      = 6 // 事务中止，回滚已经完成
+	LogCLR        = 7 // 补偿日志，记录一次撤销操作，只重做不撤销
+	LogPageImage  = 8 // 只包含页面镜像，例如先于记录写入的溢出页
+	LogCheckpoint = 9 // 检查点，保存活动事务表和脏页表
+)
+
+// 文件头的镜像使用这个页ID
+const FileHeaderPageID = ^uint32(0)
+
+// 日志记录头 56Byte
+type LogRecordHeader struct {
+	Length        uint32 // 整条记录的长度
+	CheckSum      uint32 // CRC32C校验和，覆盖校验和之后的所有字节
+	LSN           uint64 // 日志序列号，即记录在日志中的位置
+	PrevLSN       uint64 // 同一事务的上一条日志
+	UndoNextLSN   uint64 // 补偿日志：下一条需要撤销的日志
+	TransactionID int32  // 事务ID
+	Type          uint8  // 日志类型
+	Reserved      uint8  // 保留字段
+	PageCount     uint16 // 页面镜像个数
+	KeySize       uint32 // 键长度
+	BeforeSize    uint32 // 修改前记录的长度
+	AfterSize     uint32 // 修改后记录的长度
+	PageID        uint32 // 按记录重做的叶子页面，0表示只用页面镜像重做
 }
 
-func NewTransactionLog(transactionID int32, transactionLevel int32, beginTime time.Time) *TransactionLog {
-	return &TransactionLog{
-		TransactionID:    transactionID,
-		TransactionLevel: transactionLevel,
-		BeginTime:        beginTime,
-		Status:           Active,
+const LogRecordHeaderSize = uint32(unsafe.Sizeof(LogRecordHeader{}))
+
+// 页面镜像，重做时整页覆盖
+type PageImage struct {
+	PageID uint32
+	Data   []byte
+}
+
+// 一条日志记录
+type LogRecord struct {
+	LSN           uint64
+	PrevLSN       uint64
+	UndoNextLSN   uint64
+	TransactionID int32
+	Type          uint8
+	Key           []byte
+	Before        []byte // 修改前的记录，用于撤销
+	After         []byte // 修改后的记录
+	// 只修改了一个叶子的操作不记录页面镜像，重做时在这个页面上把Key设为After，After为空时删除Key
+	PageID uint32
+	Pages  []PageImage
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+func NewLogRecord(transactionID int32, logType uint8) *LogRecord {
+	return &LogRecord{
+		TransactionID: transactionID,
+		Type:          logType,
 	}
 }
 
-func (tl *TransactionLog) AddOperation(operation Operation) {
-	tl.Operations = append(tl.Operations, operation)
+// 添加一个页面镜像
+func (lr *LogRecord) AddPage(pageID uint32, data []byte) {
+	lr.Pages = append(lr.Pages, PageImage{PageID: pageID, Data: data})
 }
 
-func (tl *TransactionLog) SetEndTime(endTime time.Time) {
-	tl.EndTime = endTime
+// 操作类日志在回滚时需要撤销
+func (lr *LogRecord) IsUndoable() bool {
+	return lr.Type == LogInsert || lr.Type == LogUpdate || lr.Type == LogDelete
 }
 
-func (tl *TransactionLog) SetStatus(status uint8) {
-	tl.Status = status
+// 序列化后的长度
+func (lr *LogRecord) Size() uint32 {
+	size := LogRecordHeaderSize + uint32(len(lr.Key)+len(lr.Before)+len(lr.After))
+	for _, page := range lr.Pages {
+		size += 8 + uint32(len(page.Data))
+	}
+	return size
+}
+
+// 序列化，校验和在最后计算
+func (lr *LogRecord) SerializeTo() ([]byte, error) {
+	if len(lr.Pages) > 0xFFFF {
+		return nil, fmt.Errorf("页面镜像太多: %d", len(lr.Pages))
+	}
+	header := LogRecordHeader{
+		Length:        lr.Size(),
+		LSN:           lr.LSN,
+		PrevLSN:       lr.PrevLSN,
+		UndoNextLSN:   lr.UndoNextLSN,
+		TransactionID: lr.TransactionID,
+		Type:          lr.Type,
+		PageCount:     uint16(len(lr.Pages)),
+		KeySize:       uint32(len(lr.Key)),
+		BeforeSize:    uint32(len(lr.Before)),
+		AfterSize:     uint32(len(lr.After)),
+		PageID:        lr.PageID,
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, header.Length))
+	if err := binary.Write(buffer, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("序列化日志失败: %v", err)
+	}
+	buffer.Write(lr.Key)
+	buffer.Write(lr.Before)
+	buffer.Write(lr.After)
+	for _, page := range lr.Pages {
+		binary.Write(buffer, binary.LittleEndian, page.PageID)
+		binary.Write(buffer, binary.LittleEndian, uint32(len(page.Data)))
+		buffer.Write(page.Data)
+	}
+
+	data := buffer.Bytes()
+	binary.LittleEndian.PutUint32(data[4:8], crc32.Checksum(data[8:], crc32cTable))
+	return data, nil
 }
 
-func (tl *TransactionLog) Output() string {
-	return fmt.Sprintf("[%d] TransactionID: %d, TransactionLevel: %d, BeginTime: %s, EndTime: %s, Status: %d", time.Now().Unix(), tl.TransactionID, tl.TransactionLevel, tl.BeginTime, tl.EndTime, tl.Status)
+// 反序列化，长度或校验和不对时返回错误
+func (lr *LogRecord) DeserializeFrom(data []byte) error {
+	if uint32(len(data)) < LogRecordHeaderSize {
+		return fmt.Errorf("日志数据长度不足: %d", len(data))
+	}
+	header := LogRecordHeader{}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("解析日志头失败: %v", err)
+	}
+	if header.Length != uint32(len(data)) {
+		return fmt.Errorf("日志长度不一致: 期望 %d, 实际 %d", header.Length, len(data))
+	}
+	if crc32.Checksum(data[8:], crc32cTable) != header.CheckSum {
+		return fmt.Errorf("日志校验和错误, LSN %d", header.LSN)
+	}
+
+	lr.LSN = header.LSN
+	lr.PrevLSN = header.PrevLSN
+	lr.UndoNextLSN = header.UndoNextLSN
+	lr.TransactionID = header.TransactionID
+	lr.Type = header.Type
+	lr.PageID = header.PageID
+
+	offset := LogRecordHeaderSize
+	next := func(size uint32) ([]byte, error) {
+		if size > uint32(len(data))-offset {
+			return nil, fmt.Errorf("日志数据不完整, LSN %d", header.LSN)
+		}
+		field := data[offset : offset+size]
+		offset += size
+		return field, nil
+	}
+	var err error
+	if lr.Key, err = next(header.KeySize); err != nil {
+		return err
+	}
+	if lr.Before, err = next(header.BeforeSize); err != nil {
+		return err
+	}
+	if lr.After, err = next(header.AfterSize); err != nil {
+		return err
+	}
+	lr.Pages = make([]PageImage, 0, header.PageCount)
+	for i := 0; i < int(header.PageCount); i++ {
+		pageHeader, err := next(8)
+		if err != nil {
+			return err
+		}
+		pageData, err := next(binary.LittleEndian.Uint32(pageHeader[4:8]))
+		if err != nil {
+			return err
+		}
+		lr.AddPage(binary.LittleEndian.Uint32(pageHeader[0:4]), pageData)
+	}
+	return nil
+}
+
+func (lr *LogRecord) String() string {
+	return fmt.Sprintf("LSN: %d, PrevLSN: %d, TransactionID: %d, Type: %s, Pages: %d", lr.LSN, lr.PrevLSN, lr.TransactionID, logTypeName(lr.Type), len(lr.Pages))
+}
+
+func logTypeName(logType uint8) string {
+	switch logType {
+	case LogBegin:
+		return "Begin"
+	case LogInsert:
+		return "Insert"
+	case LogUpdate:
+		return "Update"
+	case LogDelete:
+		return "Delete"
+	case LogCommit:
+		return "Commit"
+	case LogAbort:
+		return "Abort"
+	case LogCLR:
+		return "CLR"
+	case LogPageImage:
+		return "PageImage"
+	case LogCheckpoint:
+		return "Checkpoint"
+	default:
+		return "Unknown"
+	}
 }
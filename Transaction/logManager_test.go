@@ -0,0 +1,293 @@
+package Transaction
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 创建测试用的日志文件
+func setupLogManagerTest(t *testing.T) (*LogManager, string) {
+	fileName := filepath.Join(t.TempDir(), "test.wdb"+LogFileSuffix)
+	lm, err := OpenLogManager(fileName)
+	if err != nil {
+		t.Fatalf("打开日志失败: %v", err)
+	}
+	return lm, fileName
+}
+
+// 创建一条带页面镜像的插入日志
+func createTestLogRecord(transactionID int32, key string) *LogRecord {
+	record := NewLogRecord(transactionID, LogInsert)
+	record.Key = []byte(key)
+	record.After = []byte("after-" + key)
+	record.AddPage(3, bytes.Repeat([]byte{byte(len(key))}, 4096))
+	return record
+}
+
+// 测试日志序列化和反序列化
+func TestLogRecord_Serialize(t *testing.T) {
+	record := createTestLogRecord(7, "key")
+	record.LSN = 100
+	record.PrevLSN = 50
+	record.Before = []byte("before")
+	record.PageID = 5
+	data, err := record.SerializeTo()
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	if uint32(len(data)) != record.Size() {
+		t.Errorf("序列化长度不正确: 期望 %d, 实际 %d", record.Size(), len(data))
+	}
+
+	parsed := &LogRecord{}
+	if err := parsed.DeserializeFrom(data); err != nil {
+		t.Fatalf("反序列化失败: %v", err)
+	}
+	if parsed.LSN != 100 || parsed.PrevLSN != 50 || parsed.TransactionID != 7 || parsed.Type != LogInsert || parsed.PageID != 5 {
+		t.Errorf("日志头不正确: %v", parsed)
+	}
+	if string(parsed.Key) != "key" || string(parsed.Before) != "before" || string(parsed.After) != "after-key" {
+		t.Error("日志内容不正确")
+	}
+	if len(parsed.Pages) != 1 || parsed.Pages[0].PageID != 3 || !bytes.Equal(parsed.Pages[0].Data, record.Pages[0].Data) {
+		t.Error("页面镜像不正确")
+	}
+
+	// 任何一个字节被改动都能发现
+	data[len(data)-1] ^= 0xFF
+	if err := parsed.DeserializeFrom(data); err == nil {
+		t.Error("校验和错误应该返回错误")
+	}
+}
+
+// 测试LSN递增、读取和刷盘
+func TestLogManager_AppendAndRead(t *testing.T) {
+	lm, fileName := setupLogManagerTest(t)
+
+	var lsns []uint64
+	for i, key := range []string{"a", "bb", "ccc"} {
+		lsn, err := lm.Append(createTestLogRecord(int32(i), key))
+		if err != nil {
+			t.Fatalf("追加日志失败: %v", err)
+		}
+		if len(lsns) > 0 && lsn <= lsns[len(lsns)-1] {
+			t.Errorf("LSN没有递增: %d", lsn)
+		}
+		lsns = append(lsns, lsn)
+	}
+	if lsns[0] != FirstLSN {
+		t.Errorf("第一条日志的LSN不正确: %d", lsns[0])
+	}
+
+	// 刷盘前可以从缓冲区读取
+	record, err := lm.ReadRecord(lsns[1])
+	if err != nil || string(record.Key) != "bb" {
+		t.Fatalf("读取日志失败: %v", err)
+	}
+	if lm.GetFlushedLSN() > lsns[0] {
+		t.Error("追加日志时不应写入磁盘")
+	}
+
+	if err := lm.Flush(lsns[1]); err != nil {
+		t.Fatalf("刷盘失败: %v", err)
+	}
+	if lm.GetFlushedLSN() <= lsns[1] {
+		t.Errorf("刷盘后LSN不正确: %d", lm.GetFlushedLSN())
+	}
+	record, err = lm.ReadRecord(lsns[2])
+	if err != nil || string(record.Key) != "ccc" {
+		t.Fatalf("刷盘后读取日志失败: %v", err)
+	}
+	nextLSN := lm.GetNextLSN()
+	lm.Close()
+
+	// 重新打开后继续分配LSN
+	reopened, err := OpenLogManager(fileName)
+	if err != nil {
+		t.Fatalf("重新打开日志失败: %v", err)
+	}
+	defer reopened.Close()
+	if reopened.GetNextLSN() != nextLSN {
+		t.Errorf("重新打开后LSN不正确: 期望 %d, 实际 %d", nextLSN, reopened.GetNextLSN())
+	}
+	var keys []string
+	reopened.Scan(FirstLSN, func(record *LogRecord) error {
+		keys = append(keys, string(record.Key))
+		return nil
+	})
+	if len(keys) != 3 || keys[0] != "a" || keys[2] != "ccc" {
+		t.Errorf("遍历日志结果不正确: %v", keys)
+	}
+}
+
+// 测试缓冲区满了以后自动写入磁盘，缓冲区不会一直增长
+func TestLogManager_BufferLimit(t *testing.T) {
+	lm, _ := setupLogManagerTest(t)
+	defer lm.Close()
+
+	var lsns []uint64
+	for flushedLSN := lm.GetFlushedLSN(); lm.GetFlushedLSN() == flushedLSN; {
+		lsn, err := lm.Append(createTestLogRecord(1, "key"))
+		if err != nil {
+			t.Fatalf("追加日志失败: %v", err)
+		}
+		lsns = append(lsns, lsn)
+		if len(lsns)*4096 > 2*LogBufferSize {
+			t.Fatal("缓冲区超过上限后应该写入磁盘")
+		}
+	}
+	if lm.GetFlushedLSN() != lm.GetNextLSN() {
+		t.Errorf("缓冲区应该全部写入: 落盘到 %d, 日志末尾 %d", lm.GetFlushedLSN(), lm.GetNextLSN())
+	}
+	if _, err := lm.ReadRecord(lsns[0]); err != nil {
+		t.Errorf("写入磁盘的日志应该还能读取: %v", err)
+	}
+}
+
+// 测试打开日志时截掉写了一半的记录
+func TestLogManager_TornTail(t *testing.T) {
+	lm, fileName := setupLogManagerTest(t)
+	lm.Append(createTestLogRecord(1, "a"))
+	lastLSN, _ := lm.Append(createTestLogRecord(1, "b"))
+	lm.Close()
+
+	// 模拟最后一条日志只写了一半
+	info, _ := os.Stat(fileName)
+	if err := os.Truncate(fileName, info.Size()-100); err != nil {
+		t.Fatalf("截断文件失败: %v", err)
+	}
+
+	reopened, err := OpenLogManager(fileName)
+	if err != nil {
+		t.Fatalf("重新打开日志失败: %v", err)
+	}
+	defer reopened.Close()
+	if reopened.GetNextLSN() != lastLSN {
+		t.Errorf("不完整的日志应该被截掉: 期望 %d, 实际 %d", lastLSN, reopened.GetNextLSN())
+	}
+	lsn, err := reopened.Append(createTestLogRecord(1, "c"))
+	if err != nil || lsn != lastLSN {
+		t.Fatalf("截断后追加日志不正确: %d, %v", lsn, err)
+	}
+}
+
+// 测试文件头不完整或者魔数不对的日志文件打不开
+func TestLogManager_BadHeader(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "bad.wdb"+LogFileSuffix)
+	for _, data := range [][]byte{{1, 2, 3, 4, 5, 6, 7, 8}, bytes.Repeat([]byte{0xAB}, int(LogFileHeaderSize))} {
+		if err := os.WriteFile(fileName, data, 0644); err != nil {
+			t.Fatalf("写入文件失败: %v", err)
+		}
+		if lm, err := OpenLogManager(fileName); err == nil {
+			lm.Close()
+			t.Errorf("文件头为 %x 的日志不应该能打开", data)
+		}
+	}
+}
+
+// 测试截断日志后LSN不变，并且可以读取剩下的日志
+func TestLogManager_Truncate(t *testing.T) {
+	lm, fileName := setupLogManagerTest(t)
+	lm.Append(createTestLogRecord(1, "a"))
+	lsn, _ := lm.Append(createTestLogRecord(1, "b"))
+	checkpoint := NewCheckpoint()
+	checkpoint.Transactions = []CheckpointTransaction{{TransactionID: 1, BeginLSN: lsn, LastLSN: lsn}}
+	checkpoint.DirtyPages[3] = lsn
+	checkpointLSN, _ := lm.Append(NewCheckpointLogRecord(checkpoint))
+	lm.FlushAll()
+	if err := lm.SetCheckpointLSN(checkpointLSN); err != nil {
+		t.Fatalf("记录检查点失败: %v", err)
+	}
+
+	if err := lm.Truncate(checkpoint.OldestLSN(checkpointLSN), true); err != nil {
+		t.Fatalf("截断日志失败: %v", err)
+	}
+	if lm.GetBaseLSN() != lsn {
+		t.Errorf("截断后的BaseLSN不正确: 期望 %d, 实际 %d", lsn, lm.GetBaseLSN())
+	}
+	if _, err := os.Stat(ArchiveLogFileName(fileName, FirstLSN)); err != nil {
+		t.Errorf("旧日志应该被归档: %v", err)
+	}
+	if _, err := lm.ReadRecord(FirstLSN); err == nil {
+		t.Error("截断的日志不应该还能读取")
+	}
+	nextLSN, _ := lm.Append(createTestLogRecord(1, "c"))
+	lm.Close()
+
+	// 重新打开后检查点和后面的日志都在
+	reopened, err := OpenLogManager(fileName)
+	if err != nil {
+		t.Fatalf("重新打开日志失败: %v", err)
+	}
+	defer reopened.Close()
+	if reopened.GetCheckpointLSN() != checkpointLSN || reopened.GetNextLSN() <= nextLSN {
+		t.Errorf("重新打开后日志不正确: 检查点 %d, 下一个LSN %d", reopened.GetCheckpointLSN(), reopened.GetNextLSN())
+	}
+	record, err := reopened.ReadRecord(checkpointLSN)
+	if err != nil {
+		t.Fatalf("读取检查点失败: %v", err)
+	}
+	parsed, err := record.ParseCheckpoint()
+	if err != nil {
+		t.Fatalf("解析检查点失败: %v", err)
+	}
+	if len(parsed.Transactions) != 1 || parsed.Transactions[0].LastLSN != lsn || parsed.DirtyPages[3] != lsn {
+		t.Errorf("检查点内容不正确: %+v", parsed)
+	}
+}
+
+// 测试LSN超过4GB以后还能继续追加、读取、截断和重新打开
+func TestLogManager_LSNBeyond4GB(t *testing.T) {
+	// 相当于已经写过并截断了将近4GB的日志
+	fileName := filepath.Join(t.TempDir(), "large.wdb"+LogFileSuffix)
+	baseLSN := uint64(1<<32) - 10000
+	header := new(bytes.Buffer)
+	binary.Write(header, binary.LittleEndian, &LogFileHeader{Magic: LogFileMagic, Version: LogFileVersion, BaseLSN: baseLSN})
+	if err := os.WriteFile(fileName, header.Bytes(), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	lm, err := OpenLogManager(fileName)
+	if err != nil {
+		t.Fatalf("打开日志失败: %v", err)
+	}
+
+	var lsns []uint64
+	for i := 0; i < 5; i++ {
+		lsn, err := lm.Append(createTestLogRecord(1, string(rune('a'+i))))
+		if err != nil {
+			t.Fatalf("追加日志失败: %v", err)
+		}
+		lsns = append(lsns, lsn)
+	}
+	if lsns[0] != baseLSN || lm.GetNextLSN() <= 1<<32 {
+		t.Fatalf("日志应该越过4GB: 第一条 %d, 下一个LSN %d", lsns[0], lm.GetNextLSN())
+	}
+	if err := lm.FlushAll(); err != nil {
+		t.Fatalf("刷盘失败: %v", err)
+	}
+	checkpointLSN, _ := lm.Append(NewCheckpointLogRecord(NewCheckpoint()))
+	lm.FlushAll()
+	if err := lm.SetCheckpointLSN(checkpointLSN); err != nil {
+		t.Fatalf("记录检查点失败: %v", err)
+	}
+	if err := lm.Truncate(lsns[4], false); err != nil {
+		t.Fatalf("截断日志失败: %v", err)
+	}
+	lm.Close()
+
+	reopened, err := OpenLogManager(fileName)
+	if err != nil {
+		t.Fatalf("重新打开日志失败: %v", err)
+	}
+	defer reopened.Close()
+	if reopened.GetBaseLSN() != lsns[4] || reopened.GetCheckpointLSN() != checkpointLSN {
+		t.Errorf("重新打开后日志不正确: BaseLSN %d, 检查点 %d", reopened.GetBaseLSN(), reopened.GetCheckpointLSN())
+	}
+	record, err := reopened.ReadRecord(lsns[4])
+	if err != nil || string(record.Key) != "e" || record.LSN != lsns[4] {
+		t.Fatalf("读取4GB之后的日志失败: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package Transaction
+
+import (
+	"testing"
+)
+
+// 测试开始事务时分配递增的事务ID并保存计数器，提交和回滚后事务从事务表中删除
+func TestTransactionManager_Begin(t *testing.T) {
+	lm, _ := setupLogManagerTest(t)
+	tm := NewTransactionManager(lm)
+	defer tm.Close()
+
+	var saved int32
+	tm.SetNextTransactionID(10, func(next int32) error {
+		saved = next
+		return nil
+	})
+	tx1, err := tm.Begin(ReadCommitted)
+	if err != nil {
+		t.Fatalf("开始事务失败: %v", err)
+	}
+	tx2, err := tm.Begin(Serializable)
+	if err != nil {
+		t.Fatalf("开始事务失败: %v", err)
+	}
+	if tx1.TransactionID != 10 || tx2.TransactionID != 11 || tx2.IsolationLevel != Serializable {
+		t.Errorf("事务ID不正确: %d, %d", tx1.TransactionID, tx2.TransactionID)
+	}
+	if saved != 12 || tm.GetNextTransactionID() != 12 {
+		t.Errorf("保存的计数器不正确: 保存 %d, 下一个 %d", saved, tm.GetNextTransactionID())
+	}
+
+	// 写过日志的事务提交后日志落盘
+	if err := tm.AddTransaction(tx1); err != nil {
+		t.Fatalf("登记事务失败: %v", err)
+	}
+	if err := tm.Commit(tx1.TransactionID); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	if err := tm.Rollback(tx2.TransactionID); err != nil {
+		t.Fatalf("回滚事务失败: %v", err)
+	}
+	for _, tx := range []*Transaction{tx1, tx2} {
+		if tx.EndTime.IsZero() {
+			t.Errorf("事务 %d 没有记录结束时间", tx.TransactionID)
+		}
+		if _, ok := tm.TransactionMap[tx.TransactionID]; ok {
+			t.Errorf("结束的事务 %d 应该从事务表中删除", tx.TransactionID)
+		}
+	}
+	if tx1.Status != Committed || tx2.Status != Aborted {
+		t.Errorf("事务状态不正确: %d, %d", tx1.Status, tx2.Status)
+	}
+	if lm.GetFlushedLSN() != lm.GetNextLSN() {
+		t.Errorf("提交日志应该已经落盘: 落盘到 %d, 日志末尾 %d", lm.GetFlushedLSN(), lm.GetNextLSN())
+	}
+}
+
+// 测试事务的RollbackTo交给事务管理器设置的方法撤销；没有登记的事务没有操作可撤销
+func TestTransaction_RollbackTo(t *testing.T) {
+	lm, _ := setupLogManagerTest(t)
+	tm := NewTransactionManager(lm)
+	defer tm.Close()
+
+	unregistered := NewTransaction(1, 2, ReadCommitted)
+	unregistered.Savepoint("a")
+	unregistered.Savepoint("b")
+	if err := unregistered.RollbackTo("a"); err != nil {
+		t.Fatalf("回滚到保存点失败: %v", err)
+	}
+	if err := unregistered.RollbackTo("b"); err != ErrSavepointNotFound {
+		t.Errorf("之后建立的保存点应该被丢弃: %v", err)
+	}
+
+	var undone string
+	tm.SetRollbackTo(func(transaction *Transaction, name string) error {
+		undone = name
+		_, err := transaction.RewindSavepoint(name)
+		return err
+	})
+	tx, err := tm.Begin(ReadCommitted)
+	if err != nil {
+		t.Fatalf("开始事务失败: %v", err)
+	}
+	tx.Savepoint("a")
+	if err := tm.AddTransaction(tx); err != nil {
+		t.Fatalf("登记事务失败: %v", err)
+	}
+	if err := tx.RollbackTo("a"); err != nil || undone != "a" {
+		t.Errorf("回滚应该交给事务管理器设置的方法: %q, %v", undone, err)
+	}
+}
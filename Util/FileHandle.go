@@ -48,6 +48,8 @@ func (f *FileHandle) GetFileID() string {
 }
 
 func (f *FileHandle) GetOffset() int64 {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
 	return f.Offset
 }
 
@@ -57,27 +59,77 @@ func (f *FileHandle) GetFile() *os.File {
 
 /*
 *
-读取文件内容，从Offset位置开始读取
-@param p 读取到的内容
-@return n 实际读取到的字节数
+读取文件内容，从Offset位置开始读取，读完后移动Offset。
+多个goroutine共用Offset时应该使用ReadAt
+@param length 读取的字节数
+@return 读取到的内容
 @return err 错误信息
 */
 func (f *FileHandle) Read(length int64) ([]byte, error) {
+	// 读取会移动偏移量，和写入一样需要独占
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	data, err := f.readAt(f.Offset, length)
+	f.Offset += int64(len(data))
+	return data, err
+}
+
+/*
+*
+写入文件内容，从Offset位置开始写入，写完后移动Offset。
+多个goroutine共用Offset时应该使用WriteAt
+@param p 写入的内容
+@return n 实际写入的字节数
+@return err 错误信息
+*/
+func (f *FileHandle) Write(p []byte) (n int, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	n, err = f.File.WriteAt(p, f.Offset)
+	if err == nil {
+		f.Offset += int64(n)
+	}
+	return n, err
+}
+
+/*
+*
+从指定偏移量读取文件内容，不使用也不修改Offset，可以被多个goroutine并发调用
+@param offset 读取的起始位置
+@param length 读取的字节数
+@return 读取到的内容
+@return err 错误信息
+*/
+func (f *FileHandle) ReadAt(offset int64, length int64) ([]byte, error) {
 	f.mutex.RLock()
 	defer f.mutex.RUnlock()
+	return f.readAt(offset, length)
+}
 
+/*
+*
+把内容写到指定偏移量，不使用也不修改Offset
+@param offset 写入的起始位置
+@param p 写入的内容
+@return n 实际写入的字节数
+@return err 错误信息
+*/
+func (f *FileHandle) WriteAt(offset int64, p []byte) (n int, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.File.WriteAt(p, offset)
+}
+
+func (f *FileHandle) readAt(offset int64, length int64) ([]byte, error) {
 	// 创建缓冲区
 	data := make([]byte, length)
 
 	// 从指定偏移量读取数据
-	n, err := f.File.ReadAt(data, f.Offset)
+	n, err := f.File.ReadAt(data, offset)
 	if err != nil {
 		return nil, fmt.Errorf("读取文件失败: %v", err)
 	}
 
-	// 更新偏移量
-	f.Offset += int64(n)
-
 	// 如果读取的数据长度不足，返回错误
 	if int64(n) < length {
 		return data[:n], fmt.Errorf("读取数据不完整: 期望 %d 字节, 实际读取 %d 字节", length, n)
@@ -86,23 +138,6 @@ func (f *FileHandle) Read(length int64) ([]byte, error) {
 	return data, nil
 }
 
-/*
-*
-写入文件内容，从Offset位置开始写入
-@param p 写入的内容
-@return n 实际写入的字节数
-@return err 错误信息
-*/
-func (f *FileHandle) Write(p []byte) (n int, err error) {
-	f.mutex.Lock()
-	defer f.mutex.Unlock()
-	n, err = f.File.WriteAt(p, f.Offset)
-	if err == nil {
-		f.Offset += int64(n)
-	}
-	return n, err
-}
-
 /*
 *
 关闭文件